@@ -0,0 +1,106 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// reauthWindow is how recently a user without a password must have signed
+// in before they can delete their account.
+const reauthWindow = 5 * time.Minute
+
+func (cfg *apiConfig) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	claims, userID, err := cfg.authenticateClaims(r, "")
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+
+	params := struct {
+		Password string `json:"password"`
+	}{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil && user.Password != "" {
+		responseWithError(w, http.StatusBadRequest, `{"error": "Invalid request payload"}`)
+		return
+	}
+
+	// Users who only sign in through an external provider have no password
+	// to confirm, so they need a fresh login instead.
+	if user.Password != "" {
+		err = cfg.passwords.Compare(user.Password, params.Password)
+		if err != nil {
+			responseWithError(w, http.StatusUnauthorized, `{"error": "Invalid password"}`)
+			return
+		}
+	} else if claims.IssuedAt == nil || time.Since(claims.IssuedAt.Time) > reauthWindow {
+		responseWithError(w, http.StatusUnauthorized, `{"error": "Sign in again to delete your account"}`)
+		return
+	}
+
+	removed, err := cfg.db.DeleteUser(user.ID, cfg.chirpRetention)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not delete user"}`)
+		return
+	}
+	for _, item := range removed {
+		cfg.deleteBlobs(r.Context(), item)
+	}
+	w.WriteHeader(204)
+}
+
+// handleGETUserExport sends a zip archive of the caller's data as JSON plus
+// an HTML page for reading it without tools.
+func (cfg *apiConfig) handleGETUserExport(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, "")
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	export, err := cfg.db.ExportUser(userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not export user"}`)
+		return
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal export"}`)
+		return
+	}
+
+	filename := fmt.Sprintf("chirpy-export-%d-%s.zip", userID, export.ExportedAt.Format("20060102"))
+	w.Header().Add("Content-Type", "application/zip")
+	w.Header().Add("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Add("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are already sent, so failures past this point can only be
+	// logged.
+	archive := zip.NewWriter(w)
+	file, err := archive.Create("chirpy/data.json")
+	if err == nil {
+		_, err = file.Write(data)
+	}
+	if err == nil {
+		file, err = archive.Create("chirpy/index.html")
+	}
+	if err == nil {
+		err = cfg.exportTemplate.Execute(file, export)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		log.Printf("export user %d: %v", userID, err)
+	}
+}
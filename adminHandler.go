@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+// suspensionResponse is the JSON shape of a suspension. Until is null for
+// permanent bans.
+type suspensionResponse struct {
+	Reason     string     `json:"reason"`
+	Until      *time.Time `json:"until"`
+	Permanent  bool       `json:"permanent"`
+	HideChirps bool       `json:"hide_chirps"`
+	By         int        `json:"by"`
+	At         time.Time  `json:"at"`
+}
+
+func newSuspensionResponse(suspension *database.Suspension) suspensionResponse {
+	response := suspensionResponse{
+		Reason:     suspension.Reason,
+		Permanent:  suspension.Permanent(),
+		HideChirps: suspension.HideChirps,
+		By:         suspension.By,
+		At:         suspension.At,
+	}
+	if !suspension.Permanent() {
+		until := suspension.Until
+		response.Until = &until
+	}
+	return response
+}
+
+// respondWithSuspended turns away a suspended user trying to sign in.
+func respondWithSuspended(w http.ResponseWriter, suspension *database.Suspension) {
+	type returnError struct {
+		Error      string             `json:"error"`
+		Suspension suspensionResponse `json:"suspension"`
+	}
+	jsonReturn, err := json.Marshal(returnError{
+		Error:      "account suspended",
+		Suspension: newSuspensionResponse(suspension),
+	})
+	if err != nil {
+		responseWithError(w, http.StatusForbidden, `{"error": "account suspended"}`)
+		return
+	}
+	responseWithJson(w, http.StatusForbidden, jsonReturn)
+}
+
+// authenticateAdmin is authenticateModerator for the admin endpoints,
+// whose callers must be listed in ADMIN_USER_IDS.
+func (cfg *apiConfig) authenticateAdmin(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := cfg.authenticate(r, "")
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return 0, false
+	}
+	if !cfg.admins[userID] {
+		responseWithError(w, http.StatusForbidden, `{"error": "admins only"}`)
+		return 0, false
+	}
+	return userID, true
+}
+
+// handlePUTSuspension suspends a user for a number of days, or bans them
+// with permanent. Either way they're signed out everywhere, and with
+// hide_chirps their chirps are hidden until the suspension ends.
+func (cfg *apiConfig) handlePUTSuspension(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.authenticateAdmin(w, r)
+	if !ok {
+		return
+	}
+	user, err := cfg.lookupUser(r.PathValue("user"))
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+	if user.ID == adminID {
+		responseWithError(w, http.StatusBadRequest, `{"error": "you can't suspend yourself"}`)
+		return
+	}
+	type parameters struct {
+		Reason     string `json:"reason"`
+		Days       int    `json:"days"`
+		Permanent  bool   `json:"permanent"`
+		HideChirps bool   `json:"hide_chirps"`
+	}
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "Something went wrong"}`)
+		return
+	}
+	if params.Reason == "" {
+		responseWithError(w, http.StatusBadRequest, `{"error": "a reason is required"}`)
+		return
+	}
+	if params.Permanent == (params.Days > 0) || params.Days < 0 {
+		responseWithError(w, http.StatusBadRequest, `{"error": "give either a positive number of days or permanent"}`)
+		return
+	}
+
+	suspension := database.Suspension{
+		Reason:     params.Reason,
+		By:         adminID,
+		HideChirps: params.HideChirps,
+	}
+	if !params.Permanent {
+		suspension.Until = time.Now().UTC().AddDate(0, 0, params.Days)
+	}
+	user, err = cfg.db.SuspendUser(user.ID, suspension)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not suspend user"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(newSuspensionResponse(user.Suspension))
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handleDeleteSuspension lifts a suspension or ban early. note is an
+// optional explanation for the audit log.
+func (cfg *apiConfig) handleDeleteSuspension(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.authenticateAdmin(w, r)
+	if !ok {
+		return
+	}
+	user, err := cfg.lookupUser(r.PathValue("user"))
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+	err = cfg.db.LiftSuspension(user.ID, adminID, r.URL.Query().Get("note"))
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not lift suspension"}`)
+		return
+	}
+	w.WriteHeader(204)
+}
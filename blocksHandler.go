@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sutradev/chirpy/internal/auth"
+)
+
+// handleGETBlocks lists the accounts the caller has blocked, most recent
+// first. Pages are selected with limit and offset.
+func (cfg *apiConfig) handleGETBlocks(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeFollowsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	cfg.respondWithUserList(w, r, userID, cfg.db.GetBlocked)
+}
+
+// handlePUTBlock blocks a user, which also removes any follows between
+// the two accounts. Blocking someone twice is not an error.
+func (cfg *apiConfig) handlePUTBlock(w http.ResponseWriter, r *http.Request) {
+	cfg.updateUserRelation(w, r, "you can't block yourself", cfg.db.Block)
+}
+
+func (cfg *apiConfig) handleDeleteBlock(w http.ResponseWriter, r *http.Request) {
+	cfg.updateUserRelation(w, r, "", cfg.db.Unblock)
+}
+
+// handleGETMutes lists the accounts the caller has muted, most recent
+// first. Pages are selected with limit and offset.
+func (cfg *apiConfig) handleGETMutes(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeFollowsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	cfg.respondWithUserList(w, r, userID, cfg.db.GetMuted)
+}
+
+func (cfg *apiConfig) handlePUTMute(w http.ResponseWriter, r *http.Request) {
+	cfg.updateUserRelation(w, r, "you can't mute yourself", cfg.db.Mute)
+}
+
+func (cfg *apiConfig) handleDeleteMute(w http.ResponseWriter, r *http.Request) {
+	cfg.updateUserRelation(w, r, "", cfg.db.Unmute)
+}
+
+// updateUserRelation applies a block or mute change between the caller and
+// the user in the path. selfError is the message for pointing it at
+// yourself, or empty if that's harmless.
+func (cfg *apiConfig) updateUserRelation(w http.ResponseWriter, r *http.Request, selfError string, update func(userID, otherID int) error) {
+	userID, err := cfg.authenticate(r, auth.ScopeFollowsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	other, err := cfg.lookupUser(r.PathValue("user"))
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+	if other.ID == userID && selfError != "" {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, selfError))
+		return
+	}
+	err = update(userID, other.ID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not update user"}`)
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+// handleGETBookmarks lists the caller's bookmarks, most recently
+// bookmarked first. Pages are selected with limit and offset.
+func (cfg *apiConfig) handleGETBookmarks(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeBookmarksRead)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	offset, err := parseOffset(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+
+	bookmarked, err := cfg.db.GetBookmarkedChirps(userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not list bookmarks"}`)
+		return
+	}
+	total := len(bookmarked)
+	bookmarked = page(bookmarked, offset, limit)
+
+	chirps := make([]database.Chirp, 0, len(bookmarked))
+	for _, bookmark := range bookmarked {
+		chirps = append(chirps, bookmark.Chirp)
+	}
+	responses, err := cfg.chirpResponses(chirps, userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not list bookmarks"}`)
+		return
+	}
+
+	type bookmarkEntry struct {
+		chirpResponse
+		BookmarkedAt string `json:"bookmarked_at"`
+	}
+	type returnList struct {
+		Total  int             `json:"total"`
+		Chirps []bookmarkEntry `json:"chirps"`
+	}
+	result := returnList{
+		Total:  total,
+		Chirps: make([]bookmarkEntry, 0, len(responses)),
+	}
+	for i, response := range responses {
+		result.Chirps = append(result.Chirps, bookmarkEntry{
+			chirpResponse: response,
+			BookmarkedAt:  bookmarked[i].BookmarkedAt.Format(time.RFC3339),
+		})
+	}
+
+	jsonReturn, err := json.Marshal(result)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handlePOSTBookmark bookmarks the chirp given by chirp_id. Bookmarking a
+// chirp again has no further effect.
+func (cfg *apiConfig) handlePOSTBookmark(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeBookmarksWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	type parameters struct {
+		ChirpID int `json:"chirp_id"`
+	}
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil || params.ChirpID == 0 {
+		responseWithError(w, http.StatusBadRequest, `{"error": "chirp_id is required"}`)
+		return
+	}
+
+	chirp, err := cfg.db.Bookmark(userID, params.ChirpID)
+	if errors.Is(err, database.ErrChirpNotFound) {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find chirp"}`)
+		return
+	}
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not add bookmark"}`)
+		return
+	}
+	response, err := cfg.chirpResponse(chirp, userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(response)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusCreated, jsonReturn)
+}
+
+// handleDeleteBookmark removes the bookmark on a chirp, if there is one.
+func (cfg *apiConfig) handleDeleteBookmark(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeBookmarksWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	err = cfg.db.Unbookmark(userID, chirpID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not remove bookmark"}`)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+	"github.com/sutradev/chirpy/internal/moderation"
+)
+
+// chirpEditWindow is how long after posting a chirp can still be edited.
+const chirpEditWindow = 30 * time.Minute
+
+// handlePUTChirp lets a Chirpy Red author change the body, content warning
+// and sensitive flag of a recent chirp. The new body goes through
+// moderation like a new chirp, and the previous body is kept in the
+// chirp's history. Warnings forced on by moderators stay.
+func (cfg *apiConfig) handlePUTChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+		return
+	}
+	if !user.IsChirpyRed {
+		responseWithError(w, http.StatusForbidden, `{"error": "Editing chirps requires Chirpy Red"}`)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := database.Chirp{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "Something went wrong"}`)
+		return
+	}
+	decision, err := cfg.moderateChirp(params.Body)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	// A published chirp can't be pulled back for review, so edits that
+	// would be held are refused instead.
+	if decision.Action == moderation.ActionHold {
+		responseWithError(w, http.StatusBadRequest, `{"error": "This edit needs review and can't be published"}`)
+		return
+	}
+	warning, err := cfg.contentWarning(params.ContentWarning, decision)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	mentions, hashtags := extractEntities(decision.Body)
+
+	chirp, err := cfg.db.EditChirp(chirpID, userID, database.Chirp{
+		Body:           decision.Body,
+		Mentions:       mentions,
+		Hashtags:       hashtags,
+		Moderation:     moderationRecord(decision),
+		ContentWarning: warning,
+		Sensitive:      params.Sensitive,
+	}, chirpEditWindow)
+	if errors.Is(err, database.ErrNotChirpAuthor) {
+		responseWithError(w, http.StatusForbidden, `{"error": "Only the author can edit a chirp"}`)
+		return
+	}
+	if errors.Is(err, database.ErrEditWindowClosed) {
+		responseWithError(w, http.StatusForbidden, fmt.Sprintf(`{"error": "Chirps can only be edited for %s after posting"}`, chirpEditWindow))
+		return
+	}
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find chirp"}`)
+		return
+	}
+
+	response, err := cfg.chirpResponse(chirp, userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(response)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handleGETChirpHistory lists every version of a chirp, oldest first and
+// ending with the current one.
+func (cfg *apiConfig) handleGETChirpHistory(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	history, err := cfg.db.GetChirpHistory(chirpID, viewerID)
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find chirp"}`)
+		return
+	}
+
+	type returnVersion struct {
+		Version   int       `json:"version"`
+		Body      string    `json:"body"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	type returnHistory struct {
+		ID       int             `json:"id"`
+		Versions []returnVersion `json:"versions"`
+	}
+	result := returnHistory{
+		ID:       chirpID,
+		Versions: make([]returnVersion, 0, len(history)),
+	}
+	for i, revision := range history {
+		result.Versions = append(result.Versions, returnVersion{
+			Version:   i + 1,
+			Body:      revision.Body,
+			CreatedAt: revision.CreatedAt,
+		})
+	}
+
+	jsonReturn, err := json.Marshal(result)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
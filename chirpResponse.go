@@ -0,0 +1,222 @@
+package main
+
+import (
+	"time"
+
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+// chirpAuthor is the compact author object embedded in chirp responses.
+type chirpAuthor struct {
+	ID          int    `json:"id"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// chirpResponse is the JSON shape of a chirp in every API response.
+type chirpResponse struct {
+	ID int `json:"id"`
+	// ContentWarning comes ahead of the body. While Collapsed is set,
+	// clients should show only the warning until the reader expands it;
+	// readers who prefer them expanded get Collapsed false.
+	ContentWarning string `json:"content_warning,omitempty"`
+	Collapsed      bool   `json:"collapsed"`
+	// WarningForced means moderators put the content warning on.
+	WarningForced bool         `json:"warning_forced,omitempty"`
+	Body          string       `json:"body"`
+	AuthorID      int          `json:"author_id"`
+	Author        *chirpAuthor `json:"author"`
+	InReplyToID   int          `json:"in_reply_to_id,omitempty"`
+	ReplyCount    int          `json:"reply_count"`
+	LikeCount     int          `json:"like_count"`
+	// LikedByMe is only set when the request was authenticated.
+	LikedByMe    *bool          `json:"liked_by_me,omitempty"`
+	RechirpCount int            `json:"rechirp_count"`
+	RechirpOfID  int            `json:"rechirp_of_id,omitempty"`
+	RechirpOf    *chirpResponse `json:"rechirp_of,omitempty"`
+	// QuoteOf is left out when the quoted chirp has been deleted.
+	QuoteOfID int            `json:"quote_of_id,omitempty"`
+	QuoteOf   *chirpResponse `json:"quote_of,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	// EditedAt is null for chirps that were never edited.
+	EditedAt *time.Time `json:"edited_at"`
+	// Entity offsets count characters in Body.
+	Mentions    []database.Mention   `json:"mentions"`
+	Hashtags    []database.Hashtag   `json:"hashtags"`
+	Attachments []attachmentResponse `json:"attachments"`
+	// Sensitive attachments should be blurred until the reader reveals
+	// them.
+	Sensitive bool          `json:"sensitive"`
+	Poll      *pollResponse `json:"poll,omitempty"`
+	// Hidden is only ever seen by the author of a chirp moderators hid.
+	Hidden     bool   `json:"hidden,omitempty"`
+	Visibility string `json:"visibility"`
+}
+
+// visibilityName is how a stored visibility level is shown, since chirps
+// stored without one are public.
+func visibilityName(visibility string) string {
+	if visibility == "" {
+		return database.VisibilityPublic
+	}
+	return visibility
+}
+
+// chirpResponses decorates chirps for the API, looking up every author in
+// a single pass over the users. Rechirped and quoted chirps are embedded one
+// level deep. viewerID is the authenticated caller, or 0 for anonymous
+// requests.
+func (cfg *apiConfig) chirpResponses(chirps []database.Chirp, viewerID int) ([]chirpResponse, error) {
+	refIDs := []int{}
+	for _, chirp := range chirps {
+		if chirp.RechirpOfID != 0 {
+			refIDs = append(refIDs, chirp.RechirpOfID)
+		}
+		if chirp.QuoteOfID != 0 {
+			refIDs = append(refIDs, chirp.QuoteOfID)
+		}
+	}
+	referenced, err := cfg.db.GetChirpsByID(refIDs, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	all := chirps
+	if len(referenced) > 0 {
+		all = make([]database.Chirp, 0, len(chirps)+len(referenced))
+		all = append(all, chirps...)
+		for _, chirp := range referenced {
+			all = append(all, chirp)
+		}
+	}
+
+	decorated, err := cfg.decorateChirps(all, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]chirpResponse, len(decorated))
+	for _, response := range decorated {
+		byID[response.ID] = response
+	}
+	responses := decorated[:len(chirps)]
+	for i := range responses {
+		if original, ok := byID[responses[i].RechirpOfID]; ok && responses[i].RechirpOfID != 0 {
+			responses[i].RechirpOf = &original
+		}
+		if quoted, ok := byID[responses[i].QuoteOfID]; ok && responses[i].QuoteOfID != 0 {
+			responses[i].QuoteOf = &quoted
+		}
+	}
+	return responses, nil
+}
+
+// decorateChirps builds the flat response for each chirp without embedding
+// the chirps it references.
+func (cfg *apiConfig) decorateChirps(chirps []database.Chirp, viewerID int) ([]chirpResponse, error) {
+	authorIDs := make([]int, 0, len(chirps)+1)
+	chirpIDs := make([]int, 0, len(chirps))
+	for _, chirp := range chirps {
+		authorIDs = append(authorIDs, chirp.AuthorID)
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+	// The viewer is looked up with the authors for their preferences.
+	authors, err := cfg.db.GetUsers(append(authorIDs, viewerID))
+	if err != nil {
+		return nil, err
+	}
+	expandWarnings := viewerID != 0 && authors[viewerID].Preferences.ExpandContentWarnings
+	mediaIDs := []string{}
+	for _, chirp := range chirps {
+		mediaIDs = append(mediaIDs, chirp.Attachments...)
+	}
+	attachments, err := cfg.db.GetMedia(mediaIDs)
+	if err != nil {
+		return nil, err
+	}
+	replyCounts, err := cfg.db.GetReplyCounts(chirpIDs, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	var likedBy map[int]bool
+	votes := map[int]int{}
+	if viewerID != 0 {
+		likedBy, err = cfg.db.GetLikedBy(viewerID, chirpIDs)
+		if err != nil {
+			return nil, err
+		}
+		votes, err = cfg.db.GetPollVotes(viewerID, chirpIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	responses := make([]chirpResponse, 0, len(chirps))
+	for _, chirp := range chirps {
+		response := chirpResponse{
+			ID:           chirp.ID,
+			Body:         chirp.Body,
+			AuthorID:     chirp.AuthorID,
+			InReplyToID:  chirp.InReplyToID,
+			ReplyCount:   replyCounts[chirp.ID],
+			LikeCount:    chirp.LikeCount,
+			RechirpCount: chirp.RechirpCount,
+			RechirpOfID:  chirp.RechirpOfID,
+			QuoteOfID:    chirp.QuoteOfID,
+			Mentions:     chirp.Mentions,
+			Hashtags:     chirp.Hashtags,
+			CreatedAt:    chirp.CreatedAt,
+			UpdatedAt:    chirp.UpdatedAt,
+			Hidden:       chirp.Hidden != nil,
+			Visibility:   visibilityName(chirp.Visibility),
+		}
+		response.ContentWarning, response.Sensitive = chirp.Warning()
+		response.Collapsed = response.ContentWarning != "" && !expandWarnings
+		response.WarningForced = chirp.ForcedWarning != nil
+		if !chirp.EditedAt.IsZero() {
+			editedAt := chirp.EditedAt
+			response.EditedAt = &editedAt
+		}
+		if response.Mentions == nil {
+			response.Mentions = []database.Mention{}
+		}
+		if response.Hashtags == nil {
+			response.Hashtags = []database.Hashtag{}
+		}
+		response.Attachments = make([]attachmentResponse, 0, len(chirp.Attachments))
+		for _, id := range chirp.Attachments {
+			if item, ok := attachments[id]; ok {
+				response.Attachments = append(response.Attachments, newAttachmentResponse(item))
+			}
+		}
+		if chirp.Poll != nil {
+			var votedOption *int
+			if option, ok := votes[chirp.ID]; ok {
+				votedOption = &option
+			}
+			response.Poll = newPollResponse(chirp.Poll, votedOption)
+		}
+		if likedBy != nil {
+			liked := likedBy[chirp.ID]
+			response.LikedByMe = &liked
+		}
+		if author, ok := authors[chirp.AuthorID]; ok {
+			response.Author = &chirpAuthor{
+				ID:          author.ID,
+				Handle:      author.Handle,
+				DisplayName: author.DisplayName,
+				AvatarURL:   author.AvatarURL,
+			}
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+func (cfg *apiConfig) chirpResponse(chirp database.Chirp, viewerID int) (chirpResponse, error) {
+	responses, err := cfg.chirpResponses([]database.Chirp{chirp}, viewerID)
+	if err != nil {
+		return chirpResponse{}, err
+	}
+	return responses[0], nil
+}
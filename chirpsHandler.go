@@ -1,164 +1,365 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/sutradev/chirpy/internal/auth"
 	database "github.com/sutradev/chirpy/internal/db"
+	"github.com/sutradev/chirpy/internal/moderation"
 )
 
 func (cfg *apiConfig) handlePOSTChirps(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	userIDint, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
 	if err != nil {
+		body := fmt.Sprintln(err)
+		http.Error(w, body, authErrorStatus(err))
 		return
 	}
-	userID, err := auth.VerifyToken(token, cfg.jwtSecret)
+
+	decoder := json.NewDecoder(r.Body)
+	jsonStruct := struct {
+		database.Chirp
+		Poll *pollParams `json:"poll"`
+	}{}
+	err = decoder.Decode(&jsonStruct)
 	if err != nil {
-		body := fmt.Sprintln(err)
-		http.Error(w, body, http.StatusUnauthorized)
+		responseWithError(w, http.StatusBadRequest, `{"error": "Something went wrong"}`)
 		return
 	}
-	userIDint, err := strconv.Atoi(userID)
-	if err != nil {
-		body := fmt.Sprintln(err)
-		http.Error(w, body, http.StatusInternalServerError)
+	var poll *database.Poll
+	if jsonStruct.Poll != nil {
+		poll, err = newPoll(*jsonStruct.Poll)
+		if err != nil {
+			responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+			return
+		}
+	}
+	if len(jsonStruct.Attachments) > maxAttachments {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": "a chirp can have at most %d attachments"}`, maxAttachments))
 		return
 	}
-
-	decoder := json.NewDecoder(r.Body)
-	jsonStruct := database.Chirp{}
-	err = decoder.Decode(&jsonStruct)
+	decision, err := cfg.moderateChirp(jsonStruct.Body)
 	if err != nil {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(500)
-		w.Write([]byte(`{"error": "Something went wrong"}`))
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
 		return
 	}
-	filteredJson, err := filteredBody(jsonStruct)
+	warning, err := cfg.contentWarning(jsonStruct.ContentWarning, decision)
 	if err != nil {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(500)
-		errorMessage := fmt.Sprintln(err)
-		w.Write([]byte(errorMessage))
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	mentions, hashtags := extractEntities(decision.Body)
+	newChirp := database.Chirp{
+		Body:           decision.Body,
+		AuthorID:       userIDint,
+		InReplyToID:    jsonStruct.InReplyToID,
+		QuoteOfID:      jsonStruct.QuoteOfID,
+		Mentions:       mentions,
+		Hashtags:       hashtags,
+		Moderation:     moderationRecord(decision),
+		Attachments:    jsonStruct.Attachments,
+		Poll:           poll,
+		Visibility:     jsonStruct.Visibility,
+		ContentWarning: warning,
+		Sensitive:      jsonStruct.Sensitive,
+	}
+	if decision.Action == moderation.ActionHold {
+		cfg.respondWithHeldChirp(w, newChirp)
+		return
+	}
+	returnChirp, err := cfg.db.CreateChirp(newChirp)
+	if errors.Is(err, database.ErrParentNotFound) {
+		responseWithError(w, 400, `{"error": "Chirp being replied to does not exist"}`)
+		return
+	}
+	if errors.Is(err, database.ErrQuotedNotFound) {
+		responseWithError(w, 400, `{"error": "Chirp being quoted does not exist"}`)
+		return
+	}
+	if errors.Is(err, database.ErrMediaNotFound) {
+		responseWithError(w, 400, `{"error": "attachments must be your own unused uploads"}`)
+		return
+	}
+	if errors.Is(err, database.ErrUnknownVisibility) {
+		responseWithError(w, 400, `{"error": "visibility must be public, unlisted, followers or direct"}`)
 		return
 	}
-	returnChirp, err := cfg.db.CreateChirp(filteredJson.Body, userIDint)
 	if err != nil {
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(500)
 		w.Write([]byte(`{"error": "Something went wrong"}`))
 		return
 	}
-	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(201)
-	type dataReturn struct {
-		ID       int    `json:"id"`
-		Body     string `json:"body"`
-		AuthorID int    `json:"author_id"`
-	}
-	finalReturn := dataReturn{
-		ID:       returnChirp.ID,
-		Body:     returnChirp.Body,
-		AuthorID: returnChirp.AuthorID,
+	finalReturn, err := cfg.chirpResponse(returnChirp, userIDint)
+	if err != nil {
+		responseWithError(w, 500, `{"error": "Something went wrong"}`)
+		return
 	}
 	jsonReturn, err := json.Marshal(finalReturn)
 	if err != nil {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(500)
-		w.Write([]byte(`{"error": "Something went wrong"}`))
+		responseWithError(w, 500, `{"error": "Something went wrong"}`)
 		return
 	}
-	w.Write(jsonReturn)
+	responseWithJson(w, 201, jsonReturn)
 }
 
-func filteredBody(jsonStruct database.Chirp) (database.Chirp, error) {
-	if len(jsonStruct.Body) > 140 {
-		return database.Chirp{}, errors.New(`{"error": "Chirp is too long"}`)
+const maxChirpLength = 140
+
+var (
+	errChirpTooLong  = fmt.Errorf("Chirp is too long; the limit is %d characters", maxChirpLength)
+	errChirpRejected = errors.New("Chirp was rejected by moderation")
+)
+
+// moderateChirp checks a body's length and runs it through the moderation
+// pipeline. Rejected bodies come back as errChirpRejected; otherwise the
+// decision says whether to publish the (possibly masked) body or hold it.
+func (cfg *apiConfig) moderateChirp(body string) (moderation.Decision, error) {
+	if utf8.RuneCountInString(body) > maxChirpLength {
+		return moderation.Decision{}, errChirpTooLong
 	}
+	decision := cfg.moderation.Moderate(body)
+	if decision.Action == moderation.ActionReject {
+		return decision, errChirpRejected
+	}
+	return decision, nil
+}
 
-	splicedSentence := strings.Split(jsonStruct.Body, " ")
-	for i, bword := range splicedSentence {
-		word := strings.ToLower(bword)
-		if word == "kerfuffle" || word == "sharbert" || word == "fornax" {
-			splicedSentence[i] = "****"
+// moderationRecord is what gets stored with a chirp about its decision.
+func moderationRecord(decision moderation.Decision) *database.ModerationRecord {
+	record := &database.ModerationRecord{
+		Action:    string(decision.Action),
+		DecidedAt: time.Now().UTC(),
+	}
+	seen := map[string]bool{}
+	for _, match := range decision.Matches {
+		if !seen[match.Rule] {
+			seen[match.Rule] = true
+			record.Rules = append(record.Rules, match.Rule)
 		}
 	}
-	joinedSentence := strings.Join(splicedSentence, " ")
-	jsonStruct.Body = joinedSentence
-	return jsonStruct, nil
+	return record
 }
 
+// respondWithHeldChirp stores a chirp moderation wants reviewed and tells
+// the author it's pending.
+func (cfg *apiConfig) respondWithHeldChirp(w http.ResponseWriter, chirp database.Chirp) {
+	held, err := cfg.db.HoldChirp(chirp)
+	if errors.Is(err, database.ErrParentNotFound) {
+		responseWithError(w, 400, `{"error": "Chirp being replied to does not exist"}`)
+		return
+	}
+	if errors.Is(err, database.ErrQuotedNotFound) {
+		responseWithError(w, 400, `{"error": "Chirp being quoted does not exist"}`)
+		return
+	}
+	if errors.Is(err, database.ErrMediaNotFound) {
+		responseWithError(w, 400, `{"error": "attachments must be your own unused uploads"}`)
+		return
+	}
+	if errors.Is(err, database.ErrUnknownVisibility) {
+		responseWithError(w, 400, `{"error": "visibility must be public, unlisted, followers or direct"}`)
+		return
+	}
+	if err != nil {
+		responseWithError(w, 500, `{"error": "Something went wrong"}`)
+		return
+	}
+	respondWithHeld(w, held)
+}
+
+// respondWithHeld tells the author their chirp is pending review.
+func respondWithHeld(w http.ResponseWriter, held database.HeldChirp) {
+	type returnHeld struct {
+		HeldID int       `json:"held_id"`
+		Status string    `json:"status"`
+		Body   string    `json:"body"`
+		HeldAt time.Time `json:"held_at"`
+	}
+	jsonReturn, err := json.Marshal(returnHeld{
+		HeldID: held.ID,
+		Status: "held",
+		Body:   held.Chirp.Body,
+		HeldAt: held.HeldAt,
+	})
+	if err != nil {
+		responseWithError(w, 500, `{"error": "Something went wrong"}`)
+		return
+	}
+	responseWithJson(w, http.StatusAccepted, jsonReturn)
+}
+
+// handleGETValidation lists chirps a page at a time, ordered by ID or
+// order_by=created_at with sort=asc (the default) or sort=desc. Results
+// can be narrowed with author_id, since_id and max_id (exclusive IDs) and
+// created_after and created_before (exclusive RFC 3339 times). The Link
+// header carries the next and prev pages as opaque cursors.
 func (cfg *apiConfig) handleGETValidation(w http.ResponseWriter, r *http.Request) {
-	s := r.URL.Query().Get("author_id")
-	defSort := "asc"
-	reqSort := r.URL.Query().Get("sort")
-	if reqSort == "" {
-		reqSort = defSort
-	}
-	if s != "" {
-		id, err := strconv.Atoi(s)
-		if err != nil {
-			http.Error(w, "could not convert string id", 500)
-			return
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	query, cursor, err := parseChirpPageQuery(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+
+	query.ViewerID = viewerID
+	chirps, more, err := cfg.db.GetChirpPage(query)
+	if err != nil {
+		responseWithError(w, 500, `{"error": "Something went wrong"}`)
+		return
+	}
+	responses, err := cfg.chirpResponses(chirps, viewerID)
+	if err != nil {
+		responseWithError(w, 500, `{"error": "Something went wrong"}`)
+		return
+	}
+	jsonChirps, err := json.Marshal(responses)
+	if err != nil {
+		responseWithError(w, 500, `{"error": "Something went wrong"}`)
+		return
+	}
+
+	if len(chirps) > 0 {
+		links := []string{}
+		// Walking forward there is a next page if the store said so; after
+		// walking back there always is, since we came from it. The same
+		// holds the other way round for prev.
+		if more || query.Backward {
+			links = append(links, chirpPageLink(r, encodeChirpCursor(query.Descending, false, chirps[len(chirps)-1].ID), "next"))
 		}
-		authorChirps, err := cfg.db.GetAuthorChirps(id)
-		if err != nil {
-			http.Error(w, "could not get chirps for author", 500)
-			return
+		if (query.Backward && more) || (!query.Backward && cursor != "") {
+			links = append(links, chirpPageLink(r, encodeChirpCursor(query.Descending, true, chirps[0].ID), "prev"))
 		}
-		if reqSort == "desc" {
-			sort.Slice(authorChirps, func(i, j int) bool {
-				return authorChirps[i].ID > authorChirps[j].ID
-			})
-		} else {
-			sort.Slice(authorChirps, func(i, j int) bool {
-				return authorChirps[i].ID < authorChirps[j].ID
-			})
+		if len(links) > 0 {
+			w.Header().Set("Link", strings.Join(links, ", "))
 		}
-		data, err := json.Marshal(authorChirps)
+	}
+	responseWithJson(w, 200, jsonChirps)
+}
+
+// parseChirpPageQuery reads the paging and filter parameters of the chirp
+// list, folding the cursor into the ID bounds.
+func parseChirpPageQuery(r *http.Request) (database.ChirpPageQuery, string, error) {
+	params := r.URL.Query()
+	query := database.ChirpPageQuery{}
+
+	switch params.Get("sort") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return query, "", errors.New("sort must be asc or desc")
+	}
+	// Creation times never decrease with ID, so both orders are served by
+	// the same walk over IDs.
+	switch params.Get("order_by") {
+	case "", "id", "created_at":
+	default:
+		return query, "", errors.New("order_by must be id or created_at")
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		return query, "", err
+	}
+	query.Limit = limit
+
+	if s := params.Get("author_id"); s != "" {
+		query.AuthorID, err = strconv.Atoi(s)
 		if err != nil {
-			http.Error(w, "Could not marshal data", 500)
-			return
+			return query, "", errors.New("author_id must be an integer")
 		}
-		responseWithJson(w, 200, data)
-		return
+		query.ByAuthor = true
+	}
+	for name, bound := range map[string]*int{"since_id": &query.SinceID, "max_id": &query.MaxID} {
+		if s := params.Get(name); s != "" {
+			*bound, err = strconv.Atoi(s)
+			if err != nil || *bound < 0 {
+				return query, "", fmt.Errorf("%s must be a non-negative integer", name)
+			}
+		}
+	}
+	for name, bound := range map[string]*time.Time{"created_after": &query.CreatedAfter, "created_before": &query.CreatedBefore} {
+		if s := params.Get(name); s != "" {
+			*bound, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				return query, "", fmt.Errorf("%s must be an RFC 3339 time", name)
+			}
+		}
+	}
+
+	cursor := params.Get("cursor")
+	if cursor == "" {
+		return query, "", nil
+	}
+	descending, prev, id, err := decodeChirpCursor(cursor)
+	if err != nil || descending != query.Descending {
+		return query, "", errors.New("invalid cursor")
 	}
-	chirps, err := cfg.db.GetChirps()
+	query.Backward = prev
+	// Ascending next pages and descending prev pages continue above the
+	// cursor; the other two continue below it.
+	if descending == prev {
+		query.SinceID = max(query.SinceID, id)
+	} else if query.MaxID == 0 || id < query.MaxID {
+		query.MaxID = id
+	}
+	return query, cursor, nil
+}
+
+// encodeChirpCursor builds the opaque cursor for the page after (or, with
+// prev, before) the chirp with the given ID.
+func encodeChirpCursor(descending, prev bool, id int) string {
+	order, direction := "asc", "next"
+	if descending {
+		order = "desc"
+	}
+	if prev {
+		direction = "prev"
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s:%d", order, direction, id)))
+}
+
+func decodeChirpCursor(cursor string) (descending, prev bool, id int, err error) {
+	dat, err := base64.RawURLEncoding.DecodeString(cursor)
 	if err != nil {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(500)
-		w.Write([]byte(`{"error": "Something went wrong"}`))
-		return
+		return false, false, 0, err
 	}
-	if reqSort == "desc" {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].ID > chirps[j].ID
-		})
-	} else {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].ID < chirps[j].ID
-		})
+	parts := strings.Split(string(dat), ":")
+	if len(parts) != 3 || (parts[0] != "asc" && parts[0] != "desc") || (parts[1] != "next" && parts[1] != "prev") {
+		return false, false, 0, errors.New("malformed cursor")
 	}
-	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(200)
-	jsonChirps, err := json.Marshal(chirps)
+	id, err = strconv.Atoi(parts[2])
 	if err != nil {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(500)
-		w.Write([]byte(`{"error": "Something went wrong"}`))
-		return
+		return false, false, 0, err
 	}
+	return parts[0] == "desc", parts[1] == "prev", id, nil
+}
 
-	w.Write(jsonChirps)
+// chirpPageLink formats one Link header entry pointing at the same request
+// with a different cursor.
+func chirpPageLink(r *http.Request, cursor, rel string) string {
+	params := r.URL.Query()
+	params.Set("cursor", cursor)
+	return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, params.Encode(), rel)
 }
 
 func (cfg *apiConfig) handleGetSingleChirp(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
 	chirpID := r.PathValue("id")
 	chirpIdInt, err := strconv.Atoi(chirpID)
 	if err != nil {
@@ -167,37 +368,33 @@ func (cfg *apiConfig) handleGetSingleChirp(w http.ResponseWriter, r *http.Reques
 		w.Write([]byte(`{"error": "Something went wrong"}`))
 		return
 	}
-	chirp, err := cfg.db.GetSingleChirp(chirpIdInt)
+	chirp, err := cfg.db.GetVisibleChirp(chirpIdInt, viewerID)
 	if err != nil {
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(404)
 		w.Write([]byte(`{"error": "Something went wrong"}`))
 		return
 	}
-	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(200)
-	jsonChirp, err := json.Marshal(chirp)
+	response, err := cfg.chirpResponse(chirp, viewerID)
 	if err != nil {
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(500)
-		w.Write([]byte(`{"error": "Something went wrong"}`))
+		responseWithError(w, 500, `{"error": "Something went wrong"}`)
 		return
 	}
-	w.Write(jsonChirp)
-}
-
-func (cfg *apiConfig) handleDeleteChirp(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	jsonChirp, err := json.Marshal(response)
 	if err != nil {
+		responseWithError(w, 500, `{"error": "Something went wrong"}`)
 		return
 	}
-	userID, err := auth.VerifyToken(token, cfg.jwtSecret)
+	responseWithJson(w, 200, jsonChirp)
+}
+
+func (cfg *apiConfig) handleDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	claims, userIDint, err := cfg.authenticateClaims(r, auth.ScopeChirpsWrite)
 	if err != nil {
 		body := fmt.Sprintln(err)
-		http.Error(w, body, http.StatusUnauthorized)
+		http.Error(w, body, authErrorStatus(err))
 		return
 	}
-	userIDint, err := strconv.Atoi(userID)
 	chirpID := r.PathValue("id")
 	chirpIDInt, err := strconv.Atoi(chirpID)
 	if err != nil {
@@ -212,7 +409,18 @@ func (cfg *apiConfig) handleDeleteChirp(w http.ResponseWriter, r *http.Request)
 	}
 
 	if userIDint != chirp.AuthorID {
-		http.Error(w, "Not correct of Author of chirp", 403)
+		// Moderators can remove anyone's chirps, which goes in the audit
+		// log. Third-party apps can't do this on their behalf.
+		if claims.ClientID != "" || !cfg.moderators[userIDint] {
+			http.Error(w, "Not correct of Author of chirp", 403)
+			return
+		}
+		err = cfg.db.ModerateDeleteChirp(chirpIDInt, userIDint, r.URL.Query().Get("note"))
+		if err != nil {
+			http.Error(w, "Unable to Delete chirp", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(204)
 		return
 	}
 	err = cfg.db.DeleteChirp(chirpIDInt)
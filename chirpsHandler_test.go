@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+func TestChirpCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		descending bool
+		prev       bool
+		id         int
+	}{
+		{false, false, 1},
+		{false, true, 42},
+		{true, false, 7},
+		{true, true, 1 << 40},
+	}
+	for _, tc := range tests {
+		cursor := encodeChirpCursor(tc.descending, tc.prev, tc.id)
+		descending, prev, id, err := decodeChirpCursor(cursor)
+		if err != nil {
+			t.Fatalf("cursor %q: %v", cursor, err)
+		}
+		if descending != tc.descending || prev != tc.prev || id != tc.id {
+			t.Errorf("cursor %q: got (%v, %v, %d), want (%v, %v, %d)",
+				cursor, descending, prev, id, tc.descending, tc.prev, tc.id)
+		}
+	}
+}
+
+func TestDecodeChirpCursorRejects(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("asc:next:1"))},
+		{"missing part", encode("asc:next")},
+		{"extra part", encode("asc:next:1:2")},
+		{"unknown order", encode("up:next:1")},
+		{"unknown direction", encode("asc:back:1")},
+		{"non-numeric id", encode("asc:next:one")},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, _, err := decodeChirpCursor(tc.cursor)
+			if err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestParseChirpPageQueryCursor(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     string
+		descending bool
+		prev       bool
+		id         int
+		want       database.ChirpPageQuery
+	}{
+		{
+			name: "ascending next continues above",
+			id:   5,
+			want: database.ChirpPageQuery{SinceID: 5},
+		},
+		{
+			name: "ascending prev walks back below",
+			prev: true,
+			id:   5,
+			want: database.ChirpPageQuery{MaxID: 5, Backward: true},
+		},
+		{
+			name:       "descending next continues below",
+			params:     "sort=desc&",
+			descending: true,
+			id:         5,
+			want:       database.ChirpPageQuery{MaxID: 5, Descending: true},
+		},
+		{
+			name:       "descending prev walks back above",
+			params:     "sort=desc&",
+			descending: true,
+			prev:       true,
+			id:         5,
+			want:       database.ChirpPageQuery{SinceID: 5, Descending: true, Backward: true},
+		},
+		{
+			name:   "cursor doesn't widen max_id",
+			params: "max_id=3&",
+			prev:   true,
+			id:     5,
+			want:   database.ChirpPageQuery{MaxID: 3, Backward: true},
+		},
+		{
+			name:   "cursor doesn't widen since_id",
+			params: "since_id=8&",
+			id:     5,
+			want:   database.ChirpPageQuery{SinceID: 8},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cursor := encodeChirpCursor(tc.descending, tc.prev, tc.id)
+			r := httptest.NewRequest("GET", "/api/chirps?"+tc.params+"limit=10&cursor="+cursor, nil)
+			query, gotCursor, err := parseChirpPageQuery(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotCursor != cursor {
+				t.Errorf("got cursor %q, want %q", gotCursor, cursor)
+			}
+			tc.want.Limit = 10
+			if !reflect.DeepEqual(query, tc.want) {
+				t.Errorf("got %+v, want %+v", query, tc.want)
+			}
+		})
+	}
+
+	// A cursor only works with the sort order it was made for.
+	cursor := encodeChirpCursor(true, false, 5)
+	r := httptest.NewRequest("GET", "/api/chirps?sort=asc&cursor="+cursor, nil)
+	_, _, err := parseChirpPageQuery(r)
+	if err == nil {
+		t.Error("descending cursor was accepted for an ascending list")
+	}
+}
+
+func TestChirpPagesWalk(t *testing.T) {
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.CreateUser("walker@example.com", "hash", database.Profile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		_, err := db.CreateChirp(database.Chirp{Body: "step", AuthorID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fetchPage := func(params string) ([]int, bool) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/api/chirps?limit=2&"+params, nil)
+		query, _, err := parseChirpPageQuery(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chirps, more, err := db.GetChirpPage(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int{}
+		for _, chirp := range chirps {
+			ids = append(ids, chirp.ID)
+		}
+		return ids, more
+	}
+
+	for _, sort := range []string{"asc", "desc"} {
+		t.Run(sort, func(t *testing.T) {
+			descending := sort == "desc"
+			params := "sort=" + sort
+			var pages [][]int
+			ids, more := fetchPage(params)
+			pages = append(pages, ids)
+			for more {
+				cursor := encodeChirpCursor(descending, false, ids[len(ids)-1])
+				ids, more = fetchPage(params + "&cursor=" + cursor)
+				pages = append(pages, ids)
+			}
+			want := [][]int{{1, 2}, {3, 4}, {5}}
+			if descending {
+				want = [][]int{{5, 4}, {3, 2}, {1}}
+			}
+			if !reflect.DeepEqual(pages, want) {
+				t.Fatalf("walking forward: got %v, want %v", pages, want)
+			}
+
+			// Walking back from the last page retraces the same pages.
+			for i := len(pages) - 1; i > 0; i-- {
+				cursor := encodeChirpCursor(descending, true, pages[i][0])
+				ids, more = fetchPage(params + "&cursor=" + cursor)
+				if !reflect.DeepEqual(ids, pages[i-1]) {
+					t.Errorf("walking back from %v: got %v, want %v", pages[i], ids, pages[i-1])
+				}
+				if more != (i > 1) {
+					t.Errorf("walking back from %v: got more %v", pages[i], more)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+	"github.com/sutradev/chirpy/internal/moderation"
+)
+
+// schedulerInterval is the longest the scheduler sleeps between looking
+// for due drafts, in case it misses a wake-up.
+const schedulerInterval = time.Minute
+
+type draftResponse struct {
+	ID          int                  `json:"id"`
+	Body        string               `json:"body"`
+	InReplyToID int                  `json:"in_reply_to_id,omitempty"`
+	QuoteOfID   int                  `json:"quote_of_id,omitempty"`
+	Attachments []attachmentResponse `json:"attachments"`
+	Poll        *pollParams          `json:"poll,omitempty"`
+	Visibility  string               `json:"visibility"`
+	// ContentWarning is what the author wrote; warn rules may add to it
+	// when the draft is published.
+	ContentWarning string `json:"content_warning,omitempty"`
+	Sensitive      bool   `json:"sensitive"`
+	// Status is "scheduled" when PublishAt is set and "draft" otherwise.
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Error     string     `json:"error,omitempty"`
+}
+
+func (cfg *apiConfig) draftResponses(drafts []database.Draft) ([]draftResponse, error) {
+	var mediaIDs []string
+	for _, draft := range drafts {
+		mediaIDs = append(mediaIDs, draft.Attachments...)
+	}
+	media, err := cfg.db.GetMedia(mediaIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]draftResponse, 0, len(drafts))
+	for _, draft := range drafts {
+		response := draftResponse{
+			ID:             draft.ID,
+			Body:           draft.Body,
+			InReplyToID:    draft.InReplyToID,
+			QuoteOfID:      draft.QuoteOfID,
+			Attachments:    []attachmentResponse{},
+			Visibility:     visibilityName(draft.Visibility),
+			Status:         "draft",
+			ContentWarning: draft.ContentWarning,
+			Sensitive:      draft.Sensitive,
+			CreatedAt:      draft.CreatedAt,
+			UpdatedAt:      draft.UpdatedAt,
+			Error:          draft.Error,
+		}
+		for _, id := range draft.Attachments {
+			if item, ok := media[id]; ok {
+				response.Attachments = append(response.Attachments, newAttachmentResponse(item))
+			}
+		}
+		if draft.Poll != nil {
+			response.Poll = &pollParams{Options: draft.Poll.Options, DurationMinutes: draft.Poll.DurationMinutes}
+		}
+		if draft.Scheduled() {
+			publishAt := draft.PublishAt
+			response.Status = "scheduled"
+			response.PublishAt = &publishAt
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+func (cfg *apiConfig) respondWithDraft(w http.ResponseWriter, code int, draft database.Draft) {
+	responses, err := cfg.draftResponses([]database.Draft{draft})
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(responses[0])
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, code, jsonReturn)
+}
+
+// decodeDraft reads and checks the body of a draft request. Moderation is
+// left until the draft is published, but the length is checked now.
+func decodeDraft(r *http.Request, userID int) (database.Draft, error) {
+	type parameters struct {
+		Body        string      `json:"body"`
+		InReplyToID int         `json:"in_reply_to_id"`
+		QuoteOfID   int         `json:"quote_of_id"`
+		Attachments []string    `json:"attachments"`
+		Poll        *pollParams `json:"poll"`
+		Visibility  string      `json:"visibility"`
+		PublishAt   *time.Time  `json:"publish_at"`
+		// ContentWarning and Sensitive are as for new chirps.
+		ContentWarning string `json:"content_warning"`
+		Sensitive      bool   `json:"sensitive"`
+	}
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		return database.Draft{}, errors.New("Something went wrong")
+	}
+	if utf8.RuneCountInString(params.Body) > maxChirpLength {
+		return database.Draft{}, errChirpTooLong
+	}
+	if utf8.RuneCountInString(params.ContentWarning) > maxContentWarningLength {
+		return database.Draft{}, errContentWarningTooLong
+	}
+	if len(params.Attachments) > maxAttachments {
+		return database.Draft{}, fmt.Errorf("a chirp can have at most %d attachments", maxAttachments)
+	}
+	draft := database.Draft{
+		AuthorID:       userID,
+		Body:           params.Body,
+		InReplyToID:    params.InReplyToID,
+		QuoteOfID:      params.QuoteOfID,
+		Attachments:    params.Attachments,
+		Visibility:     params.Visibility,
+		ContentWarning: strings.TrimSpace(params.ContentWarning),
+		Sensitive:      params.Sensitive,
+	}
+	if params.Poll != nil {
+		_, err = newPoll(*params.Poll)
+		if err != nil {
+			return database.Draft{}, err
+		}
+		draft.Poll = &database.DraftPoll{Options: params.Poll.Options, DurationMinutes: params.Poll.DurationMinutes}
+	}
+	if params.PublishAt != nil {
+		if !params.PublishAt.After(time.Now()) {
+			return database.Draft{}, errors.New("publish_at must be in the future")
+		}
+		draft.PublishAt = params.PublishAt.UTC()
+	}
+	return draft, nil
+}
+
+// respondWithDraftError reports a draft that refers to something it
+// can't, or that couldn't be published.
+func respondWithDraftError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrDraftNotFound):
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find draft"}`)
+	case errors.Is(err, database.ErrDraftChanged):
+		responseWithError(w, http.StatusConflict, fmt.Sprintf(`{"error": %q}`, err))
+	case errors.Is(err, database.ErrAuthorSuspended):
+		responseWithError(w, http.StatusForbidden, fmt.Sprintf(`{"error": %q}`, err))
+	case errors.Is(err, database.ErrParentNotFound):
+		responseWithError(w, http.StatusBadRequest, `{"error": "Chirp being replied to does not exist"}`)
+	case errors.Is(err, database.ErrQuotedNotFound):
+		responseWithError(w, http.StatusBadRequest, `{"error": "Chirp being quoted does not exist"}`)
+	case errors.Is(err, database.ErrMediaNotFound):
+		responseWithError(w, http.StatusBadRequest, `{"error": "attachments must be your own unused uploads"}`)
+	case errors.Is(err, database.ErrUnknownVisibility):
+		responseWithError(w, http.StatusBadRequest, `{"error": "visibility must be public, unlisted, followers or direct"}`)
+	case errors.Is(err, errChirpTooLong), errors.Is(err, errChirpRejected),
+		errors.Is(err, errContentWarningTooLong), errors.Is(err, errContentWarningRejected):
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+	default:
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+	}
+}
+
+// handleGETDrafts lists the caller's drafts and scheduled chirps.
+func (cfg *apiConfig) handleGETDrafts(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	drafts, err := cfg.db.GetDrafts(userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not list drafts"}`)
+		return
+	}
+	responses, err := cfg.draftResponses(drafts)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(responses)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handlePOSTDraft saves a new draft, scheduled if publish_at is given.
+func (cfg *apiConfig) handlePOSTDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	draft, err := decodeDraft(r, userID)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	draft, err = cfg.db.CreateDraft(draft)
+	if err != nil {
+		respondWithDraftError(w, err)
+		return
+	}
+	if draft.Scheduled() {
+		cfg.wakeScheduler()
+	}
+	cfg.respondWithDraft(w, http.StatusCreated, draft)
+}
+
+func (cfg *apiConfig) handleGETDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	draftID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid draft id"}`)
+		return
+	}
+	draft, err := cfg.db.GetDraft(draftID, userID)
+	if err != nil {
+		respondWithDraftError(w, err)
+		return
+	}
+	cfg.respondWithDraft(w, http.StatusOK, draft)
+}
+
+// handlePUTDraft replaces a draft. Leaving out publish_at turns a
+// scheduled chirp back into a plain draft.
+func (cfg *apiConfig) handlePUTDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	draftID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid draft id"}`)
+		return
+	}
+	draft, err := decodeDraft(r, userID)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	draft.ID = draftID
+	draft, err = cfg.db.UpdateDraft(draft)
+	if err != nil {
+		respondWithDraftError(w, err)
+		return
+	}
+	cfg.wakeScheduler()
+	cfg.respondWithDraft(w, http.StatusOK, draft)
+}
+
+func (cfg *apiConfig) handleDeleteDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	draftID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid draft id"}`)
+		return
+	}
+	err = cfg.db.DeleteDraft(draftID, userID)
+	if err != nil {
+		respondWithDraftError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePOSTDraftPublish publishes a draft straight away, whether or not
+// it was scheduled. Like a new chirp, it may be held for review instead.
+func (cfg *apiConfig) handlePOSTDraftPublish(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	draftID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid draft id"}`)
+		return
+	}
+	draft, err := cfg.db.GetDraft(draftID, userID)
+	if err != nil {
+		respondWithDraftError(w, err)
+		return
+	}
+	chirp, held, err := cfg.publishDraft(draft)
+	if err != nil {
+		respondWithDraftError(w, err)
+		return
+	}
+	if held != nil {
+		respondWithHeld(w, *held)
+		return
+	}
+
+	response, err := cfg.chirpResponse(chirp, userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(response)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusCreated, jsonReturn)
+}
+
+// publishDraft turns a draft into a chirp, running it through moderation
+// as if it had just been posted. If moderation holds it, the held chirp is
+// returned instead.
+func (cfg *apiConfig) publishDraft(draft database.Draft) (database.Chirp, *database.HeldChirp, error) {
+	decision, err := cfg.moderateChirp(draft.Body)
+	if err != nil {
+		return database.Chirp{}, nil, err
+	}
+	warning, err := cfg.contentWarning(draft.ContentWarning, decision)
+	if err != nil {
+		return database.Chirp{}, nil, err
+	}
+	mentions, hashtags := extractEntities(decision.Body)
+	chirp := database.Chirp{
+		Body:           decision.Body,
+		AuthorID:       draft.AuthorID,
+		InReplyToID:    draft.InReplyToID,
+		QuoteOfID:      draft.QuoteOfID,
+		Mentions:       mentions,
+		Hashtags:       hashtags,
+		Moderation:     moderationRecord(decision),
+		Attachments:    draft.Attachments,
+		Visibility:     draft.Visibility,
+		ContentWarning: warning,
+		Sensitive:      draft.Sensitive,
+	}
+	if draft.Poll != nil {
+		// The poll was checked when the draft was saved; this just starts
+		// its clock.
+		chirp.Poll, err = newPoll(pollParams{Options: draft.Poll.Options, DurationMinutes: draft.Poll.DurationMinutes})
+		if err != nil {
+			return database.Chirp{}, nil, err
+		}
+	}
+
+	if decision.Action == moderation.ActionHold {
+		held, err := cfg.db.HoldDraft(draft, chirp)
+		if err != nil {
+			return database.Chirp{}, nil, err
+		}
+		return database.Chirp{}, &held, nil
+	}
+	chirp, err = cfg.db.PublishDraft(draft, chirp)
+	if err != nil {
+		return database.Chirp{}, nil, err
+	}
+	return chirp, nil, nil
+}
+
+// wakeScheduler tells the scheduler the schedule changed, so it can
+// recheck when the next draft is due.
+func (cfg *apiConfig) wakeScheduler() {
+	select {
+	case cfg.scheduleChanged <- struct{}{}:
+	default:
+	}
+}
+
+// runScheduler publishes scheduled drafts as they come due. Schedules
+// live in the database, so anything that came due while the server was
+// down is published as soon as it starts.
+func (cfg *apiConfig) runScheduler(ctx context.Context) {
+	for {
+		cfg.publishDueDrafts()
+
+		wait := schedulerInterval
+		next, ok, err := cfg.db.NextPublishAt()
+		if err != nil {
+			log.Printf("could not read the schedule: %v", err)
+		} else if ok {
+			wait = min(wait, max(time.Until(next), 0))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-cfg.scheduleChanged:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) publishDueDrafts() {
+	drafts, err := cfg.db.GetDueDrafts(time.Now())
+	if err != nil {
+		log.Printf("could not load scheduled chirps: %v", err)
+		return
+	}
+	for _, draft := range drafts {
+		_, _, err := cfg.publishDraft(draft)
+		if err == nil || errors.Is(err, database.ErrDraftChanged) {
+			continue
+		}
+		if !draftProblem(err) {
+			// Probably temporary, so try again next time round.
+			log.Printf("could not publish draft %d: %v", draft.ID, err)
+			continue
+		}
+		// The author has to fix these, so stop retrying and tell them.
+		err = cfg.db.FailDraft(draft, err.Error())
+		if err != nil && !errors.Is(err, database.ErrDraftChanged) {
+			log.Printf("could not unschedule draft %d: %v", draft.ID, err)
+		}
+	}
+}
+
+// draftProblem reports whether a draft couldn't be published because of
+// something in it or about its author, rather than a server error.
+func draftProblem(err error) bool {
+	for _, target := range []error{
+		errChirpTooLong,
+		errChirpRejected,
+		errContentWarningTooLong,
+		errContentWarningRejected,
+		database.ErrParentNotFound,
+		database.ErrQuotedNotFound,
+		database.ErrMediaNotFound,
+		database.ErrAuthorSuspended,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
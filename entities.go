@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+const maxHashtagLength = 100
+
+// extractEntities finds the @mentions and #hashtags in a chirp body. A
+// sigil only starts an entity at the beginning of a word, so email
+// addresses and things like "C#" are left alone. Mentions carry just the
+// handle; the database resolves them to users.
+func extractEntities(body string) ([]database.Mention, []database.Hashtag) {
+	runes := []rune(body)
+	mentions := []database.Mention{}
+	hashtags := []database.Hashtag{}
+	for i := 0; i < len(runes); i++ {
+		sigil := runes[i]
+		if sigil != '@' && sigil != '#' {
+			continue
+		}
+		if i > 0 && isWordRune(runes[i-1]) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		word := string(runes[i+1 : end])
+
+		switch sigil {
+		case '@':
+			if handlePattern.MatchString(word) && !numericPattern.MatchString(word) {
+				mentions = append(mentions, database.Mention{Handle: word, Start: i, End: end})
+			}
+		case '#':
+			if word != "" && end-i-1 <= maxHashtagLength && !numericPattern.MatchString(word) {
+				hashtags = append(hashtags, database.Hashtag{Tag: strings.ToLower(word), Start: i, End: end})
+			}
+		}
+		i = end - 1
+	}
+	return mentions, hashtags
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
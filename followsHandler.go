@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// lookupUser resolves a path reference to a user: a numeric user ID, or a
+// handle with or without the leading @.
+func (cfg *apiConfig) lookupUser(ref string) (database.User, error) {
+	id, err := strconv.Atoi(ref)
+	if err == nil {
+		return cfg.db.GetUser(id)
+	}
+	return cfg.db.GetUserByHandle(strings.TrimPrefix(ref, "@"))
+}
+
+// parseLimit reads the limit query parameter, defaulting and capping it.
+func parseLimit(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return limit, nil
+}
+
+// parseOffset reads the offset query parameter for limit and offset
+// pagination.
+func parseOffset(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("offset")
+	if s == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(s)
+	if err != nil || offset < 0 {
+		return 0, errors.New("offset must be a non-negative integer")
+	}
+	return offset, nil
+}
+
+// page cuts one page out of a list for limit and offset pagination.
+func page[T any](items []T, offset, limit int) []T {
+	if offset > len(items) {
+		offset = len(items)
+	}
+	items = items[offset:]
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+func (cfg *apiConfig) handlePOSTFollow(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeFollowsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	followee, err := cfg.lookupUser(r.PathValue("user"))
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+	if followee.ID == userID {
+		responseWithError(w, http.StatusBadRequest, `{"error": "you can't follow yourself"}`)
+		return
+	}
+	err = cfg.db.Follow(userID, followee.ID)
+	if errors.Is(err, database.ErrBlocked) {
+		responseWithError(w, http.StatusForbidden, `{"error": "you can't follow this user"}`)
+		return
+	}
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not follow user"}`)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) handleDeleteFollow(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeFollowsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	followee, err := cfg.lookupUser(r.PathValue("user"))
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+	err = cfg.db.Unfollow(userID, followee.ID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not unfollow user"}`)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) handleGETFollowers(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithFollowList(w, r, cfg.db.GetFollowers)
+}
+
+func (cfg *apiConfig) handleGETFollowing(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithFollowList(w, r, cfg.db.GetFollowing)
+}
+
+// respondWithFollowList writes one page of a follower or following list as
+// public profiles. Pages are selected with limit and offset.
+func (cfg *apiConfig) respondWithFollowList(w http.ResponseWriter, r *http.Request, list func(int) ([]database.FollowEdge, error)) {
+	user, err := cfg.lookupUser(r.PathValue("user"))
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+	cfg.respondWithUserList(w, r, user.ID, list)
+}
+
+// respondWithUserList writes one page of one of a user's lists of other
+// users as public profiles.
+func (cfg *apiConfig) respondWithUserList(w http.ResponseWriter, r *http.Request, userID int, list func(int) ([]database.FollowEdge, error)) {
+	limit, err := parseLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	offset, err := parseOffset(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+
+	edges, err := list(userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not list users"}`)
+		return
+	}
+	total := len(edges)
+	edges = page(edges, offset, limit)
+
+	ids := make([]int, 0, len(edges))
+	for _, edge := range edges {
+		ids = append(ids, edge.UserID)
+	}
+	users, err := cfg.db.GetUsers(ids)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not list users"}`)
+		return
+	}
+
+	type followEntry struct {
+		publicProfile
+		Since string `json:"since"`
+	}
+	type returnList struct {
+		Total int           `json:"total"`
+		Users []followEntry `json:"users"`
+	}
+	result := returnList{
+		Total: total,
+		Users: make([]followEntry, 0, len(edges)),
+	}
+	for _, edge := range edges {
+		followed, ok := users[edge.UserID]
+		if !ok {
+			continue
+		}
+		result.Users = append(result.Users, followEntry{
+			publicProfile: newPublicProfile(followed),
+			Since:         edge.Since.Format(time.RFC3339),
+		})
+	}
+
+	jsonReturn, err := json.Marshal(result)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handleGETTimeline returns chirps from the accounts the caller follows,
+// newest first. Older pages are fetched by passing the last ID seen as
+// max_id.
+func (cfg *apiConfig) handleGETTimeline(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	maxID, err := parseMaxID(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+
+	chirps, err := cfg.db.GetTimeline(userID, maxID, limit)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not load timeline"}`)
+		return
+	}
+	responses, err := cfg.chirpResponses(chirps, userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not load timeline"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(responses)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
@@ -7,3 +7,7 @@ require golang.org/x/crypto v0.26.0 // direct
 require github.com/joho/godotenv v1.5.1
 
 require github.com/golang-jwt/jwt/v5 v5.2.1
+
+require golang.org/x/text v0.17.0
+
+require golang.org/x/sys v0.23.0 // indirect
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+	defaultTrendingLimit  = 10
+)
+
+// parseMaxID reads the max_id cursor used by newest-first chirp lists.
+func parseMaxID(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("max_id")
+	if s == "" {
+		return 0, nil
+	}
+	maxID, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.New("max_id must be an integer")
+	}
+	return maxID, nil
+}
+
+// handleGETHashtag lists chirps using a hashtag, newest first. Older pages
+// are fetched by passing the last ID seen as max_id.
+func (cfg *apiConfig) handleGETHashtag(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	tag := strings.TrimPrefix(r.PathValue("tag"), "#")
+	cfg.respondWithChirpPage(w, r, viewerID, func(maxID, limit int) ([]database.Chirp, error) {
+		return cfg.db.GetHashtagChirps(tag, maxID, limit, viewerID)
+	})
+}
+
+// handleGETMentions lists chirps mentioning the caller, newest first.
+func (cfg *apiConfig) handleGETMentions(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	cfg.respondWithChirpPage(w, r, userID, func(maxID, limit int) ([]database.Chirp, error) {
+		return cfg.db.GetMentions(userID, maxID, limit)
+	})
+}
+
+// respondWithChirpPage writes one newest-first page of chirps selected with
+// limit and max_id.
+func (cfg *apiConfig) respondWithChirpPage(w http.ResponseWriter, r *http.Request, viewerID int, fetch func(maxID, limit int) ([]database.Chirp, error)) {
+	limit, err := parseLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	maxID, err := parseMaxID(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+
+	chirps, err := fetch(maxID, limit)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not load chirps"}`)
+		return
+	}
+	responses, err := cfg.chirpResponses(chirps, viewerID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not load chirps"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(responses)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handleGETTrendingHashtags returns the most used hashtags over a sliding
+// window ending now. The window is a duration such as 1h or 24h.
+func (cfg *apiConfig) handleGETTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	window := defaultTrendingWindow
+	if s := r.URL.Query().Get("window"); s != "" {
+		var err error
+		window, err = time.ParseDuration(s)
+		if err != nil || window <= 0 {
+			responseWithError(w, http.StatusBadRequest, `{"error": "window must be a positive duration such as 1h"}`)
+			return
+		}
+		if window > maxTrendingWindow {
+			window = maxTrendingWindow
+		}
+	}
+	limit := defaultTrendingLimit
+	if r.URL.Query().Get("limit") != "" {
+		var err error
+		limit, err = parseLimit(r)
+		if err != nil {
+			responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+			return
+		}
+	}
+
+	trending, err := cfg.db.TrendingHashtags(time.Now().UTC().Add(-window), limit)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not load trending hashtags"}`)
+		return
+	}
+
+	type returnTrending struct {
+		Window   string                     `json:"window"`
+		Hashtags []database.TrendingHashtag `json:"hashtags"`
+	}
+	jsonReturn, err := json.Marshal(returnTrending{
+		Window:   window.String(),
+		Hashtags: trending,
+	})
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
@@ -26,40 +26,21 @@ func MakeToken(secret string, expires int, userID int) (string, string, error) {
 		return "", "", err
 	}
 
-	bytes := make([]byte, 32)
-	_, err = rand.Read(bytes)
+	refreshToken, err := MakeRandomToken()
 	if err != nil {
 		return "", "", err
 	}
-	refreshToken := hex.EncodeToString(bytes)
 
 	return signedToken, refreshToken, nil
 }
 
-func VerifyToken(tokenString, tokenSecret string) (string, error) {
-	claimsStruct := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
-	)
-	if err != nil {
-		return "", err
-	}
-	userIDString, err := token.Claims.GetSubject()
-	if err != nil {
-		return "", err
-	}
-
-	issuer, err := token.Claims.GetIssuer()
+func MakeRandomToken() (string, error) {
+	bytes := make([]byte, 32)
+	_, err := rand.Read(bytes)
 	if err != nil {
 		return "", err
 	}
-	if issuer != string("chirpy") {
-		return "", errors.New("invalid issuer")
-	}
-
-	return userIDString, nil
+	return hex.EncodeToString(bytes), nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
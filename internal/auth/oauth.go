@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeUsersWrite   = "users:write"
+	ScopeFollowsWrite = "follows:write"
+	ScopeLikesWrite   = "likes:write"
+	// Bookmarks are private, so reading them has its own scope.
+	ScopeBookmarksRead  = "bookmarks:read"
+	ScopeBookmarksWrite = "bookmarks:write"
+	ScopeListsWrite     = "lists:write"
+)
+
+// Scopes lists every scope a third-party client may request, with the
+// wording shown to users on the consent page.
+var Scopes = map[string]string{
+	ScopeChirpsRead:     "See chirps available to your account",
+	ScopeChirpsWrite:    "Post and delete chirps as you",
+	ScopeUsersWrite:     "Change your email address and password",
+	ScopeFollowsWrite:   "Follow and unfollow accounts as you",
+	ScopeLikesWrite:     "Like and unlike chirps as you",
+	ScopeBookmarksRead:  "See your bookmarks",
+	ScopeBookmarksWrite: "Add and remove bookmarks",
+	ScopeListsWrite:     "Create, change and follow lists as you",
+}
+
+func AllScopes() []string {
+	scopes := make([]string, 0, len(Scopes))
+	for scope := range Scopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+var ErrInsufficientScope = errors.New("token does not grant the required scope")
+
+// AccessClaims are the claims carried by an access token. First-party
+// tokens from MakeToken have no ClientID and are not limited by scope.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+// MakeScopedToken issues an access token for a third-party client limited to
+// the given space-separated scope, plus a refresh token.
+func MakeScopedToken(secret string, expires int, userID int, clientID string, scope string) (string, string, error) {
+	jti, err := MakeRandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   "chirpy",
+			IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(
+				time.Now().UTC().Add(time.Duration(expires * int(time.Minute))),
+			),
+			Subject: fmt.Sprintf("%d", userID),
+			ID:      jti,
+		},
+		ClientID: clientID,
+		Scope:    scope,
+	})
+	signedToken, err := token.SignedString([]byte(secret))
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := MakeRandomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	return signedToken, refreshToken, nil
+}
+
+func VerifyAccessToken(tokenString, tokenSecret string) (AccessClaims, error) {
+	claims := AccessClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&claims,
+		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+	)
+	if err != nil {
+		return AccessClaims{}, err
+	}
+	if claims.Issuer != "chirpy" {
+		return AccessClaims{}, errors.New("invalid issuer")
+	}
+	return claims, nil
+}
+
+func (c AccessClaims) HasScope(scope string) bool {
+	if c.ClientID == "" {
+		return true
+	}
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScope splits a requested scope string and rejects unknown or
+// disallowed scopes. An empty request is granted every allowed scope.
+func ParseScope(requested string, allowed []string) ([]string, error) {
+	allowedSet := map[string]bool{}
+	for _, s := range allowed {
+		allowedSet[s] = true
+	}
+	if strings.TrimSpace(requested) == "" {
+		return allowed, nil
+	}
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, s := range strings.Fields(requested) {
+		if _, ok := Scopes[s]; !ok || !allowedSet[s] {
+			return nil, fmt.Errorf("invalid scope %q", s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// VerifyPKCE checks a code_verifier against the stored code_challenge as
+// described in RFC 7636. Only the S256 method is accepted.
+func VerifyPKCE(verifier, challenge, method string) bool {
+	if method != "S256" || len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	computed := PKCEChallenge(verifier)
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// HashSecret digests a high-entropy secret such as a client secret or an
+// authorization code for storage.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// The example from RFC 7636, appendix B.
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		method    string
+		want      bool
+	}{
+		{"matching verifier", verifier, challenge, "S256", true},
+		{"wrong verifier", strings.Replace(verifier, "d", "e", 1), challenge, "S256", false},
+		{"plain method", challenge, challenge, "plain", false},
+		{"missing method", verifier, challenge, "", false},
+		{"verifier too short", verifier[:42], challenge, "S256", false},
+		{"verifier too long", strings.Repeat("a", 129), challenge, "S256", false},
+		{"empty challenge", verifier, "", "S256", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := VerifyPKCE(tc.verifier, tc.challenge, tc.method)
+			if got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	allowed := []string{ScopeChirpsRead, ScopeChirpsWrite}
+
+	tests := []struct {
+		name      string
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{"empty grants every allowed scope", "  ", "chirps:read chirps:write", false},
+		{"subset", "chirps:read", "chirps:read", false},
+		{"duplicates collapse", "chirps:read  chirps:read", "chirps:read", false},
+		{"known but not allowed", "users:write", "", true},
+		{"unknown", "chirps:read admin", "", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseScope(tc.requested, allowed)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tc.wantErr)
+			}
+			if strings.Join(got, " ") != tc.want {
+				t.Errorf("got %q, want %q", strings.Join(got, " "), tc.want)
+			}
+		})
+	}
+}
+
+func TestAccessClaimsHasScope(t *testing.T) {
+	firstParty := AccessClaims{}
+	if !firstParty.HasScope(ScopeUsersWrite) {
+		t.Error("first-party token was limited by scope")
+	}
+	client := AccessClaims{ClientID: "client", Scope: "chirps:read"}
+	if !client.HasScope(ScopeChirpsRead) {
+		t.Error("client token lacks a granted scope")
+	}
+	if client.HasScope(ScopeChirpsWrite) {
+		t.Error("client token has a scope it wasn't granted")
+	}
+}
+
+func TestScopedTokenRoundTrip(t *testing.T) {
+	token, refresh, err := MakeScopedToken("secret", 5, 7, "client", "chirps:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refresh == "" {
+		t.Error("got no refresh token")
+	}
+	claims, err := VerifyAccessToken(token, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "7" || claims.ClientID != "client" || claims.Scope != "chirps:read" || claims.ID == "" {
+		t.Errorf("got claims %+v", claims)
+	}
+	_, err = VerifyAccessToken(token, "other secret")
+	if err == nil {
+		t.Error("token verified with the wrong secret")
+	}
+}
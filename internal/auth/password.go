@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var (
+	ErrPasswordMismatch  = errors.New("password does not match")
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+	ErrPasswordTooShort  = errors.New("password is too short")
+	ErrPasswordBreached  = errors.New("password appears in a breached password list")
+)
+
+// PasswordHasher hashes new passwords and verifies stored ones.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Compare(hash, password string) error
+	NeedsRehash(hash string) bool
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h BcryptHasher) Compare(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	if identifyHash(hash) != AlgorithmBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost < h.Cost
+}
+
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idHasher uses OWASP's minimum Argon2id parameters: 19 MiB
+// of memory, 2 passes and one lane. Every concurrent login holds that much
+// memory, so larger settings let a burst of logins exhaust the server.
+func DefaultArgon2idHasher() Argon2idHasher {
+	return Argon2idHasher{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Memory,
+		h.Iterations,
+		h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Compare(hash, password string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey(
+		[]byte(password),
+		salt,
+		params.Iterations,
+		params.Memory,
+		params.Parallelism,
+		uint32(len(key)),
+	)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory < h.Memory ||
+		params.Iterations < h.Iterations ||
+		params.Parallelism != h.Parallelism ||
+		uint32(len(salt)) < h.SaltLength ||
+		uint32(len(key)) < h.KeyLength
+}
+
+func decodeArgon2id(hash string) (Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return Argon2idHasher{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, err
+	}
+	if version != argon2.Version {
+		return Argon2idHasher{}, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	params := Argon2idHasher{}
+	_, err = fmt.Sscanf(
+		parts[3],
+		"m=%d,t=%d,p=%d",
+		&params.Memory,
+		&params.Iterations,
+		&params.Parallelism,
+	)
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, err
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+func identifyHash(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return AlgorithmArgon2id
+	case strings.HasPrefix(hash, "$2a$"),
+		strings.HasPrefix(hash, "$2b$"),
+		strings.HasPrefix(hash, "$2y$"):
+		return AlgorithmBcrypt
+	}
+	return ""
+}
+
+// Passwords hashes with the preferred algorithm but verifies any stored
+// hash it can identify, flagging hashes made with another algorithm or
+// weaker parameters for rehashing.
+type Passwords struct {
+	Preferred string
+	Argon2id  Argon2idHasher
+	Bcrypt    BcryptHasher
+}
+
+func NewPasswords(algorithm string, bcryptCost int) (Passwords, error) {
+	if algorithm == "" {
+		algorithm = AlgorithmArgon2id
+	}
+	if algorithm != AlgorithmArgon2id && algorithm != AlgorithmBcrypt {
+		return Passwords{}, fmt.Errorf("unsupported password algorithm %q", algorithm)
+	}
+	if bcryptCost == 0 {
+		bcryptCost = bcrypt.DefaultCost
+	}
+	if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+		return Passwords{}, fmt.Errorf("bcrypt cost %d out of range", bcryptCost)
+	}
+	return Passwords{
+		Preferred: algorithm,
+		Argon2id:  DefaultArgon2idHasher(),
+		Bcrypt:    BcryptHasher{Cost: bcryptCost},
+	}, nil
+}
+
+func (p Passwords) hasherFor(algorithm string) (PasswordHasher, error) {
+	switch algorithm {
+	case AlgorithmArgon2id:
+		return p.Argon2id, nil
+	case AlgorithmBcrypt:
+		return p.Bcrypt, nil
+	}
+	return nil, ErrUnknownHashFormat
+}
+
+func (p Passwords) Hash(password string) (string, error) {
+	hasher, err := p.hasherFor(p.Preferred)
+	if err != nil {
+		return "", err
+	}
+	return hasher.Hash(password)
+}
+
+func (p Passwords) Compare(hash, password string) error {
+	hasher, err := p.hasherFor(identifyHash(hash))
+	if err != nil {
+		return err
+	}
+	return hasher.Compare(hash, password)
+}
+
+func (p Passwords) NeedsRehash(hash string) bool {
+	if identifyHash(hash) != p.Preferred {
+		return true
+	}
+	hasher, err := p.hasherFor(p.Preferred)
+	if err != nil {
+		return true
+	}
+	return hasher.NeedsRehash(hash)
+}
+
+// PasswordPolicy rejects passwords that are too short or that appear in a
+// local breached-password list. The list holds one entry per line, either
+// the plain password or its hex SHA-1 digest as published by HIBP.
+type PasswordPolicy struct {
+	MinLength int
+	breached  map[string]struct{}
+}
+
+func LoadPasswordPolicy(minLength int, breachedPath string) (PasswordPolicy, error) {
+	policy := PasswordPolicy{
+		MinLength: minLength,
+		breached:  map[string]struct{}{},
+	}
+	if breachedPath == "" {
+		return policy, nil
+	}
+
+	file, err := os.Open(breachedPath)
+	if err != nil {
+		return PasswordPolicy{}, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// HIBP range files append ":count" to each digest.
+		if digest, _, found := strings.Cut(line, ":"); found && isSHA1Hex(digest) {
+			line = digest
+		}
+		if isSHA1Hex(line) {
+			line = strings.ToUpper(line)
+		}
+		policy.breached[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return PasswordPolicy{}, err
+	}
+	return policy, nil
+}
+
+func (p PasswordPolicy) Validate(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return ErrPasswordTooShort
+	}
+	if _, ok := p.breached[password]; ok {
+		return ErrPasswordBreached
+	}
+	digest := sha1.Sum([]byte(password))
+	if _, ok := p.breached[strings.ToUpper(hex.EncodeToString(digest[:]))]; ok {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
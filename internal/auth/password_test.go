@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testPasswords(t *testing.T, algorithm string) Passwords {
+	t.Helper()
+	passwords, err := NewPasswords(algorithm, bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the tests fast; the parameters are recorded in each hash.
+	passwords.Argon2id.Memory = 1024
+	passwords.Argon2id.Iterations = 1
+	return passwords
+}
+
+func TestPasswordsHashAndCompare(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmArgon2id, AlgorithmBcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			passwords := testPasswords(t, algorithm)
+			hash, err := passwords.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identifyHash(hash) != algorithm {
+				t.Fatalf("got hash %q, want an %s hash", hash, algorithm)
+			}
+			err = passwords.Compare(hash, "correct horse")
+			if err != nil {
+				t.Errorf("matching password: got error %v", err)
+			}
+			err = passwords.Compare(hash, "battery staple")
+			if !errors.Is(err, ErrPasswordMismatch) {
+				t.Errorf("wrong password: got error %v, want %v", err, ErrPasswordMismatch)
+			}
+			if passwords.NeedsRehash(hash) {
+				t.Error("fresh hash was flagged for rehashing")
+			}
+		})
+	}
+}
+
+func TestPasswordsCompareUnknownFormat(t *testing.T) {
+	passwords := testPasswords(t, AlgorithmArgon2id)
+	tests := []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=1024,t=1$c2FsdA$a2V5",
+		"$argon2i$v=19$m=1024,t=1,p=4$c2FsdA$a2V5",
+	}
+	for _, hash := range tests {
+		err := passwords.Compare(hash, "anything")
+		if err == nil || errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("hash %q: got error %v, want a format error", hash, err)
+		}
+	}
+}
+
+func TestPasswordsNeedsRehash(t *testing.T) {
+	argon := testPasswords(t, AlgorithmArgon2id)
+	bcryptPasswords := testPasswords(t, AlgorithmBcrypt)
+
+	bcryptHash, err := bcryptPasswords.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHash, err := argon.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stronger := argon
+	stronger.Argon2id.Memory *= 2
+	costlier := bcryptPasswords
+	costlier.Bcrypt.Cost++
+
+	tests := []struct {
+		name      string
+		passwords Passwords
+		hash      string
+		want      bool
+	}{
+		{"same argon2id parameters", argon, argonHash, false},
+		{"same bcrypt cost", bcryptPasswords, bcryptHash, false},
+		{"bcrypt hash when argon2id is preferred", argon, bcryptHash, true},
+		{"argon2id hash when bcrypt is preferred", bcryptPasswords, argonHash, true},
+		{"weaker argon2id parameters", stronger, argonHash, true},
+		{"lower bcrypt cost", costlier, bcryptHash, true},
+		{"unknown format", argon, "plaintext", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.passwords.NeedsRehash(tc.hash)
+			if got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// A hash flagged for rehashing still verifies, so users can log in
+	// and have it upgraded.
+	err = argon.Compare(bcryptHash, "password")
+	if err != nil {
+		t.Errorf("bcrypt hash no longer verifies: %v", err)
+	}
+}
+
+func TestNewPasswordsRejects(t *testing.T) {
+	tests := []struct {
+		name       string
+		algorithm  string
+		bcryptCost int
+	}{
+		{"unknown algorithm", "scrypt", 0},
+		{"cost too low", AlgorithmBcrypt, bcrypt.MinCost - 1},
+		{"cost too high", AlgorithmBcrypt, bcrypt.MaxCost + 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewPasswords(tc.algorithm, tc.bcryptCost)
+			if err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+
+	passwords, err := NewPasswords("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passwords.Preferred != AlgorithmArgon2id || passwords.Bcrypt.Cost != bcrypt.DefaultCost {
+		t.Errorf("got defaults %q and cost %d", passwords.Preferred, passwords.Bcrypt.Cost)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	list := strings.Join([]string{
+		"# common passwords",
+		"password123",
+		"",
+		// SHA-1 of "letmein123", lower case, in HIBP range format.
+		"e286977b13f1a89e20d0459207545d15fe1eba08:42",
+	}, "\n")
+	err := os.WriteFile(path, []byte(list), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPasswordPolicy(8, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		want     error
+	}{
+		{"short", ErrPasswordTooShort},
+		{"ünïcödé", ErrPasswordTooShort},
+		{"ünïcödé!", nil},
+		{"password123", ErrPasswordBreached},
+		{"letmein123", ErrPasswordBreached},
+		{"# common passwords", nil},
+		{"a fine passphrase", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.password, func(t *testing.T) {
+			err := policy.Validate(tc.password)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("got error %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	_, err = LoadPasswordPolicy(8, filepath.Join(t.TempDir(), "missing.txt"))
+	if err == nil {
+		t.Error("missing breached list: got no error")
+	}
+}
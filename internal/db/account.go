@@ -0,0 +1,324 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// DeletedAuthorID is the author of chirps kept after their author deleted
+// their account.
+const DeletedAuthorID = 0
+
+const (
+	RetainChirpsDelete    = "delete"
+	RetainChirpsAnonymize = "anonymize"
+)
+
+// UserExport is everything stored about a user, minus secrets such as the
+// password hash and tokens.
+type UserExport struct {
+	ExportedAt  time.Time   `json:"exported_at"`
+	ID          int         `json:"id"`
+	Email       string      `json:"email"`
+	IsChirpyRed bool        `json:"is_chirpy_red"`
+	HasPassword bool        `json:"has_password"`
+	Profile     Profile     `json:"profile"`
+	Preferences Preferences `json:"preferences"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	Chirps      []Chirp     `json:"chirps"`
+	HeldChirps  []HeldChirp `json:"held_chirps"`
+	Drafts      []Draft     `json:"drafts"`
+	Media       []Media     `json:"media"`
+	// PollVotes maps chirp IDs to the option voted for.
+	PollVotes      map[int]int     `json:"poll_votes"`
+	LinkedAccounts []ExportedLink  `json:"linked_accounts"`
+	AuthorizedApps []ExportedGrant `json:"authorized_apps"`
+	RegisteredApps []ExportedApp   `json:"registered_apps"`
+	Blocked        []FollowEdge    `json:"blocked"`
+	Muted          []FollowEdge    `json:"muted"`
+	// Bookmarks are chirp IDs with when they were bookmarked, newest
+	// first.
+	Bookmarks     []ExportedBookmark   `json:"bookmarks"`
+	Lists         []ExportedList       `json:"lists"`
+	FollowedLists []ExportedListFollow `json:"followed_lists"`
+}
+
+type ExportedBookmark struct {
+	ChirpID      int       `json:"chirp_id"`
+	BookmarkedAt time.Time `json:"bookmarked_at"`
+}
+
+type ExportedList struct {
+	List
+	Members []FollowEdge `json:"members"`
+}
+
+type ExportedListFollow struct {
+	ListID int       `json:"list_id"`
+	Since  time.Time `json:"since"`
+}
+
+type ExportedLink struct {
+	Issuer   string    `json:"issuer"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email"`
+	DateMade time.Time `json:"date_made"`
+}
+
+type ExportedGrant struct {
+	ClientID       string    `json:"client_id"`
+	ClientName     string    `json:"client_name"`
+	Scope          string    `json:"scope"`
+	DateMade       time.Time `json:"date_made"`
+	ExpirationDate time.Time `json:"expiration_date"`
+}
+
+type ExportedApp struct {
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	DateMade     time.Time `json:"date_made"`
+}
+
+// DeleteUser removes the user along with their sessions, linked identities,
+// OAuth grants and registered OAuth clients. Their chirps are deleted or
+// reattributed to DeletedAuthorID depending on retainChirps. Everything
+// they uploaded is removed too, even from retained chirps, and returned so
+// the files can be deleted.
+func (db *DB) DeleteUser(id int, retainChirps string) ([]Media, error) {
+	if retainChirps != RetainChirpsDelete && retainChirps != RetainChirpsAnonymize {
+		return nil, errors.New("unknown chirp retention policy")
+	}
+	removed := []Media{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[id]; !ok {
+			return errors.New("User not found")
+		}
+
+		for chirpID, chirp := range dbStructure.Chirps {
+			if chirp.AuthorID != id {
+				continue
+			}
+			// A rechirp by nobody is meaningless, so those always go.
+			if retainChirps == RetainChirpsDelete || chirp.RechirpOfID != 0 {
+				dbStructure.deleteChirp(chirpID)
+				continue
+			}
+			// The user's media is deleted below, attachments included.
+			chirp.AuthorID = DeletedAuthorID
+			chirp.Attachments = nil
+			dbStructure.Chirps[chirpID] = chirp
+		}
+
+		dbStructure.rebuildAuthorIndex()
+
+		delete(dbStructure.MentionChirps, id)
+		heldIDs := map[int]bool{}
+		for heldID, held := range dbStructure.HeldChirps {
+			if held.Chirp.AuthorID == id {
+				heldIDs[heldID] = true
+				delete(dbStructure.HeldChirps, heldID)
+			}
+		}
+		for draftID, draft := range dbStructure.Drafts {
+			if draft.AuthorID == id {
+				delete(dbStructure.Drafts, draftID)
+			}
+		}
+		for reportID, report := range dbStructure.Reports {
+			// Reports on the user's held chirps have nothing left to
+			// review.
+			if heldIDs[report.HeldChirpID] {
+				delete(dbStructure.Reports, reportID)
+				continue
+			}
+			if report.ReporterID == id {
+				report.ReporterID = 0
+				dbStructure.Reports[reportID] = report
+			}
+		}
+		dbStructure.removeVotes(id)
+		for chirpID := range dbStructure.UserLikes[id] {
+			dbStructure.removeLike(id, chirpID)
+		}
+
+		dbStructure.removeUserEdges(id)
+		dbStructure.removeUserLists(id)
+		delete(dbStructure.Bookmarks, id)
+		for followeeID := range dbStructure.Following[id] {
+			removeFollow(dbStructure, id, followeeID)
+		}
+		for followerID := range dbStructure.Followers[id] {
+			removeFollow(dbStructure, followerID, id)
+		}
+
+		for key, identity := range dbStructure.Identities {
+			if identity.UserID == id {
+				delete(dbStructure.Identities, key)
+			}
+		}
+		for hash, grant := range dbStructure.OAuthGrants {
+			if grant.UserID == id {
+				delete(dbStructure.OAuthGrants, hash)
+			}
+		}
+		for hash, code := range dbStructure.OAuthCodes {
+			if code.UserID == id {
+				delete(dbStructure.OAuthCodes, hash)
+			}
+		}
+		for clientID, client := range dbStructure.OAuthClients {
+			if client.OwnerID != id {
+				continue
+			}
+			delete(dbStructure.OAuthClients, clientID)
+			for hash, grant := range dbStructure.OAuthGrants {
+				if grant.ClientID == clientID {
+					delete(dbStructure.OAuthGrants, hash)
+				}
+			}
+		}
+
+		for mediaID, media := range dbStructure.Media {
+			if media.OwnerID == id {
+				removed = append(removed, media)
+				delete(dbStructure.Media, mediaID)
+			}
+		}
+
+		delete(dbStructure.Users, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+func (db *DB) ExportUser(id int) (UserExport, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return UserExport{}, err
+	}
+	user, ok := dbStructure.Users[id]
+	if !ok {
+		return UserExport{}, errors.New("User not found")
+	}
+
+	export := UserExport{
+		ExportedAt:     time.Now().UTC(),
+		ID:             user.ID,
+		Email:          user.Email,
+		IsChirpyRed:    user.IsChirpyRed,
+		HasPassword:    user.Password != "",
+		Profile:        user.Profile,
+		Preferences:    user.Preferences,
+		CreatedAt:      user.CreatedAt,
+		UpdatedAt:      user.UpdatedAt,
+		Chirps:         []Chirp{},
+		HeldChirps:     []HeldChirp{},
+		Drafts:         []Draft{},
+		Media:          []Media{},
+		PollVotes:      map[int]int{},
+		LinkedAccounts: []ExportedLink{},
+		AuthorizedApps: []ExportedGrant{},
+		RegisteredApps: []ExportedApp{},
+		Blocked:        sortedEdges(dbStructure.Blocks[id]),
+		Muted:          sortedEdges(dbStructure.Mutes[id]),
+		Bookmarks:      []ExportedBookmark{},
+		Lists:          []ExportedList{},
+		FollowedLists:  []ExportedListFollow{},
+	}
+	for _, edge := range sortedEdges(dbStructure.Bookmarks[id]) {
+		export.Bookmarks = append(export.Bookmarks, ExportedBookmark{ChirpID: edge.UserID, BookmarkedAt: edge.Since})
+	}
+	for listID, list := range dbStructure.Lists {
+		if list.OwnerID == id {
+			export.Lists = append(export.Lists, ExportedList{List: list, Members: sortedEdges(dbStructure.ListMembers[listID])})
+		}
+	}
+	sort.Slice(export.Lists, func(i, j int) bool {
+		return export.Lists[i].ID < export.Lists[j].ID
+	})
+	for listID, followers := range dbStructure.ListFollowers {
+		if since, ok := followers[id]; ok {
+			export.FollowedLists = append(export.FollowedLists, ExportedListFollow{ListID: listID, Since: since})
+		}
+	}
+	sort.Slice(export.FollowedLists, func(i, j int) bool {
+		return export.FollowedLists[i].ListID < export.FollowedLists[j].ListID
+	})
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.AuthorID == id {
+			export.Chirps = append(export.Chirps, chirp)
+		}
+	}
+	sort.Slice(export.Chirps, func(i, j int) bool {
+		return export.Chirps[i].ID < export.Chirps[j].ID
+	})
+	for _, held := range dbStructure.HeldChirps {
+		if held.Chirp.AuthorID == id {
+			export.HeldChirps = append(export.HeldChirps, held)
+		}
+	}
+	sort.Slice(export.HeldChirps, func(i, j int) bool {
+		return export.HeldChirps[i].ID < export.HeldChirps[j].ID
+	})
+	for _, draft := range dbStructure.Drafts {
+		if draft.AuthorID == id {
+			export.Drafts = append(export.Drafts, draft)
+		}
+	}
+	sort.Slice(export.Drafts, func(i, j int) bool {
+		return export.Drafts[i].ID < export.Drafts[j].ID
+	})
+	for chirpID, voters := range dbStructure.PollVotes {
+		if option, ok := voters[id]; ok {
+			export.PollVotes[chirpID] = option
+		}
+	}
+	for _, item := range dbStructure.Media {
+		if item.OwnerID == id {
+			export.Media = append(export.Media, item)
+		}
+	}
+	sort.Slice(export.Media, func(i, j int) bool {
+		return export.Media[i].CreatedAt.Before(export.Media[j].CreatedAt)
+	})
+	for _, identity := range dbStructure.Identities {
+		if identity.UserID == id {
+			export.LinkedAccounts = append(export.LinkedAccounts, ExportedLink{
+				Issuer:   identity.Issuer,
+				Subject:  identity.Subject,
+				Email:    identity.Email,
+				DateMade: identity.DateMade,
+			})
+		}
+	}
+	for _, grant := range dbStructure.OAuthGrants {
+		if grant.UserID == id {
+			export.AuthorizedApps = append(export.AuthorizedApps, ExportedGrant{
+				ClientID:       grant.ClientID,
+				ClientName:     dbStructure.OAuthClients[grant.ClientID].Name,
+				Scope:          grant.Scope,
+				DateMade:       grant.DateMade,
+				ExpirationDate: grant.ExpirationDate,
+			})
+		}
+	}
+	for _, client := range dbStructure.OAuthClients {
+		if client.OwnerID == id {
+			export.RegisteredApps = append(export.RegisteredApps, ExportedApp{
+				ClientID:     client.ID,
+				Name:         client.Name,
+				RedirectURIs: client.RedirectURIs,
+				Scopes:       client.Scopes,
+				DateMade:     client.DateMade,
+			})
+		}
+	}
+	return export, nil
+}
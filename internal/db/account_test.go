@@ -0,0 +1,51 @@
+package database
+
+import "testing"
+
+func TestDeleteUserAnonymize(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 2)
+	author, reporter := users[0], users[1]
+	media, err := db.CreateMedia(Media{ID: "photo", OwnerID: author, Key: "photo.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := db.CreateChirp(Chirp{Body: "look", AuthorID: author, Attachments: []string{media.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := db.CreateReport(reporter, kept.ID, "spam", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	held := holdTestChirp(t, db, Chirp{Body: "held", AuthorID: author})
+	otherHeld := holdTestChirp(t, db, Chirp{Body: "also held", AuthorID: reporter})
+
+	removed, err := db.DeleteUser(author, RetainChirpsAnonymize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].ID != media.ID {
+		t.Errorf("got removed media %+v, want %q", removed, media.ID)
+	}
+	chirp, err := db.GetVisibleChirp(kept.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chirp.AuthorID != DeletedAuthorID || len(chirp.Attachments) != 0 {
+		t.Errorf("got author %d and attachments %v, want %d and none", chirp.AuthorID, chirp.Attachments, DeletedAuthorID)
+	}
+
+	reports, err := db.GetReports("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, other := range reports {
+		if other.ID == held.ID {
+			t.Errorf("report %d on a deleted held chirp was kept", held.ID)
+		}
+	}
+	if len(reports) != 2 {
+		t.Errorf("got reports %+v, want %d and %d", reports, report.ID, otherHeld.ID)
+	}
+}
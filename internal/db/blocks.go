@@ -0,0 +1,115 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrBlocked = errors.New("one of these users has blocked the other")
+
+// Block stops two users seeing or interacting with each other's chirps,
+// and ends any follows between them.
+func (db *DB) Block(userID, blockedID int) error {
+	if userID == blockedID {
+		return errors.New("users can't block themselves")
+	}
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[blockedID]; !ok {
+			return errors.New("User not found")
+		}
+		if _, ok := dbStructure.Blocks[userID][blockedID]; ok {
+			return nil
+		}
+		if dbStructure.Blocks[userID] == nil {
+			dbStructure.Blocks[userID] = map[int]time.Time{}
+		}
+		dbStructure.Blocks[userID][blockedID] = time.Now().UTC()
+		removeFollow(dbStructure, userID, blockedID)
+		removeFollow(dbStructure, blockedID, userID)
+		return nil
+	})
+}
+
+func (db *DB) Unblock(userID, blockedID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		removeEdge(dbStructure.Blocks, userID, blockedID)
+		return nil
+	})
+}
+
+// Mute hides a user's chirps from the muting user's feeds. Unlike a block,
+// the muted user isn't affected.
+func (db *DB) Mute(userID, mutedID int) error {
+	if userID == mutedID {
+		return errors.New("users can't mute themselves")
+	}
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[mutedID]; !ok {
+			return errors.New("User not found")
+		}
+		if _, ok := dbStructure.Mutes[userID][mutedID]; ok {
+			return nil
+		}
+		if dbStructure.Mutes[userID] == nil {
+			dbStructure.Mutes[userID] = map[int]time.Time{}
+		}
+		dbStructure.Mutes[userID][mutedID] = time.Now().UTC()
+		return nil
+	})
+}
+
+func (db *DB) Unmute(userID, mutedID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		removeEdge(dbStructure.Mutes, userID, mutedID)
+		return nil
+	})
+}
+
+// GetBlocked lists who the user has blocked, most recent first.
+func (db *DB) GetBlocked(userID int) ([]FollowEdge, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	return sortedEdges(dbStructure.Blocks[userID]), nil
+}
+
+// GetMuted lists who the user has muted, most recent first.
+func (db *DB) GetMuted(userID int) ([]FollowEdge, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	return sortedEdges(dbStructure.Mutes[userID]), nil
+}
+
+// blocked reports whether either user has blocked the other.
+func (dbStructure *DBStructure) blocked(a, b int) bool {
+	if _, ok := dbStructure.Blocks[a][b]; ok {
+		return true
+	}
+	_, ok := dbStructure.Blocks[b][a]
+	return ok
+}
+
+func (dbStructure *DBStructure) muted(userID, mutedID int) bool {
+	_, ok := dbStructure.Mutes[userID][mutedID]
+	return ok
+}
+
+// removeUserEdges drops every block and mute to or from a user.
+func (dbStructure *DBStructure) removeUserEdges(userID int) {
+	for _, edges := range []map[int]map[int]time.Time{dbStructure.Blocks, dbStructure.Mutes} {
+		delete(edges, userID)
+		for fromID := range edges {
+			removeEdge(edges, fromID, userID)
+		}
+	}
+}
+
+func removeEdge(edges map[int]map[int]time.Time, fromID, toID int) {
+	delete(edges[fromID], toID)
+	if len(edges[fromID]) == 0 {
+		delete(edges, fromID)
+	}
+}
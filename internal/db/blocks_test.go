@@ -0,0 +1,219 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func timelineIDs(t *testing.T, db *DB, userID int) []int {
+	t.Helper()
+	chirps, err := db.GetTimeline(userID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+	return ids
+}
+
+func TestBlockEnforcement(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 3)
+	blocker, blocked, other := users[0], users[1], users[2]
+	for _, pair := range [][2]int{{blocker, blocked}, {blocked, blocker}} {
+		err := db.Follow(pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	byBlocked := createTestChirps(t, db, blocked, "hello")[0]
+	byBlocker := createTestChirps(t, db, blocker, "hi")[0]
+	rechirp, err := db.Rechirp(other, byBlocked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Block(blocker, blocked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pair := range [][2]int{{blocker, blocked}, {blocked, blocker}} {
+		following, err := db.IsFollowing(pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if following {
+			t.Errorf("user %d still follows %d after the block", pair[0], pair[1])
+		}
+		err = db.Follow(pair[0], pair[1])
+		if !errors.Is(err, ErrBlocked) {
+			t.Errorf("user %d following %d: got error %v, want %v", pair[0], pair[1], err, ErrBlocked)
+		}
+	}
+
+	// The block works both ways and hides rechirps of the other user.
+	tests := []struct {
+		name     string
+		chirpID  int
+		viewerID int
+		visible  bool
+	}{
+		{"blocked user's chirp to blocker", byBlocked, blocker, false},
+		{"blocker's chirp to blocked user", byBlocker, blocked, false},
+		{"rechirp of blocked user's chirp", rechirp.ID, blocker, false},
+		{"blocked user's chirp to others", byBlocked, other, true},
+		{"blocked user's chirp to anonymous", byBlocked, 0, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := db.GetVisibleChirp(tc.chirpID, tc.viewerID)
+			if tc.visible && err != nil {
+				t.Errorf("got error %v, want the chirp", err)
+			}
+			if !tc.visible && !errors.Is(err, ErrChirpNotFound) {
+				t.Errorf("got error %v, want %v", err, ErrChirpNotFound)
+			}
+		})
+	}
+
+	// Neither side can interact with the other's chirps.
+	_, err = db.Like(blocker, byBlocked)
+	if !errors.Is(err, ErrChirpNotFound) {
+		t.Errorf("like: got error %v, want %v", err, ErrChirpNotFound)
+	}
+	_, err = db.Rechirp(blocked, byBlocker)
+	if !errors.Is(err, ErrChirpNotFound) {
+		t.Errorf("rechirp: got error %v, want %v", err, ErrChirpNotFound)
+	}
+	_, err = db.CreateChirp(Chirp{Body: "reply", AuthorID: blocked, InReplyToID: byBlocker})
+	if !errors.Is(err, ErrParentNotFound) {
+		t.Errorf("reply: got error %v, want %v", err, ErrParentNotFound)
+	}
+	_, err = db.CreateChirp(Chirp{Body: "quote", AuthorID: blocker, QuoteOfID: byBlocked})
+	if !errors.Is(err, ErrQuotedNotFound) {
+		t.Errorf("quote: got error %v, want %v", err, ErrQuotedNotFound)
+	}
+
+	err = db.Unblock(blocker, blocked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.GetVisibleChirp(byBlocked, blocker)
+	if err != nil {
+		t.Errorf("after unblocking: got error %v", err)
+	}
+}
+
+func TestBlockDropsMentions(t *testing.T) {
+	db := newTestDB(t)
+	author, err := db.CreateUser("author@example.com", "hash", Profile{Handle: "author"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocker, err := db.CreateUser("blocker@example.com", "hash", Profile{Handle: "blocker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	friend, err := db.CreateUser("friend@example.com", "hash", Profile{Handle: "friend"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Block(blocker.ID, author.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chirp, err := db.CreateChirp(Chirp{
+		Body:     "@blocker @friend",
+		AuthorID: author.ID,
+		Mentions: []Mention{{Handle: "blocker"}, {Handle: "friend"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirp.Mentions) != 1 || chirp.Mentions[0].UserID != friend.ID {
+		t.Errorf("got mentions %+v, want only @friend", chirp.Mentions)
+	}
+}
+
+func TestMuteHidesFromFeeds(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 3)
+	viewer, muted, friend := users[0], users[1], users[2]
+	for _, followeeID := range []int{muted, friend} {
+		err := db.Follow(viewer, followeeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	byMuted := createTestChirps(t, db, muted, "loud")[0]
+	byFriend := createTestChirps(t, db, friend, "quiet")[0]
+	rechirp, err := db.Rechirp(friend, byMuted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Mute(viewer, muted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both the muted user's chirps and rechirps of them leave the feed.
+	got := timelineIDs(t, db, viewer)
+	if len(got) != 1 || got[0] != byFriend {
+		t.Errorf("got timeline %v, want only %d", got, byFriend)
+	}
+	following, err := db.IsFollowing(viewer, muted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !following {
+		t.Error("muting ended the follow")
+	}
+	// Muted chirps can still be opened, and the muted user isn't affected.
+	_, err = db.GetVisibleChirp(byMuted, viewer)
+	if err != nil {
+		t.Errorf("opening a muted chirp: got error %v", err)
+	}
+	_, err = db.Like(muted, byFriend)
+	if err != nil {
+		t.Errorf("muted user liking: got error %v", err)
+	}
+
+	err = db.Unmute(viewer, muted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = timelineIDs(t, db, viewer)
+	want := []int{rechirp.ID, byFriend, byMuted}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after unmuting: got timeline %v, want %v", got, want)
+	}
+}
+
+func TestBlockAndMuteReject(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 1)
+
+	tests := []struct {
+		name string
+		fn   func(userID, otherID int) error
+	}{
+		{"block", db.Block},
+		{"mute", db.Mute},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.fn(users[0], users[0]); err == nil {
+				t.Error("self: got no error")
+			}
+			if err := tc.fn(users[0], 999); err == nil {
+				t.Error("unknown user: got no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// BookmarkedChirp is a chirp the user has bookmarked, with when they
+// bookmarked it.
+type BookmarkedChirp struct {
+	Chirp        Chirp
+	BookmarkedAt time.Time
+}
+
+// Bookmark saves a chirp for the user. Unlike likes, bookmarks are private
+// and not counted on the chirp. Bookmarking a rechirp bookmarks the
+// original, and bookmarking twice has no further effect.
+func (db *DB) Bookmark(userID, chirpID int) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.visibleOriginal(chirpID, userID)
+		if !ok {
+			return ErrChirpNotFound
+		}
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return errors.New("User not found")
+		}
+		if _, ok := dbStructure.Bookmarks[userID][chirp.ID]; ok {
+			return nil
+		}
+		if dbStructure.Bookmarks[userID] == nil {
+			dbStructure.Bookmarks[userID] = map[int]time.Time{}
+		}
+		dbStructure.Bookmarks[userID][chirp.ID] = time.Now().UTC()
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// Unbookmark removes a bookmark. Removing one that doesn't exist has no
+// effect.
+func (db *DB) Unbookmark(userID, chirpID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		if chirp, ok := dbStructure.original(chirpID); ok {
+			chirpID = chirp.ID
+		}
+		removeEdge(dbStructure.Bookmarks, userID, chirpID)
+		return nil
+	})
+}
+
+// GetBookmarkedChirps lists the chirps the user has bookmarked that they
+// can still see, most recently bookmarked first.
+func (db *DB) GetBookmarkedChirps(userID int) ([]BookmarkedChirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	bookmarked := make([]BookmarkedChirp, 0, len(dbStructure.Bookmarks[userID]))
+	for chirpID, at := range dbStructure.Bookmarks[userID] {
+		chirp, ok := dbStructure.visibleChirp(chirpID, userID)
+		if !ok {
+			continue
+		}
+		bookmarked = append(bookmarked, BookmarkedChirp{Chirp: chirp, BookmarkedAt: at})
+	}
+	sort.Slice(bookmarked, func(i, j int) bool {
+		if bookmarked[i].BookmarkedAt.Equal(bookmarked[j].BookmarkedAt) {
+			return bookmarked[i].Chirp.ID > bookmarked[j].Chirp.ID
+		}
+		return bookmarked[i].BookmarkedAt.After(bookmarked[j].BookmarkedAt)
+	})
+	return bookmarked, nil
+}
+
+// removeBookmarks drops every bookmark of a deleted chirp.
+func (dbStructure *DBStructure) removeBookmarks(chirpID int) {
+	for userID := range dbStructure.Bookmarks {
+		removeEdge(dbStructure.Bookmarks, userID, chirpID)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"sort"
 	"sync"
+	"time"
 )
 
 type DB struct {
@@ -13,14 +15,105 @@ type DB struct {
 }
 
 type DBStructure struct {
-	Chirps map[int]Chirp `json:"chirps"`
-	Users  map[int]User  `json:"users"`
+	SchemaVersion int                    `json:"schema_version"`
+	Chirps        map[int]Chirp          `json:"chirps"`
+	Users         map[int]User           `json:"users"`
+	OAuthClients  map[string]OAuthClient `json:"oauth_clients"`
+	OAuthCodes    map[string]OAuthCode   `json:"oauth_codes"`
+	OAuthGrants   map[string]OAuthGrant  `json:"oauth_grants"`
+	RevokedTokens map[string]time.Time   `json:"revoked_tokens"`
+	Identities    map[string]Identity    `json:"identities"`
+	OIDCLogins    map[string]OIDCLogin   `json:"oidc_logins"`
+	LastChirpID   int                    `json:"last_chirp_id"`
+	LastUserID    int                    `json:"last_user_id"`
+	// LastChirpAt is the newest chirp creation time handed out, so that
+	// creation times never go backwards even if the clock does.
+	LastChirpAt time.Time `json:"last_chirp_at"`
+	// AuthorChirps indexes chirp IDs by author in ascending order.
+	AuthorChirps map[int][]int             `json:"author_chirps"`
+	Following    map[int]map[int]time.Time `json:"following"`
+	Followers    map[int]map[int]time.Time `json:"followers"`
+	// Replies indexes reply IDs by the chirp they answer, ascending.
+	Replies map[int][]int `json:"replies"`
+	// Tombstones keeps the parent of deleted chirps that still have
+	// replies, so threads can be walked through them.
+	Tombstones map[int]int `json:"tombstones"`
+	// Likes maps chirps to the users who liked them; UserLikes is the
+	// same set keyed by user.
+	Likes     map[int]map[int]time.Time `json:"likes"`
+	UserLikes map[int]map[int]time.Time `json:"user_likes"`
+	// Rechirps maps chirps to the users who reposted them and the ID of
+	// each rechirp.
+	Rechirps map[int]map[int]int `json:"rechirps"`
+	// MentionChirps indexes chirp IDs by mentioned user, ascending.
+	MentionChirps map[int][]int `json:"mention_chirps"`
+	// Hashtags indexes chirps by lowercased tag, ascending by chirp ID.
+	Hashtags map[string][]TagUse `json:"hashtags"`
+	// SearchIndex is the full-text inverted index from term to the chirps
+	// containing it, ascending by chirp ID.
+	SearchIndex map[string][]Posting `json:"search_index"`
+	// ChirpRevisions holds the earlier versions of edited chirps, oldest
+	// first.
+	ChirpRevisions map[int][]ChirpRevision `json:"chirp_revisions"`
+	// HeldChirps are chirps moderation is holding back for review.
+	HeldChirps      map[int]HeldChirp `json:"held_chirps"`
+	LastHeldChirpID int               `json:"last_held_chirp_id"`
+	// Reports is the moderation queue; ModerationLog is the audit trail of
+	// what moderators and admins did, oldest first.
+	Reports       map[int]Report    `json:"reports"`
+	LastReportID  int               `json:"last_report_id"`
+	ModerationLog []ModerationEvent `json:"moderation_log"`
+	// Blocks and Mutes map users to the accounts they blocked or muted.
+	Blocks map[int]map[int]time.Time `json:"blocks"`
+	Mutes  map[int]map[int]time.Time `json:"mutes"`
+	// Media holds uploaded images by ID.
+	Media map[string]Media `json:"media"`
+	// PollVotes maps chirps with polls to each voter's option.
+	PollVotes map[int]map[int]int `json:"poll_votes"`
+	// Drafts are unpublished chirps, including scheduled ones.
+	Drafts      map[int]Draft `json:"drafts"`
+	LastDraftID int           `json:"last_draft_id"`
+	// Bookmarks maps users to the chirps they bookmarked.
+	Bookmarks map[int]map[int]time.Time `json:"bookmarks"`
+	// ListMembers and ListFollowers map lists to the users on them and
+	// the users following them.
+	Lists         map[int]List              `json:"lists"`
+	LastListID    int                       `json:"last_list_id"`
+	ListMembers   map[int]map[int]time.Time `json:"list_members"`
+	ListFollowers map[int]map[int]time.Time `json:"list_followers"`
 }
 
 type Chirp struct {
-	ID       int    `json:"id"`
-	Body     string `json:"body"`
-	AuthorID int    `json:"author_id"`
+	ID          int    `json:"id"`
+	Body        string `json:"body"`
+	AuthorID    int    `json:"author_id"`
+	InReplyToID int    `json:"in_reply_to_id,omitempty"`
+	LikeCount   int    `json:"like_count"`
+	// RechirpOfID is set on pure reposts, which have no body of their own.
+	RechirpOfID  int       `json:"rechirp_of_id,omitempty"`
+	QuoteOfID    int       `json:"quote_of_id,omitempty"`
+	RechirpCount int       `json:"rechirp_count"`
+	Mentions     []Mention `json:"mentions,omitempty"`
+	Hashtags     []Hashtag `json:"hashtags,omitempty"`
+	// CreatedAt never decreases with ID, so ID order is also time order.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// EditedAt is zero until the chirp is first edited.
+	EditedAt   time.Time         `json:"edited_at"`
+	Moderation *ModerationRecord `json:"moderation,omitempty"`
+	// Attachments are Media IDs, in display order.
+	Attachments []string   `json:"attachments,omitempty"`
+	Poll        *Poll      `json:"poll,omitempty"`
+	Hidden      *ChirpHide `json:"hidden,omitempty"`
+	// Visibility is one of the Visibility levels; empty means public.
+	Visibility string `json:"visibility,omitempty"`
+	// ContentWarning is the author's warning to show in place of the body
+	// until the reader expands it. Sensitive chirps have their
+	// attachments blurred until revealed. See Warning for what readers
+	// actually get.
+	ContentWarning string         `json:"content_warning,omitempty"`
+	Sensitive      bool           `json:"sensitive,omitempty"`
+	ForcedWarning  *ForcedWarning `json:"forced_warning,omitempty"`
 }
 
 func NewDB(path string) (*DB, error) {
@@ -29,57 +122,140 @@ func NewDB(path string) (*DB, error) {
 		mu:   &sync.RWMutex{},
 	}
 	err := db.ensureDB()
+	if err != nil {
+		return db, err
+	}
+	err = db.migrate()
 	return db, err
 }
 
-func (db *DB) CreateChirp(body string, authorID int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
+// CreateChirp stores a new chirp built from the given fields and assigns
+// its ID.
+// Replies and quotes of a rechirp are attached to the original chirp.
+// Mentions only need Handle set; they're resolved to users here and
+// mentions of unknown handles are dropped.
+func (db *DB) CreateChirp(chirp Chirp) (Chirp, error) {
+	chirp.LikeCount = 0
+	chirp.RechirpOfID = 0
+	chirp.RechirpCount = 0
+	chirp.EditedAt = time.Time{}
+	chirp.Hidden = nil
+	chirp.ForcedWarning = nil
+	if chirp.Poll != nil {
+		for i := range chirp.Poll.Options {
+			chirp.Poll.Options[i].Votes = 0
+		}
+	}
+	err := db.update(func(dbStructure *DBStructure) error {
+		var err error
+		chirp, err = dbStructure.createChirp(chirp, 0)
+		return err
+	})
 	if err != nil {
 		return Chirp{}, err
 	}
 
-	id := len(dbStructure.Chirps) + 1
-	chirp := Chirp{
-		ID:       id,
-		Body:     body,
-		AuthorID: authorID,
-	}
-	dbStructure.Chirps[id] = chirp
+	return chirp, nil
+}
 
-	err = db.writeDB(dbStructure)
+// createChirp is CreateChirp within an update. Attachments may already be
+// on the draft with ID draftID, if the chirp is being published from one.
+func (dbStructure *DBStructure) createChirp(chirp Chirp, draftID int) (Chirp, error) {
+	chirp, err := dbStructure.prepareChirp(chirp, draftID)
 	if err != nil {
 		return Chirp{}, err
 	}
+	return dbStructure.insertChirp(chirp), nil
+}
 
+// prepareChirp checks what a new chirp refers to, moving replies and
+// quotes of rechirps to the original, and resolves its mentions.
+func (dbStructure *DBStructure) prepareChirp(chirp Chirp, draftID int) (Chirp, error) {
+	err := checkVisibility(chirp.Visibility)
+	if err != nil {
+		return Chirp{}, err
+	}
+	if chirp.Visibility == VisibilityPublic {
+		chirp.Visibility = ""
+	}
+	chirp.InReplyToID, chirp.QuoteOfID, err = dbStructure.resolveReferences(chirp.AuthorID, chirp.InReplyToID, chirp.QuoteOfID)
+	if err != nil {
+		return Chirp{}, err
+	}
+	err = dbStructure.checkAttachments(chirp.AuthorID, chirp.Attachments, draftID)
+	if err != nil {
+		return Chirp{}, err
+	}
+	chirp.Mentions = dbStructure.resolveMentions(chirp.AuthorID, chirp.Mentions)
 	return chirp, nil
 }
 
-func (db *DB) GetChirps() ([]Chirp, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return nil, err
+// resolveReferences finds the chirps being replied to and quoted, either
+// of which may be 0 for none, as the originals authorID can see.
+func (dbStructure *DBStructure) resolveReferences(authorID, inReplyToID, quoteOfID int) (int, int, error) {
+	if inReplyToID != 0 {
+		parent, ok := dbStructure.visibleOriginal(inReplyToID, authorID)
+		if !ok {
+			return 0, 0, ErrParentNotFound
+		}
+		inReplyToID = parent.ID
 	}
+	if quoteOfID != 0 {
+		quoted, ok := dbStructure.visibleOriginal(quoteOfID, authorID)
+		if !ok {
+			return 0, 0, ErrQuotedNotFound
+		}
+		quoteOfID = quoted.ID
+	}
+	return inReplyToID, quoteOfID, nil
+}
 
-	chirps := make([]Chirp, 0, len(dbStructure.Chirps))
-	for _, chirp := range dbStructure.Chirps {
-		chirps = append(chirps, chirp)
+// insertChirp assigns the chirp the next ID and adds it to the indexes.
+func (dbStructure *DBStructure) insertChirp(chirp Chirp) Chirp {
+	dbStructure.LastChirpID++
+	id := dbStructure.LastChirpID
+	chirp.ID = id
+	chirp.CreatedAt = time.Now().UTC()
+	if chirp.CreatedAt.Before(dbStructure.LastChirpAt) {
+		chirp.CreatedAt = dbStructure.LastChirpAt
 	}
+	dbStructure.LastChirpAt = chirp.CreatedAt
+	chirp.UpdatedAt = chirp.CreatedAt
+	dbStructure.Chirps[id] = chirp
+	dbStructure.AuthorChirps[chirp.AuthorID] = append(dbStructure.AuthorChirps[chirp.AuthorID], id)
+	if chirp.InReplyToID != 0 {
+		dbStructure.Replies[chirp.InReplyToID] = append(dbStructure.Replies[chirp.InReplyToID], id)
+	}
+	dbStructure.indexEntities(chirp, chirp.CreatedAt)
+	dbStructure.indexChirpText(chirp)
+	dbStructure.attachMedia(chirp.Attachments, id, 0, 0)
+	return chirp
+}
 
-	return chirps, nil
+// firstChirpFrom returns the lowest chirp ID created at or after t, or
+// LastChirpID+1 if there is none. insertChirp never lets creation times go
+// backwards, so IDs can be binary searched by time; a deleted chirp's ID
+// takes the time of the next chirp that still exists.
+func (dbStructure *DBStructure) firstChirpFrom(t time.Time) int {
+	last := dbStructure.LastChirpID
+	return 1 + sort.Search(last, func(i int) bool {
+		for id := i + 1; id <= last; id++ {
+			if chirp, ok := dbStructure.Chirps[id]; ok {
+				return !chirp.CreatedAt.Before(t)
+			}
+		}
+		return true
+	})
 }
 
 func (db *DB) DeleteChirp(id int) error {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
-	for _, chirp := range dbStructure.Chirps {
-		if chirp.ID == id {
-			delete(dbStructure.Chirps, id)
-			return nil
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Chirps[id]; !ok {
+			return errors.New("did not find chirp")
 		}
-	}
-	return errors.New("did not find chirp")
+		dbStructure.deleteChirp(id)
+		return nil
+	})
 }
 
 func (db *DB) GetSingleChirp(id int) (Chirp, error) {
@@ -95,11 +271,151 @@ func (db *DB) GetSingleChirp(id int) (Chirp, error) {
 }
 
 func (db *DB) createDB() error {
-	dbStructure := DBStructure{
-		Chirps: map[int]Chirp{},
-		Users:  map[int]User{},
+	dbStructure := DBStructure{SchemaVersion: len(migrations)}
+	dbStructure.initCollections()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.writeFile(dbStructure)
+}
+
+// initCollections fills in collections that are missing from databases
+// written by older versions.
+func (dbStructure *DBStructure) initCollections() {
+	if dbStructure.Chirps == nil {
+		dbStructure.Chirps = map[int]Chirp{}
+	}
+	if dbStructure.Users == nil {
+		dbStructure.Users = map[int]User{}
+	}
+	if dbStructure.OAuthClients == nil {
+		dbStructure.OAuthClients = map[string]OAuthClient{}
+	}
+	if dbStructure.OAuthCodes == nil {
+		dbStructure.OAuthCodes = map[string]OAuthCode{}
+	}
+	if dbStructure.OAuthGrants == nil {
+		dbStructure.OAuthGrants = map[string]OAuthGrant{}
+	}
+	if dbStructure.RevokedTokens == nil {
+		dbStructure.RevokedTokens = map[string]time.Time{}
+	}
+	if dbStructure.Identities == nil {
+		dbStructure.Identities = map[string]Identity{}
+	}
+	if dbStructure.OIDCLogins == nil {
+		dbStructure.OIDCLogins = map[string]OIDCLogin{}
+	}
+	// IDs used to be len+1, so older files have no counters yet.
+	for id := range dbStructure.Chirps {
+		if id > dbStructure.LastChirpID {
+			dbStructure.LastChirpID = id
+		}
+	}
+	for id := range dbStructure.Users {
+		if id > dbStructure.LastUserID {
+			dbStructure.LastUserID = id
+		}
+	}
+	if dbStructure.AuthorChirps == nil {
+		dbStructure.rebuildAuthorIndex()
+	}
+	if dbStructure.Following == nil {
+		dbStructure.Following = map[int]map[int]time.Time{}
+	}
+	if dbStructure.Followers == nil {
+		dbStructure.Followers = map[int]map[int]time.Time{}
+	}
+	if dbStructure.Replies == nil {
+		dbStructure.Replies = map[int][]int{}
+		for id, chirp := range dbStructure.Chirps {
+			if chirp.InReplyToID != 0 {
+				dbStructure.Replies[chirp.InReplyToID] = append(dbStructure.Replies[chirp.InReplyToID], id)
+			}
+		}
+		for _, ids := range dbStructure.Replies {
+			sort.Ints(ids)
+		}
+	}
+	if dbStructure.Tombstones == nil {
+		dbStructure.Tombstones = map[int]int{}
+	}
+	if dbStructure.Likes == nil {
+		dbStructure.Likes = map[int]map[int]time.Time{}
+	}
+	if dbStructure.UserLikes == nil {
+		dbStructure.UserLikes = map[int]map[int]time.Time{}
+	}
+	if dbStructure.Rechirps == nil {
+		dbStructure.Rechirps = map[int]map[int]int{}
+	}
+	if dbStructure.MentionChirps == nil {
+		dbStructure.MentionChirps = map[int][]int{}
+	}
+	if dbStructure.Hashtags == nil {
+		dbStructure.Hashtags = map[string][]TagUse{}
+	}
+	if dbStructure.SearchIndex == nil {
+		dbStructure.rebuildSearchIndex()
+	}
+	if dbStructure.ChirpRevisions == nil {
+		dbStructure.ChirpRevisions = map[int][]ChirpRevision{}
+	}
+	if dbStructure.HeldChirps == nil {
+		dbStructure.HeldChirps = map[int]HeldChirp{}
+	}
+	if dbStructure.Reports == nil {
+		dbStructure.Reports = map[int]Report{}
+	}
+	if dbStructure.ModerationLog == nil {
+		dbStructure.ModerationLog = []ModerationEvent{}
+	}
+	if dbStructure.Blocks == nil {
+		dbStructure.Blocks = map[int]map[int]time.Time{}
+	}
+	if dbStructure.Mutes == nil {
+		dbStructure.Mutes = map[int]map[int]time.Time{}
+	}
+	if dbStructure.Media == nil {
+		dbStructure.Media = map[string]Media{}
+	}
+	if dbStructure.PollVotes == nil {
+		dbStructure.PollVotes = map[int]map[int]int{}
+	}
+	if dbStructure.Drafts == nil {
+		dbStructure.Drafts = map[int]Draft{}
+	}
+	if dbStructure.Bookmarks == nil {
+		dbStructure.Bookmarks = map[int]map[int]time.Time{}
+	}
+	if dbStructure.Lists == nil {
+		dbStructure.Lists = map[int]List{}
+	}
+	if dbStructure.ListMembers == nil {
+		dbStructure.ListMembers = map[int]map[int]time.Time{}
+	}
+	if dbStructure.ListFollowers == nil {
+		dbStructure.ListFollowers = map[int]map[int]time.Time{}
 	}
-	return db.writeDB(dbStructure)
+}
+
+func (dbStructure *DBStructure) rebuildAuthorIndex() {
+	dbStructure.AuthorChirps = map[int][]int{}
+	for id, chirp := range dbStructure.Chirps {
+		dbStructure.AuthorChirps[chirp.AuthorID] = append(dbStructure.AuthorChirps[chirp.AuthorID], id)
+	}
+	for _, ids := range dbStructure.AuthorChirps {
+		sort.Ints(ids)
+	}
+}
+
+func (dbStructure *DBStructure) removeFromAuthorIndex(chirp Chirp) {
+	ids := removeSorted(dbStructure.AuthorChirps[chirp.AuthorID], chirp.ID)
+	if len(ids) == 0 {
+		delete(dbStructure.AuthorChirps, chirp.AuthorID)
+		return
+	}
+	dbStructure.AuthorChirps[chirp.AuthorID] = ids
 }
 
 func (db *DB) ensureDB() error {
@@ -114,6 +430,29 @@ func (db *DB) loadDB() (DBStructure, error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
+	return db.readFile()
+}
+
+// update loads the database, applies fn and writes the result back while
+// holding the write lock throughout, so concurrent updates can't overwrite
+// each other. Nothing is written if fn returns an error. Every change to
+// the database goes through here.
+func (db *DB) update(fn func(dbStructure *DBStructure) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	dbStructure, err := db.readFile()
+	if err != nil {
+		return err
+	}
+	err = fn(&dbStructure)
+	if err != nil {
+		return err
+	}
+	return db.writeFile(dbStructure)
+}
+
+func (db *DB) readFile() (DBStructure, error) {
 	dbStructure := DBStructure{}
 	dat, err := os.ReadFile(db.path)
 	if errors.Is(err, os.ErrNotExist) {
@@ -123,14 +462,12 @@ func (db *DB) loadDB() (DBStructure, error) {
 	if err != nil {
 		return dbStructure, err
 	}
+	dbStructure.initCollections()
 
 	return dbStructure, nil
 }
 
-func (db *DB) writeDB(dbStructure DBStructure) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-
+func (db *DB) writeFile(dbStructure DBStructure) error {
 	dat, err := json.Marshal(dbStructure)
 	if err != nil {
 		return err
@@ -142,19 +479,3 @@ func (db *DB) writeDB(dbStructure DBStructure) error {
 	}
 	return nil
 }
-
-func (db *DB) GetAuthorChirps(authorID int) ([]Chirp, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return nil, err
-	}
-
-	chirps := make([]Chirp, 0)
-	for _, chirp := range dbStructure.Chirps {
-		if chirp.AuthorID == authorID {
-			chirps = append(chirps, chirp)
-		}
-	}
-
-	return chirps, nil
-}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrDraftNotFound = errors.New("draft not found")
+	// ErrDraftChanged means a draft was edited, published or deleted
+	// while it was being published.
+	ErrDraftChanged    = errors.New("draft changed while it was being published")
+	ErrAuthorSuspended = errors.New("account is suspended")
+)
+
+// Draft is a chirp its author hasn't published yet. Nobody else can see
+// it. A draft with PublishAt set is scheduled, and is published once that
+// time comes.
+//
+// Drafts hold what the author wrote: moderation, mentions and hashtags are
+// worked out when the draft is published.
+type Draft struct {
+	ID          int        `json:"id"`
+	AuthorID    int        `json:"author_id"`
+	Body        string     `json:"body"`
+	InReplyToID int        `json:"in_reply_to_id,omitempty"`
+	QuoteOfID   int        `json:"quote_of_id,omitempty"`
+	Attachments []string   `json:"attachments,omitempty"`
+	Poll        *DraftPoll `json:"poll,omitempty"`
+	Visibility  string     `json:"visibility,omitempty"`
+	// ContentWarning and Sensitive are as on Chirp.
+	ContentWarning string `json:"content_warning,omitempty"`
+	Sensitive      bool   `json:"sensitive,omitempty"`
+	// PublishAt is zero for drafts that aren't scheduled.
+	PublishAt time.Time `json:"publish_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Error says why the last scheduled publish failed. The draft is
+	// unscheduled when that happens, so the author can fix it.
+	Error string `json:"error,omitempty"`
+}
+
+// DraftPoll is a poll on a draft. It only gets a closing time once the
+// draft is published.
+type DraftPoll struct {
+	Options         []string `json:"options"`
+	DurationMinutes int      `json:"duration_minutes"`
+}
+
+func (d Draft) Scheduled() bool {
+	return !d.PublishAt.IsZero()
+}
+
+// CreateDraft stores a new draft. Replies and quotes of a rechirp are
+// attached to the original chirp, and attachments are checked as for
+// CreateChirp.
+func (db *DB) CreateDraft(draft Draft) (Draft, error) {
+	err := db.update(func(dbStructure *DBStructure) error {
+		var err error
+		draft, err = dbStructure.checkDraft(draft, 0)
+		if err != nil {
+			return err
+		}
+		dbStructure.LastDraftID++
+		draft.ID = dbStructure.LastDraftID
+		draft.CreatedAt = time.Now().UTC()
+		draft.UpdatedAt = draft.CreatedAt
+		draft.Error = ""
+		dbStructure.Drafts[draft.ID] = draft
+		dbStructure.attachMedia(draft.Attachments, 0, 0, draft.ID)
+		return nil
+	})
+	if err != nil {
+		return Draft{}, err
+	}
+	return draft, nil
+}
+
+// UpdateDraft replaces the contents and schedule of one of the author's
+// drafts.
+func (db *DB) UpdateDraft(draft Draft) (Draft, error) {
+	err := db.update(func(dbStructure *DBStructure) error {
+		existing, ok := dbStructure.Drafts[draft.ID]
+		if !ok || existing.AuthorID != draft.AuthorID {
+			return ErrDraftNotFound
+		}
+		var err error
+		draft, err = dbStructure.checkDraft(draft, draft.ID)
+		if err != nil {
+			return err
+		}
+		draft.CreatedAt = existing.CreatedAt
+		draft.UpdatedAt = time.Now().UTC()
+		draft.Error = ""
+		dbStructure.attachMedia(existing.Attachments, 0, 0, 0)
+		dbStructure.attachMedia(draft.Attachments, 0, 0, draft.ID)
+		dbStructure.Drafts[draft.ID] = draft
+		return nil
+	})
+	if err != nil {
+		return Draft{}, err
+	}
+	return draft, nil
+}
+
+func (dbStructure *DBStructure) checkDraft(draft Draft, draftID int) (Draft, error) {
+	err := checkVisibility(draft.Visibility)
+	if err != nil {
+		return Draft{}, err
+	}
+	draft.InReplyToID, draft.QuoteOfID, err = dbStructure.resolveReferences(draft.AuthorID, draft.InReplyToID, draft.QuoteOfID)
+	if err != nil {
+		return Draft{}, err
+	}
+	err = dbStructure.checkAttachments(draft.AuthorID, draft.Attachments, draftID)
+	if err != nil {
+		return Draft{}, err
+	}
+	return draft, nil
+}
+
+// GetDrafts lists an author's drafts, scheduled or not, oldest first.
+func (db *DB) GetDrafts(authorID int) ([]Draft, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	drafts := []Draft{}
+	for _, draft := range dbStructure.Drafts {
+		if draft.AuthorID == authorID {
+			drafts = append(drafts, draft)
+		}
+	}
+	sort.Slice(drafts, func(i, j int) bool {
+		return drafts[i].ID < drafts[j].ID
+	})
+	return drafts, nil
+}
+
+// GetDraft returns one of the author's drafts.
+func (db *DB) GetDraft(id, authorID int) (Draft, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Draft{}, err
+	}
+	draft, ok := dbStructure.Drafts[id]
+	if !ok || draft.AuthorID != authorID {
+		return Draft{}, ErrDraftNotFound
+	}
+	return draft, nil
+}
+
+// DeleteDraft discards one of the author's drafts. Its attachments are
+// left unattached, to be cleaned up with other unused uploads.
+func (db *DB) DeleteDraft(id, authorID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		draft, ok := dbStructure.Drafts[id]
+		if !ok || draft.AuthorID != authorID {
+			return ErrDraftNotFound
+		}
+		dbStructure.attachMedia(draft.Attachments, 0, 0, 0)
+		delete(dbStructure.Drafts, id)
+		return nil
+	})
+}
+
+// GetDueDrafts lists the scheduled drafts whose time has come, earliest
+// first.
+func (db *DB) GetDueDrafts(now time.Time) ([]Draft, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	drafts := []Draft{}
+	for _, draft := range dbStructure.Drafts {
+		if draft.Scheduled() && !draft.PublishAt.After(now) {
+			drafts = append(drafts, draft)
+		}
+	}
+	sort.Slice(drafts, func(i, j int) bool {
+		if !drafts[i].PublishAt.Equal(drafts[j].PublishAt) {
+			return drafts[i].PublishAt.Before(drafts[j].PublishAt)
+		}
+		return drafts[i].ID < drafts[j].ID
+	})
+	return drafts, nil
+}
+
+// NextPublishAt returns when the next scheduled draft is due, or false if
+// nothing is scheduled.
+func (db *DB) NextPublishAt() (time.Time, bool, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	var next time.Time
+	for _, draft := range dbStructure.Drafts {
+		if draft.Scheduled() && (next.IsZero() || draft.PublishAt.Before(next)) {
+			next = draft.PublishAt
+		}
+	}
+	return next, !next.IsZero(), nil
+}
+
+// PublishDraft replaces a draft with the chirp made from it. draft must be
+// the version the chirp was made from; if it has changed since, nothing
+// happens and ErrDraftChanged is returned.
+func (db *DB) PublishDraft(draft Draft, chirp Chirp) (Chirp, error) {
+	err := db.update(func(dbStructure *DBStructure) error {
+		err := dbStructure.takeDraft(draft)
+		if err != nil {
+			return err
+		}
+		chirp.AuthorID = draft.AuthorID
+		chirp, err = dbStructure.createChirp(chirp, draft.ID)
+		return err
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// HoldDraft is PublishDraft for chirps moderation wants reviewed first.
+func (db *DB) HoldDraft(draft Draft, chirp Chirp) (HeldChirp, error) {
+	var held HeldChirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		err := dbStructure.takeDraft(draft)
+		if err != nil {
+			return err
+		}
+		chirp.AuthorID = draft.AuthorID
+		held, err = dbStructure.holdChirp(chirp, draft.ID)
+		return err
+	})
+	if err != nil {
+		return HeldChirp{}, err
+	}
+	return held, nil
+}
+
+// takeDraft removes a draft that's about to be published, as long as it
+// hasn't changed and its author may still post.
+func (dbStructure *DBStructure) takeDraft(draft Draft) error {
+	current, ok := dbStructure.Drafts[draft.ID]
+	if !ok || !current.UpdatedAt.Equal(draft.UpdatedAt) {
+		return ErrDraftChanged
+	}
+	user, ok := dbStructure.Users[current.AuthorID]
+	if !ok {
+		return ErrDraftChanged
+	}
+	if user.Suspension != nil && user.Suspension.Active(time.Now()) {
+		return ErrAuthorSuspended
+	}
+	delete(dbStructure.Drafts, draft.ID)
+	return nil
+}
+
+// FailDraft unschedules a draft that couldn't be published and records
+// why. Like PublishDraft, it does nothing if the draft has changed.
+func (db *DB) FailDraft(draft Draft, reason string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		current, ok := dbStructure.Drafts[draft.ID]
+		if !ok || !current.UpdatedAt.Equal(draft.UpdatedAt) {
+			return ErrDraftChanged
+		}
+		current.PublishAt = time.Time{}
+		current.Error = reason
+		dbStructure.Drafts[draft.ID] = current
+		return nil
+	})
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotChirpAuthor   = errors.New("only the author can edit a chirp")
+	ErrEditWindowClosed = errors.New("chirp can no longer be edited")
+)
+
+// ChirpRevision is an earlier version of an edited chirp. CreatedAt is when
+// that version was written: the chirp's creation time for the original,
+// the edit time for later ones.
+type ChirpRevision struct {
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EditChirp replaces a chirp's body, mentions, hashtags and moderation
+// record with those in edit and keeps the previous version in the chirp's history. Only the
+// author may edit, and only until editWindow after the chirp was posted.
+func (db *DB) EditChirp(id, authorID int, edit Chirp, editWindow time.Duration) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.Chirps[id]
+		if !ok || chirp.RechirpOfID != 0 {
+			return errors.New("chirp not found")
+		}
+		if chirp.AuthorID != authorID {
+			return ErrNotChirpAuthor
+		}
+		now := time.Now().UTC()
+		if chirp.CreatedAt.IsZero() || now.Sub(chirp.CreatedAt) > editWindow {
+			return ErrEditWindowClosed
+		}
+
+		previous := ChirpRevision{Body: chirp.Body, CreatedAt: chirp.CreatedAt}
+		if !chirp.EditedAt.IsZero() {
+			previous.CreatedAt = chirp.EditedAt
+		}
+		dbStructure.ChirpRevisions[id] = append(dbStructure.ChirpRevisions[id], previous)
+
+		dbStructure.unindexEntities(chirp)
+		dbStructure.unindexChirpText(chirp)
+		chirp.Body = edit.Body
+		chirp.Mentions = dbStructure.resolveMentions(chirp.AuthorID, edit.Mentions)
+		chirp.Hashtags = edit.Hashtags
+		chirp.Moderation = edit.Moderation
+		chirp.ContentWarning = edit.ContentWarning
+		chirp.Sensitive = edit.Sensitive
+		chirp.EditedAt = now
+		chirp.UpdatedAt = now
+		dbStructure.Chirps[id] = chirp
+		dbStructure.indexEntities(chirp, chirp.CreatedAt)
+		dbStructure.indexChirpText(chirp)
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// GetChirpHistory returns every version of a chirp, oldest first, ending
+// with the current one, if the viewer may see it.
+func (db *DB) GetChirpHistory(id, viewerID int) ([]ChirpRevision, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	chirp, ok := dbStructure.visibleChirp(id, viewerID)
+	if !ok {
+		return nil, errors.New("chirp not found")
+	}
+	current := ChirpRevision{Body: chirp.Body, CreatedAt: chirp.CreatedAt}
+	if !chirp.EditedAt.IsZero() {
+		current.CreatedAt = chirp.EditedAt
+	}
+	history := append([]ChirpRevision{}, dbStructure.ChirpRevisions[id]...)
+	return append(history, current), nil
+}
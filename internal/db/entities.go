@@ -0,0 +1,199 @@
+package database
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Mention is an @handle in a chirp body that names an existing user.
+// Offsets count characters, not bytes; Start is inclusive, End exclusive,
+// and the range covers the leading @.
+type Mention struct {
+	UserID int    `json:"user_id"`
+	Handle string `json:"handle"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+}
+
+// Hashtag is a #tag in a chirp body. Tag is lowercased and has no #;
+// offsets work as for Mention.
+type Hashtag struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// TagUse is one chirp using a hashtag, in the hashtag index.
+type TagUse struct {
+	ChirpID int       `json:"chirp_id"`
+	At      time.Time `json:"at"`
+}
+
+// TrendingHashtag is a hashtag with the number of chirps that used it in
+// the trending window.
+type TrendingHashtag struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// resolveMentions fills in the user each mention names, dropping mentions
+// of handles that don't belong to anyone.
+func (dbStructure *DBStructure) resolveMentions(authorID int, mentions []Mention) []Mention {
+	if len(mentions) == 0 {
+		return nil
+	}
+	byHandle := make(map[string]int, len(dbStructure.Users))
+	for _, user := range dbStructure.Users {
+		if user.Handle != "" {
+			byHandle[strings.ToLower(user.Handle)] = user.ID
+		}
+	}
+	resolved := []Mention{}
+	for _, mention := range mentions {
+		userID, ok := byHandle[strings.ToLower(mention.Handle)]
+		if !ok || dbStructure.blocked(authorID, userID) {
+			continue
+		}
+		mention.UserID = userID
+		resolved = append(resolved, mention)
+	}
+	if len(resolved) == 0 {
+		return nil
+	}
+	return resolved
+}
+
+// indexEntities adds a chirp to the mention and hashtag indexes. Each user
+// or tag is indexed once per chirp however often it appears.
+func (dbStructure *DBStructure) indexEntities(chirp Chirp, at time.Time) {
+	seen := map[int]bool{}
+	for _, mention := range chirp.Mentions {
+		if seen[mention.UserID] {
+			continue
+		}
+		seen[mention.UserID] = true
+		dbStructure.MentionChirps[mention.UserID] = insertSorted(dbStructure.MentionChirps[mention.UserID], chirp.ID)
+	}
+	for _, tag := range chirpTags(chirp) {
+		// New chirps go on the end; edited ones go back in their old place.
+		uses := dbStructure.Hashtags[tag]
+		i := sort.Search(len(uses), func(i int) bool { return uses[i].ChirpID >= chirp.ID })
+		dbStructure.Hashtags[tag] = slices.Insert(uses, i, TagUse{ChirpID: chirp.ID, At: at})
+	}
+}
+
+// unindexEntities removes a deleted chirp from the mention and hashtag
+// indexes.
+func (dbStructure *DBStructure) unindexEntities(chirp Chirp) {
+	for _, mention := range chirp.Mentions {
+		ids := removeSorted(dbStructure.MentionChirps[mention.UserID], chirp.ID)
+		if len(ids) == 0 {
+			delete(dbStructure.MentionChirps, mention.UserID)
+			continue
+		}
+		dbStructure.MentionChirps[mention.UserID] = ids
+	}
+	for _, tag := range chirpTags(chirp) {
+		uses := dbStructure.Hashtags[tag]
+		i := sort.Search(len(uses), func(i int) bool { return uses[i].ChirpID >= chirp.ID })
+		if i < len(uses) && uses[i].ChirpID == chirp.ID {
+			uses = append(uses[:i], uses[i+1:]...)
+		}
+		if len(uses) == 0 {
+			delete(dbStructure.Hashtags, tag)
+			continue
+		}
+		dbStructure.Hashtags[tag] = uses
+	}
+}
+
+func chirpTags(chirp Chirp) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, hashtag := range chirp.Hashtags {
+		if !seen[hashtag.Tag] {
+			seen[hashtag.Tag] = true
+			tags = append(tags, hashtag.Tag)
+		}
+	}
+	return tags
+}
+
+// GetHashtagChirps returns up to limit chirps using the tag that are listed
+// for the viewer, newest first, with IDs below maxID when maxID is positive.
+func (db *DB) GetHashtagChirps(tag string, maxID, limit, viewerID int) ([]Chirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	uses := dbStructure.Hashtags[strings.ToLower(tag)]
+	end := len(uses)
+	if maxID > 0 {
+		end = sort.Search(len(uses), func(i int) bool { return uses[i].ChirpID >= maxID })
+	}
+	chirps := make([]Chirp, 0, limit)
+	for i := end - 1; i >= 0 && len(chirps) < limit; i-- {
+		if chirp, ok := dbStructure.listedChirp(uses[i].ChirpID, viewerID); ok {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return chirps, nil
+}
+
+// GetMentions returns up to limit chirps mentioning the user, newest
+// first, with IDs below maxID when maxID is positive.
+func (db *DB) GetMentions(userID, maxID, limit int) ([]Chirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	ids := dbStructure.MentionChirps[userID]
+	end := len(ids)
+	if maxID > 0 {
+		end = sort.SearchInts(ids, maxID)
+	}
+	chirps := make([]Chirp, 0, limit)
+	for i := end - 1; i >= 0 && len(chirps) < limit; i-- {
+		if chirp, ok := dbStructure.feedChirp(ids[i], userID); ok {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return chirps, nil
+}
+
+// TrendingHashtags counts how many chirps listed for everyone used each
+// hashtag since the given time and returns the limit most used, ties broken
+// alphabetically.
+func (db *DB) TrendingHashtags(since time.Time, limit int) ([]TrendingHashtag, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	trending := []TrendingHashtag{}
+	for tag, uses := range dbStructure.Hashtags {
+		// Uses are in chirp ID order, which is also the order chirps were posted.
+		start := sort.Search(len(uses), func(i int) bool { return !uses[i].At.Before(since) })
+		count := 0
+		for _, use := range uses[start:] {
+			chirp, ok := dbStructure.Chirps[use.ChirpID]
+			if ok && dbStructure.listedFor(chirp, 0) {
+				count++
+			}
+		}
+		if count > 0 {
+			trending = append(trending, TrendingHashtag{Tag: tag, Count: count})
+		}
+	}
+	sort.Slice(trending, func(i, j int) bool {
+		if trending[i].Count != trending[j].Count {
+			return trending[i].Count > trending[j].Count
+		}
+		return trending[i].Tag < trending[j].Tag
+	})
+	if len(trending) > limit {
+		trending = trending[:limit]
+	}
+	return trending, nil
+}
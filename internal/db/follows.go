@@ -0,0 +1,174 @@
+package database
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"time"
+)
+
+// FollowEdge is one side of a follow relationship, for listing followers
+// or followed accounts.
+type FollowEdge struct {
+	UserID int       `json:"user_id"`
+	Since  time.Time `json:"since"`
+}
+
+func (db *DB) Follow(followerID, followeeID int) error {
+	if followerID == followeeID {
+		return errors.New("users can't follow themselves")
+	}
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[followerID]; !ok {
+			return errors.New("User not found")
+		}
+		if _, ok := dbStructure.Users[followeeID]; !ok {
+			return errors.New("User not found")
+		}
+		if _, ok := dbStructure.Following[followerID][followeeID]; ok {
+			return nil
+		}
+		if dbStructure.blocked(followerID, followeeID) {
+			return ErrBlocked
+		}
+
+		now := time.Now().UTC()
+		if dbStructure.Following[followerID] == nil {
+			dbStructure.Following[followerID] = map[int]time.Time{}
+		}
+		if dbStructure.Followers[followeeID] == nil {
+			dbStructure.Followers[followeeID] = map[int]time.Time{}
+		}
+		dbStructure.Following[followerID][followeeID] = now
+		dbStructure.Followers[followeeID][followerID] = now
+		return nil
+	})
+}
+
+func (db *DB) Unfollow(followerID, followeeID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Following[followerID][followeeID]; ok {
+			removeFollow(dbStructure, followerID, followeeID)
+		}
+		return nil
+	})
+}
+
+func removeFollow(dbStructure *DBStructure, followerID, followeeID int) {
+	delete(dbStructure.Following[followerID], followeeID)
+	if len(dbStructure.Following[followerID]) == 0 {
+		delete(dbStructure.Following, followerID)
+	}
+	delete(dbStructure.Followers[followeeID], followerID)
+	if len(dbStructure.Followers[followeeID]) == 0 {
+		delete(dbStructure.Followers, followeeID)
+	}
+}
+
+func (db *DB) IsFollowing(followerID, followeeID int) (bool, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return false, err
+	}
+	_, ok := dbStructure.Following[followerID][followeeID]
+	return ok, nil
+}
+
+// GetFollowers lists who follows the user, most recent first.
+func (db *DB) GetFollowers(userID int) ([]FollowEdge, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	return sortedEdges(dbStructure.Followers[userID]), nil
+}
+
+// GetFollowing lists who the user follows, most recent first.
+func (db *DB) GetFollowing(userID int) ([]FollowEdge, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	return sortedEdges(dbStructure.Following[userID]), nil
+}
+
+func sortedEdges(edges map[int]time.Time) []FollowEdge {
+	sorted := make([]FollowEdge, 0, len(edges))
+	for userID, since := range edges {
+		sorted = append(sorted, FollowEdge{UserID: userID, Since: since})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Since.Equal(sorted[j].Since) {
+			return sorted[i].UserID < sorted[j].UserID
+		}
+		return sorted[i].Since.After(sorted[j].Since)
+	})
+	return sorted
+}
+
+// GetTimeline returns up to limit chirps by accounts the user follows,
+// newest first, with IDs below maxID when maxID is positive.
+//
+// Each author's chirp IDs are kept in ascending order, so this merges the
+// tails of the followed authors' lists instead of scanning every chirp.
+// The cost is O(limit * log(following)) regardless of how many chirps
+// exist.
+func (db *DB) GetTimeline(userID, maxID, limit int) ([]Chirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	cursors := &chirpCursors{}
+	for followeeID := range dbStructure.Following[userID] {
+		ids := dbStructure.AuthorChirps[followeeID]
+		end := len(ids)
+		if maxID > 0 {
+			end = sort.SearchInts(ids, maxID)
+		}
+		if end > 0 {
+			*cursors = append(*cursors, chirpCursor{ids: ids, pos: end - 1})
+		}
+	}
+	heap.Init(cursors)
+
+	chirps := make([]Chirp, 0, limit)
+	for cursors.Len() > 0 && len(chirps) < limit {
+		cursor := &(*cursors)[0]
+		chirp, ok := dbStructure.feedChirp(cursor.ids[cursor.pos], userID)
+		if ok {
+			chirps = append(chirps, chirp)
+		}
+		if cursor.pos == 0 {
+			heap.Pop(cursors)
+			continue
+		}
+		cursor.pos--
+		heap.Fix(cursors, 0)
+	}
+	return chirps, nil
+}
+
+// chirpCursor walks one author's ascending chirp IDs from the end.
+type chirpCursor struct {
+	ids []int
+	pos int
+}
+
+// chirpCursors is a max-heap of cursors ordered by their current chirp ID.
+type chirpCursors []chirpCursor
+
+func (c chirpCursors) Len() int           { return len(c) }
+func (c chirpCursors) Less(i, j int) bool { return c[i].ids[c[i].pos] > c[j].ids[c[j].pos] }
+func (c chirpCursors) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+func (c *chirpCursors) Push(x interface{}) {
+	*c = append(*c, x.(chirpCursor))
+}
+
+func (c *chirpCursors) Pop() interface{} {
+	old := *c
+	last := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// Identity links an account at an external OpenID Connect provider to a
+// Chirpy user.
+type Identity struct {
+	Issuer   string    `json:"issuer"`
+	Subject  string    `json:"subject"`
+	UserID   int       `json:"user_id"`
+	Email    string    `json:"email"`
+	DateMade time.Time `json:"date_made"`
+}
+
+// OIDCLogin is an in-flight sign-in with an external provider, keyed by the
+// hash of the state parameter sent to the provider.
+type OIDCLogin struct {
+	StateHash      string    `json:"state_hash"`
+	Provider       string    `json:"provider"`
+	Nonce          string    `json:"nonce"`
+	CodeVerifier   string    `json:"code_verifier"`
+	ExpirationDate time.Time `json:"expiration_date"`
+}
+
+func identityKey(issuer, subject string) string {
+	return issuer + " " + subject
+}
+
+func (db *DB) GetUserByIdentity(issuer, subject string) (User, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+	identity, ok := dbStructure.Identities[identityKey(issuer, subject)]
+	if !ok {
+		return User{}, errors.New("identity not found")
+	}
+	user, ok := dbStructure.Users[identity.UserID]
+	if !ok {
+		return User{}, errors.New("User not found")
+	}
+	return user, nil
+}
+
+func (db *DB) LinkIdentity(identity Identity) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[identity.UserID]; !ok {
+			return errors.New("User not found")
+		}
+		key := identityKey(identity.Issuer, identity.Subject)
+		if _, ok := dbStructure.Identities[key]; ok {
+			return errors.New("identity already linked")
+		}
+		identity.DateMade = time.Now().UTC()
+		dbStructure.Identities[key] = identity
+		return nil
+	})
+}
+
+func (db *DB) StoreOIDCLogin(login OIDCLogin) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		now := time.Now().UTC()
+		for hash, stored := range dbStructure.OIDCLogins {
+			if now.After(stored.ExpirationDate) {
+				delete(dbStructure.OIDCLogins, hash)
+			}
+		}
+		dbStructure.OIDCLogins[login.StateHash] = login
+		return nil
+	})
+}
+
+// ConsumeOIDCLogin returns the pending login and deletes it so a state value
+// can't be replayed.
+func (db *DB) ConsumeOIDCLogin(stateHash string) (OIDCLogin, error) {
+	var login OIDCLogin
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		login, ok = dbStructure.OIDCLogins[stateHash]
+		if !ok {
+			return errors.New("login not found")
+		}
+		delete(dbStructure.OIDCLogins, stateHash)
+		return nil
+	})
+	if err != nil {
+		return OIDCLogin{}, err
+	}
+	if time.Now().UTC().After(login.ExpirationDate) {
+		return OIDCLogin{}, errors.New("login expired")
+	}
+	return login, nil
+}
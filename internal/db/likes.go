@@ -0,0 +1,128 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// LikedChirp is a chirp the user has liked, with when they liked it.
+type LikedChirp struct {
+	Chirp   Chirp
+	LikedAt time.Time
+}
+
+// Like records that the user likes the chirp and returns the chirp with its
+// updated count. Liking a chirp twice has no further effect, and liking a
+// rechirp likes the original.
+func (db *DB) Like(userID, chirpID int) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.visibleOriginal(chirpID, userID)
+		if !ok {
+			return ErrChirpNotFound
+		}
+		chirpID = chirp.ID
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return errors.New("User not found")
+		}
+		if _, liked := dbStructure.Likes[chirpID][userID]; liked {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		if dbStructure.Likes[chirpID] == nil {
+			dbStructure.Likes[chirpID] = map[int]time.Time{}
+		}
+		if dbStructure.UserLikes[userID] == nil {
+			dbStructure.UserLikes[userID] = map[int]time.Time{}
+		}
+		dbStructure.Likes[chirpID][userID] = now
+		dbStructure.UserLikes[userID][chirpID] = now
+		chirp.LikeCount++
+		dbStructure.Chirps[chirpID] = chirp
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// Unlike removes the user's like from the chirp and returns the chirp with
+// its updated count. Unliking a chirp that isn't liked has no effect.
+func (db *DB) Unlike(userID, chirpID int) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.original(chirpID)
+		if !ok {
+			return errors.New("chirp not found")
+		}
+		chirpID = chirp.ID
+		if _, liked := dbStructure.Likes[chirpID][userID]; !liked {
+			return nil
+		}
+		dbStructure.removeLike(userID, chirpID)
+		chirp = dbStructure.Chirps[chirpID]
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// removeLike drops a like from both indexes and from the chirp's count.
+func (dbStructure *DBStructure) removeLike(userID, chirpID int) {
+	delete(dbStructure.Likes[chirpID], userID)
+	if len(dbStructure.Likes[chirpID]) == 0 {
+		delete(dbStructure.Likes, chirpID)
+	}
+	delete(dbStructure.UserLikes[userID], chirpID)
+	if len(dbStructure.UserLikes[userID]) == 0 {
+		delete(dbStructure.UserLikes, userID)
+	}
+	if chirp, ok := dbStructure.Chirps[chirpID]; ok && chirp.LikeCount > 0 {
+		chirp.LikeCount--
+		dbStructure.Chirps[chirpID] = chirp
+	}
+}
+
+// GetLikedChirps lists the chirps the user has liked, most recently liked
+// first.
+func (db *DB) GetLikedChirps(userID int) ([]LikedChirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	liked := make([]LikedChirp, 0, len(dbStructure.UserLikes[userID]))
+	for chirpID, likedAt := range dbStructure.UserLikes[userID] {
+		chirp, ok := dbStructure.visibleChirp(chirpID, userID)
+		if !ok {
+			continue
+		}
+		liked = append(liked, LikedChirp{Chirp: chirp, LikedAt: likedAt})
+	}
+	sort.Slice(liked, func(i, j int) bool {
+		if liked[i].LikedAt.Equal(liked[j].LikedAt) {
+			return liked[i].Chirp.ID > liked[j].Chirp.ID
+		}
+		return liked[i].LikedAt.After(liked[j].LikedAt)
+	})
+	return liked, nil
+}
+
+// GetLikedBy reports which of the given chirps the user has liked.
+func (db *DB) GetLikedBy(userID int, chirpIDs []int) (map[int]bool, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	liked := make(map[int]bool, len(chirpIDs))
+	for _, id := range chirpIDs {
+		_, liked[id] = dbStructure.UserLikes[userID][id]
+	}
+	return liked, nil
+}
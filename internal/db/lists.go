@@ -0,0 +1,331 @@
+package database
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrListNotFound = errors.New("list not found")
+	ErrListFull     = errors.New("list has too many members")
+	ErrTooManyLists = errors.New("user has too many lists")
+)
+
+// List is a named set of accounts curated by its owner, whose chirps make
+// up their own timeline. Private lists are only visible to their owner;
+// anyone can see and follow a public one.
+type List struct {
+	ID          int       `json:"id"`
+	OwnerID     int       `json:"owner_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Private     bool      `json:"private"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ListStats are the counts shown with a list.
+type ListStats struct {
+	Members   int
+	Followers int
+	// FollowedByViewer is whether the viewer follows the list.
+	FollowedByViewer bool
+}
+
+// CreateList stores a new list, as long as the owner has fewer than
+// maxLists already.
+func (db *DB) CreateList(list List, maxLists int) (List, error) {
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[list.OwnerID]; !ok {
+			return errors.New("User not found")
+		}
+		owned := 0
+		for _, existing := range dbStructure.Lists {
+			if existing.OwnerID == list.OwnerID {
+				owned++
+			}
+		}
+		if owned >= maxLists {
+			return ErrTooManyLists
+		}
+		dbStructure.LastListID++
+		list.ID = dbStructure.LastListID
+		list.CreatedAt = time.Now().UTC()
+		list.UpdatedAt = list.CreatedAt
+		dbStructure.Lists[list.ID] = list
+		return nil
+	})
+	if err != nil {
+		return List{}, err
+	}
+	return list, nil
+}
+
+// UpdateList changes the name, description and privacy of one of the
+// owner's lists. Making a list private drops everyone but the owner from
+// its followers.
+func (db *DB) UpdateList(list List) (List, error) {
+	err := db.update(func(dbStructure *DBStructure) error {
+		existing, ok := dbStructure.Lists[list.ID]
+		if !ok || existing.OwnerID != list.OwnerID {
+			return ErrListNotFound
+		}
+		existing.Name = list.Name
+		existing.Description = list.Description
+		existing.Private = list.Private
+		existing.UpdatedAt = time.Now().UTC()
+		dbStructure.Lists[list.ID] = existing
+		if existing.Private {
+			for followerID := range dbStructure.ListFollowers[list.ID] {
+				if followerID != existing.OwnerID {
+					removeEdge(dbStructure.ListFollowers, list.ID, followerID)
+				}
+			}
+		}
+		list = existing
+		return nil
+	})
+	if err != nil {
+		return List{}, err
+	}
+	return list, nil
+}
+
+func (db *DB) DeleteList(id, ownerID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		list, ok := dbStructure.Lists[id]
+		if !ok || list.OwnerID != ownerID {
+			return ErrListNotFound
+		}
+		dbStructure.deleteList(id)
+		return nil
+	})
+}
+
+func (dbStructure *DBStructure) deleteList(id int) {
+	delete(dbStructure.Lists, id)
+	delete(dbStructure.ListMembers, id)
+	delete(dbStructure.ListFollowers, id)
+}
+
+// visibleList returns a list if viewerID may see it: private lists are
+// only visible to their owner.
+func (dbStructure *DBStructure) visibleList(id, viewerID int) (List, bool) {
+	list, ok := dbStructure.Lists[id]
+	if !ok || (list.Private && list.OwnerID != viewerID) {
+		return List{}, false
+	}
+	return list, true
+}
+
+// GetList returns a list the viewer may see along with its counts.
+// viewerID is 0 for anonymous requests.
+func (db *DB) GetList(id, viewerID int) (List, ListStats, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return List{}, ListStats{}, err
+	}
+	list, ok := dbStructure.visibleList(id, viewerID)
+	if !ok {
+		return List{}, ListStats{}, ErrListNotFound
+	}
+	return list, dbStructure.listStats(id, viewerID), nil
+}
+
+func (dbStructure *DBStructure) listStats(id, viewerID int) ListStats {
+	_, following := dbStructure.ListFollowers[id][viewerID]
+	return ListStats{
+		Members:          len(dbStructure.ListMembers[id]),
+		Followers:        len(dbStructure.ListFollowers[id]),
+		FollowedByViewer: following,
+	}
+}
+
+// ListWithStats is a list together with its counts.
+type ListWithStats struct {
+	List  List
+	Stats ListStats
+}
+
+// GetUserLists lists the lists a user owns that the viewer may see,
+// oldest first.
+func (db *DB) GetUserLists(ownerID, viewerID int) ([]ListWithStats, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	lists := []ListWithStats{}
+	for id, list := range dbStructure.Lists {
+		if list.OwnerID != ownerID {
+			continue
+		}
+		if _, ok := dbStructure.visibleList(id, viewerID); ok {
+			lists = append(lists, ListWithStats{List: list, Stats: dbStructure.listStats(id, viewerID)})
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		return lists[i].List.ID < lists[j].List.ID
+	})
+	return lists, nil
+}
+
+// GetFollowedLists lists the lists a user follows, most recently followed
+// first.
+func (db *DB) GetFollowedLists(userID int) ([]ListWithStats, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	followed := map[int]time.Time{}
+	for listID, followers := range dbStructure.ListFollowers {
+		if since, ok := followers[userID]; ok {
+			followed[listID] = since
+		}
+	}
+	lists := make([]ListWithStats, 0, len(followed))
+	for _, edge := range sortedEdges(followed) {
+		list, ok := dbStructure.visibleList(edge.UserID, userID)
+		if ok {
+			lists = append(lists, ListWithStats{List: list, Stats: dbStructure.listStats(list.ID, userID)})
+		}
+	}
+	return lists, nil
+}
+
+// AddListMember adds a user to one of the owner's lists. Adding someone
+// already on it has no effect. Users in a block with the owner can't be
+// added.
+func (db *DB) AddListMember(listID, ownerID, memberID, maxMembers int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		list, ok := dbStructure.Lists[listID]
+		if !ok || list.OwnerID != ownerID {
+			return ErrListNotFound
+		}
+		if _, ok := dbStructure.Users[memberID]; !ok {
+			return errors.New("User not found")
+		}
+		if dbStructure.blocked(ownerID, memberID) {
+			return ErrBlocked
+		}
+		if _, ok := dbStructure.ListMembers[listID][memberID]; ok {
+			return nil
+		}
+		if len(dbStructure.ListMembers[listID]) >= maxMembers {
+			return ErrListFull
+		}
+		if dbStructure.ListMembers[listID] == nil {
+			dbStructure.ListMembers[listID] = map[int]time.Time{}
+		}
+		dbStructure.ListMembers[listID][memberID] = time.Now().UTC()
+		return nil
+	})
+}
+
+func (db *DB) RemoveListMember(listID, ownerID, memberID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		list, ok := dbStructure.Lists[listID]
+		if !ok || list.OwnerID != ownerID {
+			return ErrListNotFound
+		}
+		removeEdge(dbStructure.ListMembers, listID, memberID)
+		return nil
+	})
+}
+
+// GetListMembers lists the members of a list the viewer may see, most
+// recently added first.
+func (db *DB) GetListMembers(listID, viewerID int) ([]FollowEdge, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := dbStructure.visibleList(listID, viewerID); !ok {
+		return nil, ErrListNotFound
+	}
+	return sortedEdges(dbStructure.ListMembers[listID]), nil
+}
+
+// FollowList adds a public list to the user's followed lists. Owners can
+// follow their own lists, private or not.
+func (db *DB) FollowList(listID, userID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.visibleList(listID, userID); !ok {
+			return ErrListNotFound
+		}
+		if _, ok := dbStructure.ListFollowers[listID][userID]; ok {
+			return nil
+		}
+		if dbStructure.ListFollowers[listID] == nil {
+			dbStructure.ListFollowers[listID] = map[int]time.Time{}
+		}
+		dbStructure.ListFollowers[listID][userID] = time.Now().UTC()
+		return nil
+	})
+}
+
+func (db *DB) UnfollowList(listID, userID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		removeEdge(dbStructure.ListFollowers, listID, userID)
+		return nil
+	})
+}
+
+// GetListTimeline returns up to limit chirps by a list's members, newest
+// first, with IDs below maxID when maxID is positive. It merges the
+// members' chirps the same way GetTimeline does, filtered for the viewer.
+func (db *DB) GetListTimeline(listID, viewerID, maxID, limit int) ([]Chirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := dbStructure.visibleList(listID, viewerID); !ok {
+		return nil, ErrListNotFound
+	}
+
+	cursors := &chirpCursors{}
+	for memberID := range dbStructure.ListMembers[listID] {
+		ids := dbStructure.AuthorChirps[memberID]
+		end := len(ids)
+		if maxID > 0 {
+			end = sort.SearchInts(ids, maxID)
+		}
+		if end > 0 {
+			*cursors = append(*cursors, chirpCursor{ids: ids, pos: end - 1})
+		}
+	}
+	heap.Init(cursors)
+
+	chirps := make([]Chirp, 0, limit)
+	for cursors.Len() > 0 && len(chirps) < limit {
+		cursor := &(*cursors)[0]
+		chirp, ok := dbStructure.feedChirp(cursor.ids[cursor.pos], viewerID)
+		if ok {
+			chirps = append(chirps, chirp)
+		}
+		if cursor.pos == 0 {
+			heap.Pop(cursors)
+			continue
+		}
+		cursor.pos--
+		heap.Fix(cursors, 0)
+	}
+	return chirps, nil
+}
+
+// removeUserLists deletes a user's lists and takes them off everyone
+// else's.
+func (dbStructure *DBStructure) removeUserLists(userID int) {
+	for id, list := range dbStructure.Lists {
+		if list.OwnerID == userID {
+			dbStructure.deleteList(id)
+		}
+	}
+	for listID := range dbStructure.ListMembers {
+		removeEdge(dbStructure.ListMembers, listID, userID)
+	}
+	for listID := range dbStructure.ListFollowers {
+		removeEdge(dbStructure.ListFollowers, listID, userID)
+	}
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+var ErrMediaNotFound = errors.New("attachment not found")
+
+// Media is an uploaded image. It belongs to its uploader until it's
+// attached to one of their chirps or drafts, after which it lives and dies
+// with that. Key and ThumbnailKey name the files in the blob store.
+type Media struct {
+	ID              string    `json:"id"`
+	OwnerID         int       `json:"owner_id"`
+	ContentType     string    `json:"content_type"`
+	Key             string    `json:"key"`
+	Width           int       `json:"width"`
+	Height          int       `json:"height"`
+	Size            int       `json:"size"`
+	ThumbnailKey    string    `json:"thumbnail_key"`
+	ThumbnailWidth  int       `json:"thumbnail_width"`
+	ThumbnailHeight int       `json:"thumbnail_height"`
+	CreatedAt       time.Time `json:"created_at"`
+	// ChirpID, HeldChirpID or DraftID is set once the media is attached.
+	ChirpID     int `json:"chirp_id,omitempty"`
+	HeldChirpID int `json:"held_chirp_id,omitempty"`
+	DraftID     int `json:"draft_id,omitempty"`
+}
+
+func (db *DB) CreateMedia(media Media) (Media, error) {
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[media.OwnerID]; !ok {
+			return errors.New("User not found")
+		}
+		media.CreatedAt = time.Now().UTC()
+		media.ChirpID = 0
+		media.HeldChirpID = 0
+		media.DraftID = 0
+		dbStructure.Media[media.ID] = media
+		return nil
+	})
+	if err != nil {
+		return Media{}, err
+	}
+	return media, nil
+}
+
+// GetMedia returns whichever of the given media still exist.
+func (db *DB) GetMedia(ids []string) (map[string]Media, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	media := make(map[string]Media, len(ids))
+	for _, id := range ids {
+		if item, ok := dbStructure.Media[id]; ok {
+			media[id] = item
+		}
+	}
+	return media, nil
+}
+
+// checkAttachments makes sure every attachment was uploaded by the author
+// and isn't on another chirp already. Media on the draft with ID draftID
+// may be reused; pass 0 when there's no draft.
+func (dbStructure *DBStructure) checkAttachments(authorID int, ids []string, draftID int) error {
+	for i, id := range ids {
+		media, ok := dbStructure.Media[id]
+		if !ok || media.OwnerID != authorID || media.ChirpID != 0 || media.HeldChirpID != 0 || media.DraftID != draftID {
+			return ErrMediaNotFound
+		}
+		if slices.Contains(ids[:i], id) {
+			return ErrMediaNotFound
+		}
+	}
+	return nil
+}
+
+// attachMedia links attachments to whichever one of a chirp, held chirp
+// or draft has a non-zero ID. Passing all zeros detaches them.
+func (dbStructure *DBStructure) attachMedia(ids []string, chirpID, heldChirpID, draftID int) {
+	for _, id := range ids {
+		media, ok := dbStructure.Media[id]
+		if !ok {
+			continue
+		}
+		media.ChirpID = chirpID
+		media.HeldChirpID = heldChirpID
+		media.DraftID = draftID
+		dbStructure.Media[id] = media
+	}
+}
+
+// TakeUnusedMedia removes and returns media nothing needs any more, so
+// their files can be deleted: uploads older than maxAge that were never
+// attached, and attachments whose chirp, held chirp, draft or owner is
+// gone.
+func (db *DB) TakeUnusedMedia(maxAge time.Duration) ([]Media, error) {
+	unused := []Media{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		cutoff := time.Now().Add(-maxAge)
+		for id, media := range dbStructure.Media {
+			var keep bool
+			switch {
+			case media.ChirpID != 0:
+				_, keep = dbStructure.Chirps[media.ChirpID]
+			case media.HeldChirpID != 0:
+				_, keep = dbStructure.HeldChirps[media.HeldChirpID]
+			case media.DraftID != 0:
+				_, keep = dbStructure.Drafts[media.DraftID]
+			default:
+				_, keep = dbStructure.Users[media.OwnerID]
+				keep = keep && media.CreatedAt.After(cutoff)
+			}
+			if !keep {
+				unused = append(unused, media)
+				delete(dbStructure.Media, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unused, nil
+}
+
+// MediaAccess finds the media a blob key belongs to and reports whether the
+// viewer may fetch it, and whether anyone may. Attachments follow their
+// chirp's visibility. Anything not on a chirp yet is only for its owner,
+// and for moderators when it's on a held chirp. viewerID is 0 for
+// anonymous requests.
+func (db *DB) MediaAccess(key string, viewerID int, moderator bool) (visible, public bool, err error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return false, false, err
+	}
+	for _, media := range dbStructure.Media {
+		if media.Key != key && media.ThumbnailKey != key {
+			continue
+		}
+		if media.ChirpID != 0 {
+			chirp, ok := dbStructure.Chirps[media.ChirpID]
+			if !ok {
+				return false, false, nil
+			}
+			public = dbStructure.visibleTo(chirp, 0)
+			return dbStructure.visibleTo(chirp, viewerID), public, nil
+		}
+		if media.HeldChirpID != 0 && moderator {
+			return true, false, nil
+		}
+		return viewerID != 0 && media.OwnerID == viewerID, false, nil
+	}
+	return false, false, ErrMediaNotFound
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// migrations upgrade databases written by older versions. Each runs once,
+// in order, and DBStructure.SchemaVersion records how many have run. Unlike
+// initCollections, which fills in derivable data on every load, migrations
+// are for changes that must be written exactly once, such as backfilled
+// timestamps.
+var migrations = []func(dbStructure *DBStructure){
+	backfillTimestamps,
+}
+
+// migrate applies any migrations the database hasn't had yet.
+func (db *DB) migrate() error {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return err
+	}
+	if dbStructure.SchemaVersion >= len(migrations) {
+		return nil
+	}
+	return db.update(func(dbStructure *DBStructure) error {
+		for _, migration := range migrations[dbStructure.SchemaVersion:] {
+			migration(dbStructure)
+			dbStructure.SchemaVersion++
+		}
+		return nil
+	})
+}
+
+// backfillTimestamps gives chirps and users from before timestamps were
+// recorded a created_at. Their real times are unknown, so they're placed
+// just before the oldest recorded timestamp, a millisecond apart in ID
+// order, which keeps time order the same as ID order.
+func backfillTimestamps(dbStructure *DBStructure) {
+	oldest := time.Now().UTC()
+	for _, chirp := range dbStructure.Chirps {
+		if !chirp.CreatedAt.IsZero() && chirp.CreatedAt.Before(oldest) {
+			oldest = chirp.CreatedAt
+		}
+	}
+	for _, user := range dbStructure.Users {
+		if !user.CreatedAt.IsZero() && user.CreatedAt.Before(oldest) {
+			oldest = user.CreatedAt
+		}
+	}
+
+	chirpIDs := []int{}
+	for id, chirp := range dbStructure.Chirps {
+		if chirp.CreatedAt.IsZero() {
+			chirpIDs = append(chirpIDs, id)
+		}
+	}
+	sort.Ints(chirpIDs)
+	for i, id := range chirpIDs {
+		chirp := dbStructure.Chirps[id]
+		chirp.CreatedAt = oldest.Add(-time.Duration(len(chirpIDs)-i) * time.Millisecond)
+		dbStructure.Chirps[id] = chirp
+	}
+
+	userIDs := []int{}
+	for id, user := range dbStructure.Users {
+		if user.CreatedAt.IsZero() {
+			userIDs = append(userIDs, id)
+		}
+	}
+	sort.Ints(userIDs)
+	for i, id := range userIDs {
+		user := dbStructure.Users[id]
+		user.CreatedAt = oldest.Add(-time.Duration(len(userIDs)-i) * time.Millisecond)
+		dbStructure.Users[id] = user
+	}
+
+	for id, chirp := range dbStructure.Chirps {
+		if chirp.UpdatedAt.IsZero() {
+			chirp.UpdatedAt = chirp.CreatedAt
+			if !chirp.EditedAt.IsZero() {
+				chirp.UpdatedAt = chirp.EditedAt
+			}
+			dbStructure.Chirps[id] = chirp
+		}
+		if chirp.CreatedAt.After(dbStructure.LastChirpAt) {
+			dbStructure.LastChirpAt = chirp.CreatedAt
+		}
+	}
+	for id, user := range dbStructure.Users {
+		if user.UpdatedAt.IsZero() {
+			user.UpdatedAt = user.CreatedAt
+			dbStructure.Users[id] = user
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// ModerationRecord is the moderation decision made when a chirp was posted
+// or last edited.
+type ModerationRecord struct {
+	Action    string    `json:"action"`
+	Rules     []string  `json:"rules,omitempty"`
+	DecidedAt time.Time `json:"decided_at"`
+}
+
+// HeldChirp is a chirp moderation held back for review. It has its own ID
+// and only becomes a real chirp, with a chirp ID, once it's approved.
+type HeldChirp struct {
+	ID     int       `json:"id"`
+	Chirp  Chirp     `json:"chirp"`
+	HeldAt time.Time `json:"held_at"`
+}
+
+// HoldChirp stores a chirp for review instead of publishing it and opens a
+// report for it in the moderation queue. Replies, quotes and mentions are
+// checked and resolved as in CreateChirp.
+func (db *DB) HoldChirp(chirp Chirp) (HeldChirp, error) {
+	var held HeldChirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		var err error
+		held, err = dbStructure.holdChirp(chirp, 0)
+		return err
+	})
+	if err != nil {
+		return HeldChirp{}, err
+	}
+	return held, nil
+}
+
+// holdChirp is HoldChirp within an update. draftID is as for createChirp.
+func (dbStructure *DBStructure) holdChirp(chirp Chirp, draftID int) (HeldChirp, error) {
+	chirp, err := dbStructure.prepareChirp(chirp, draftID)
+	if err != nil {
+		return HeldChirp{}, err
+	}
+	dbStructure.LastHeldChirpID++
+	held := HeldChirp{
+		ID:     dbStructure.LastHeldChirpID,
+		Chirp:  chirp,
+		HeldAt: time.Now().UTC(),
+	}
+	dbStructure.HeldChirps[held.ID] = held
+	dbStructure.attachMedia(chirp.Attachments, 0, held.ID, 0)
+	dbStructure.reportHeldChirp(held)
+	return held, nil
+}
+
+func (db *DB) GetHeldChirp(id int) (HeldChirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return HeldChirp{}, err
+	}
+	held, ok := dbStructure.HeldChirps[id]
+	if !ok {
+		return HeldChirp{}, errors.New("held chirp not found")
+	}
+	return held, nil
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+type OAuthClient struct {
+	ID           string    `json:"id"`
+	SecretHash   string    `json:"secret_hash"`
+	Name         string    `json:"name"`
+	OwnerID      int       `json:"owner_id"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	DateMade     time.Time `json:"date_made"`
+}
+
+// OAuthCode is a pending authorization code, keyed by the hash of the code
+// handed to the client.
+type OAuthCode struct {
+	CodeHash            string    `json:"code_hash"`
+	ClientID            string    `json:"client_id"`
+	UserID              int       `json:"user_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	Scope               string    `json:"scope"`
+	CodeChallenge       string    `json:"code_challenge"`
+	CodeChallengeMethod string    `json:"code_challenge_method"`
+	ExpirationDate      time.Time `json:"expiration_date"`
+}
+
+// OAuthGrant is a refresh token issued to a third-party client, keyed by
+// the hash of the token.
+type OAuthGrant struct {
+	TokenHash      string    `json:"token_hash"`
+	ClientID       string    `json:"client_id"`
+	UserID         int       `json:"user_id"`
+	Scope          string    `json:"scope"`
+	DateMade       time.Time `json:"date_made"`
+	ExpirationDate time.Time `json:"expiration_date"`
+}
+
+func (c OAuthClient) IsConfidential() bool {
+	return c.SecretHash != ""
+}
+
+func (c OAuthClient) HasRedirectURI(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *DB) CreateOAuthClient(client OAuthClient) (OAuthClient, error) {
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.OAuthClients[client.ID]; ok {
+			return errors.New("client already exists")
+		}
+		client.DateMade = time.Now().UTC()
+		dbStructure.OAuthClients[client.ID] = client
+		return nil
+	})
+	if err != nil {
+		return OAuthClient{}, err
+	}
+	return client, nil
+}
+
+func (db *DB) GetOAuthClient(id string) (OAuthClient, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return OAuthClient{}, err
+	}
+	client, ok := dbStructure.OAuthClients[id]
+	if !ok {
+		return OAuthClient{}, errors.New("client not found")
+	}
+	return client, nil
+}
+
+func (db *DB) StoreAuthorizationCode(code OAuthCode) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		now := time.Now().UTC()
+		for hash, stored := range dbStructure.OAuthCodes {
+			if now.After(stored.ExpirationDate) {
+				delete(dbStructure.OAuthCodes, hash)
+			}
+		}
+		dbStructure.OAuthCodes[code.CodeHash] = code
+		return nil
+	})
+}
+
+// ConsumeAuthorizationCode returns the code and deletes it so that it can
+// only be exchanged once. Looking it up and deleting it happen under one
+// lock, so of two concurrent exchanges only one gets the code.
+func (db *DB) ConsumeAuthorizationCode(codeHash string) (OAuthCode, error) {
+	var code OAuthCode
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		code, ok = dbStructure.OAuthCodes[codeHash]
+		if !ok {
+			return errors.New("authorization code not found")
+		}
+		if time.Now().UTC().After(code.ExpirationDate) {
+			// Expired codes are pruned by StoreAuthorizationCode.
+			return errors.New("authorization code expired")
+		}
+		delete(dbStructure.OAuthCodes, codeHash)
+		return nil
+	})
+	if err != nil {
+		return OAuthCode{}, err
+	}
+	return code, nil
+}
+
+func (db *DB) StoreOAuthGrant(grant OAuthGrant) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		dbStructure.OAuthGrants[grant.TokenHash] = grant
+		return nil
+	})
+}
+
+func (db *DB) GetOAuthGrant(tokenHash string) (OAuthGrant, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return OAuthGrant{}, err
+	}
+	grant, ok := dbStructure.OAuthGrants[tokenHash]
+	if !ok {
+		return OAuthGrant{}, errors.New("grant not found")
+	}
+	if time.Now().UTC().After(grant.ExpirationDate) {
+		return OAuthGrant{}, errors.New("grant expired")
+	}
+	return grant, nil
+}
+
+// ConsumeOAuthGrant returns an unexpired grant and deletes it, so a refresh
+// token can only be rotated once even when two requests race to use it.
+func (db *DB) ConsumeOAuthGrant(tokenHash string) (OAuthGrant, error) {
+	var grant OAuthGrant
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		grant, ok = dbStructure.OAuthGrants[tokenHash]
+		if !ok {
+			return errors.New("grant not found")
+		}
+		if time.Now().UTC().After(grant.ExpirationDate) {
+			return errors.New("grant expired")
+		}
+		delete(dbStructure.OAuthGrants, tokenHash)
+		return nil
+	})
+	if err != nil {
+		return OAuthGrant{}, err
+	}
+	return grant, nil
+}
+
+func (db *DB) DeleteOAuthGrant(tokenHash string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.OAuthGrants[tokenHash]; !ok {
+			return errors.New("grant not found")
+		}
+		delete(dbStructure.OAuthGrants, tokenHash)
+		return nil
+	})
+}
+
+// RevokeAccessToken records the token ID until the token would have expired
+// anyway.
+func (db *DB) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		now := time.Now().UTC()
+		for id, exp := range dbStructure.RevokedTokens {
+			if now.After(exp) {
+				delete(dbStructure.RevokedTokens, id)
+			}
+		}
+		dbStructure.RevokedTokens[jti] = expiresAt
+		return nil
+	})
+}
+
+func (db *DB) IsAccessTokenRevoked(jti string) bool {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return true
+	}
+	_, ok := dbStructure.RevokedTokens[jti]
+	return ok
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestConsumeAuthorizationCode(t *testing.T) {
+	db := newTestDB(t)
+	err := db.StoreAuthorizationCode(OAuthCode{
+		CodeHash:       "live",
+		ClientID:       "client",
+		UserID:         1,
+		ExpirationDate: time.Now().UTC().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.StoreAuthorizationCode(OAuthCode{
+		CodeHash:       "expired",
+		ExpirationDate: time.Now().UTC().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Several exchanges of the same code race; exactly one may win.
+	const attempts = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	consumed := 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, err := db.ConsumeAuthorizationCode("live")
+			if err != nil {
+				return
+			}
+			if code.ClientID != "client" || code.UserID != 1 {
+				t.Errorf("got code %+v", code)
+			}
+			mu.Lock()
+			consumed++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if consumed != 1 {
+		t.Errorf("code was exchanged %d times, want 1", consumed)
+	}
+
+	tests := []struct {
+		name     string
+		codeHash string
+	}{
+		{"already used", "live"},
+		{"expired", "expired"},
+		{"unknown", "missing"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := db.ConsumeAuthorizationCode(tc.codeHash)
+			if err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestConsumeOAuthGrant(t *testing.T) {
+	db := newTestDB(t)
+	for _, grant := range []OAuthGrant{
+		{TokenHash: "live", ClientID: "client", UserID: 1, ExpirationDate: time.Now().UTC().Add(time.Hour)},
+		{TokenHash: "expired", ClientID: "client", UserID: 1, ExpirationDate: time.Now().UTC().Add(-time.Hour)},
+	} {
+		err := db.StoreOAuthGrant(grant)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Refresh tokens rotate on use, so only one of several racing
+	// refreshes may consume the grant.
+	const attempts = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	consumed := 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.ConsumeOAuthGrant("live")
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			consumed++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if consumed != 1 {
+		t.Errorf("grant was consumed %d times, want 1", consumed)
+	}
+
+	_, err := db.GetOAuthGrant("live")
+	if err == nil {
+		t.Error("consumed grant can still be looked up")
+	}
+	_, err = db.ConsumeOAuthGrant("expired")
+	if err == nil {
+		t.Error("expired grant was consumed")
+	}
+	_, err = db.GetOAuthGrant("expired")
+	if err == nil {
+		t.Error("expired grant can be looked up")
+	}
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	db := newTestDB(t)
+	err := db.RevokeAccessToken("old", time.Now().UTC().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.RevokeAccessToken("current", time.Now().UTC().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.IsAccessTokenRevoked("current") {
+		t.Error("revoked token isn't reported as revoked")
+	}
+	if db.IsAccessTokenRevoked("other") {
+		t.Error("unrelated token is reported as revoked")
+	}
+	// Revoking prunes entries for tokens that have expired anyway.
+	if db.IsAccessTokenRevoked("old") {
+		t.Error("expired revocation wasn't pruned")
+	}
+}
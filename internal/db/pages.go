@@ -0,0 +1,108 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// ChirpPageQuery selects one page of chirps ordered by ID.
+type ChirpPageQuery struct {
+	ByAuthor bool
+	AuthorID int
+	// SinceID and MaxID are exclusive ID bounds; zero means unbounded.
+	SinceID int
+	MaxID   int
+	// CreatedAfter and CreatedBefore are exclusive time bounds; zero means
+	// unbounded. Chirps without a creation time never match them.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Descending    bool
+	// Backward fetches the page that comes before the bounds in sort
+	// order, for paging back. The page itself is still in sort order.
+	Backward bool
+	Limit    int
+	// ViewerID is who the page is for, or 0 for anonymous requests.
+	ViewerID int
+}
+
+// GetChirpPage returns up to Limit chirps matching the query and whether
+// more exist beyond them in the direction walked.
+//
+// It walks chirp IDs outward from the bound instead of collecting and
+// sorting every chirp, so a page costs about Limit lookups. Creation times
+// follow IDs, so time filters are turned into ID bounds up front by binary
+// search. Author pages walk the author index.
+func (db *DB) GetChirpPage(query ChirpPageQuery) ([]Chirp, bool, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, false, err
+	}
+
+	lo, hi := query.SinceID+1, dbStructure.LastChirpID
+	if query.MaxID > 0 && query.MaxID-1 < hi {
+		hi = query.MaxID - 1
+	}
+	if !query.CreatedAfter.IsZero() {
+		lo = max(lo, dbStructure.firstChirpFrom(query.CreatedAfter))
+	}
+	if !query.CreatedBefore.IsZero() {
+		hi = min(hi, dbStructure.firstChirpFrom(query.CreatedBefore)-1)
+	}
+	ascending := query.Descending == query.Backward
+
+	chirps := make([]Chirp, 0, query.Limit)
+	more := false
+	visit := func(id int) bool {
+		chirp, ok := dbStructure.listedChirp(id, query.ViewerID)
+		if !ok || !chirpCreatedWithin(chirp, query.CreatedAfter, query.CreatedBefore) {
+			return true
+		}
+		if len(chirps) == query.Limit {
+			more = true
+			return false
+		}
+		chirps = append(chirps, chirp)
+		return true
+	}
+
+	if query.ByAuthor {
+		ids := dbStructure.AuthorChirps[query.AuthorID]
+		start, end := sort.SearchInts(ids, lo), sort.SearchInts(ids, hi+1)
+		if ascending {
+			for i := start; i < end && visit(ids[i]); i++ {
+			}
+		} else {
+			for i := end - 1; i >= start && visit(ids[i]); i-- {
+			}
+		}
+	} else if ascending {
+		for id := lo; id <= hi && visit(id); id++ {
+		}
+	} else {
+		for id := hi; id >= lo && visit(id); id-- {
+		}
+	}
+
+	if query.Backward {
+		for i, j := 0, len(chirps)-1; i < j; i, j = i+1, j-1 {
+			chirps[i], chirps[j] = chirps[j], chirps[i]
+		}
+	}
+	return chirps, more, nil
+}
+
+func chirpCreatedWithin(chirp Chirp, after, before time.Time) bool {
+	if after.IsZero() && before.IsZero() {
+		return true
+	}
+	if chirp.CreatedAt.IsZero() {
+		return false
+	}
+	if !after.IsZero() && !chirp.CreatedAt.After(after) {
+		return false
+	}
+	if !before.IsZero() && !chirp.CreatedAt.Before(before) {
+		return false
+	}
+	return true
+}
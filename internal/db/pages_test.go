@@ -0,0 +1,76 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChirpPageTimeFilters(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 2)
+	ids := createTestChirps(t, db, users[0], "one", "two")
+	ids = append(ids, createTestChirps(t, db, users[1], "three")...)
+	ids = append(ids, createTestChirps(t, db, users[0], "four", "five")...)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	spreadChirpTimes(t, db, start)
+
+	tests := []struct {
+		name     string
+		query    ChirpPageQuery
+		want     []int
+		wantMore bool
+	}{
+		{
+			"after is exclusive",
+			ChirpPageQuery{CreatedAfter: start.AddDate(0, 0, 2), Limit: 10},
+			[]int{ids[3], ids[4]},
+			false,
+		},
+		{
+			"before is exclusive",
+			ChirpPageQuery{CreatedBefore: start.AddDate(0, 0, 2), Descending: true, Limit: 10},
+			[]int{ids[1], ids[0]},
+			false,
+		},
+		{
+			"between, limited",
+			ChirpPageQuery{CreatedAfter: start, CreatedBefore: start.AddDate(0, 0, 4), Limit: 2},
+			[]int{ids[1], ids[2]},
+			true,
+		},
+		{
+			"between, by author",
+			ChirpPageQuery{ByAuthor: true, AuthorID: users[0], CreatedAfter: start, CreatedBefore: start.AddDate(0, 0, 4), Limit: 10},
+			[]int{ids[1], ids[3]},
+			false,
+		},
+		{
+			"with an ID bound",
+			ChirpPageQuery{SinceID: ids[2], CreatedAfter: start, Limit: 10},
+			[]int{ids[3], ids[4]},
+			false,
+		},
+		{
+			"empty range",
+			ChirpPageQuery{CreatedAfter: start.AddDate(0, 0, 3), CreatedBefore: start.AddDate(0, 0, 1), Limit: 10},
+			[]int{},
+			false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			chirps, more, err := db.GetChirpPage(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []int{}
+			for _, chirp := range chirps {
+				got = append(got, chirp.ID)
+			}
+			if !reflect.DeepEqual(got, tc.want) || more != tc.wantMore {
+				t.Errorf("got %v (more %v), want %v (more %v)", got, more, tc.want, tc.wantMore)
+			}
+		})
+	}
+}
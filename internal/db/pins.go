@@ -0,0 +1,64 @@
+package database
+
+import (
+	"errors"
+	"slices"
+)
+
+var (
+	ErrTooManyPins = errors.New("too many pinned chirps")
+	ErrCannotPin   = errors.New("only your own chirps can be pinned")
+)
+
+// PinChirp pins one of the user's chirps to the top of their profile,
+// ahead of any already pinned. Pinning a chirp again moves it to the
+// front. Rechirps can't be pinned.
+func (db *DB) PinChirp(userID, chirpID, maxPins int) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.visibleChirp(chirpID, userID)
+		if !ok {
+			return ErrChirpNotFound
+		}
+		if chirp.AuthorID != userID || chirp.RechirpOfID != 0 {
+			return ErrCannotPin
+		}
+		user, ok := dbStructure.Users[userID]
+		if !ok {
+			return errors.New("User not found")
+		}
+		pins := slices.DeleteFunc(slices.Clone(user.PinnedChirpIDs), func(id int) bool { return id == chirpID })
+		if len(pins) >= maxPins {
+			return ErrTooManyPins
+		}
+		user.PinnedChirpIDs = slices.Insert(pins, 0, chirpID)
+		dbStructure.Users[userID] = user
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// UnpinChirp takes a chirp off the user's profile. Unpinning a chirp that
+// isn't pinned has no effect.
+func (db *DB) UnpinChirp(userID, chirpID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		dbStructure.unpinChirp(userID, chirpID)
+		return nil
+	})
+}
+
+func (dbStructure *DBStructure) unpinChirp(userID, chirpID int) {
+	user, ok := dbStructure.Users[userID]
+	if !ok || !slices.Contains(user.PinnedChirpIDs, chirpID) {
+		return
+	}
+	user.PinnedChirpIDs = slices.DeleteFunc(slices.Clone(user.PinnedChirpIDs), func(id int) bool { return id == chirpID })
+	if len(user.PinnedChirpIDs) == 0 {
+		user.PinnedChirpIDs = nil
+	}
+	dbStructure.Users[userID] = user
+}
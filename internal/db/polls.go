@@ -0,0 +1,101 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoPoll            = errors.New("chirp has no poll")
+	ErrPollClosed        = errors.New("poll has closed")
+	ErrAlreadyVoted      = errors.New("you have already voted in this poll")
+	ErrInvalidPollOption = errors.New("poll has no such option")
+)
+
+// Poll is a question attached to a chirp. Votes are counted on each
+// option; PollVotes records who voted for which. Chirps hold a pointer to
+// their poll, so counts can be updated in place.
+type Poll struct {
+	Options  []PollOption `json:"options"`
+	ClosesAt time.Time    `json:"closes_at"`
+}
+
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+func (p *Poll) Closed(now time.Time) bool {
+	return !now.Before(p.ClosesAt)
+}
+
+// Vote records a user's vote for an option, by index, in a chirp's poll.
+// Voting through a rechirp votes in the original. Each user gets one vote,
+// which can't be changed.
+func (db *DB) Vote(userID, chirpID, option int) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.visibleOriginal(chirpID, userID)
+		if !ok {
+			return ErrChirpNotFound
+		}
+		if chirp.Poll == nil {
+			return ErrNoPoll
+		}
+		if chirp.Poll.Closed(time.Now()) {
+			return ErrPollClosed
+		}
+		if option < 0 || option >= len(chirp.Poll.Options) {
+			return ErrInvalidPollOption
+		}
+		if _, ok := dbStructure.PollVotes[chirp.ID][userID]; ok {
+			return ErrAlreadyVoted
+		}
+
+		if dbStructure.PollVotes[chirp.ID] == nil {
+			dbStructure.PollVotes[chirp.ID] = map[int]int{}
+		}
+		dbStructure.PollVotes[chirp.ID][userID] = option
+		chirp.Poll.Options[option].Votes++
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// GetPollVotes returns which option the user picked in each of the given
+// chirps' polls they voted in.
+func (db *DB) GetPollVotes(userID int, chirpIDs []int) (map[int]int, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	votes := map[int]int{}
+	for _, id := range chirpIDs {
+		if option, ok := dbStructure.PollVotes[id][userID]; ok {
+			votes[id] = option
+		}
+	}
+	return votes, nil
+}
+
+// removeVotes takes back a user's votes, for when their account goes.
+func (dbStructure *DBStructure) removeVotes(userID int) {
+	for chirpID, voters := range dbStructure.PollVotes {
+		option, ok := voters[userID]
+		if !ok {
+			continue
+		}
+		delete(voters, userID)
+		if len(voters) == 0 {
+			delete(dbStructure.PollVotes, chirpID)
+		}
+		chirp, ok := dbStructure.Chirps[chirpID]
+		if ok && chirp.Poll != nil && option < len(chirp.Poll.Options) {
+			chirp.Poll.Options[option].Votes--
+		}
+	}
+}
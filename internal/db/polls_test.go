@@ -0,0 +1,146 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func createTestPoll(t *testing.T, db *DB, authorID int, closesAt time.Time) Chirp {
+	t.Helper()
+	chirp, err := db.CreateChirp(Chirp{
+		Body:     "which one?",
+		AuthorID: authorID,
+		Poll: &Poll{
+			Options:  []PollOption{{Text: "yes"}, {Text: "no"}},
+			ClosesAt: closesAt,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chirp
+}
+
+func TestVoteConcurrently(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 10)
+	chirp := createTestPoll(t, db, users[0], time.Now().Add(time.Hour))
+
+	// Every user sends several votes at once; only the first of each
+	// user's may count.
+	const attempts = 5
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	counted := map[int]int{}
+	for _, userID := range users {
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(userID, option int) {
+				defer wg.Done()
+				_, err := db.Vote(userID, chirp.ID, option)
+				if errors.Is(err, ErrAlreadyVoted) {
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				counted[userID]++
+				mu.Unlock()
+			}(userID, i%2)
+		}
+	}
+	wg.Wait()
+
+	for _, userID := range users {
+		if counted[userID] != 1 {
+			t.Errorf("user %d had %d votes accepted, want 1", userID, counted[userID])
+		}
+	}
+	got, err := db.GetSingleChirp(chirp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, option := range got.Poll.Options {
+		total += option.Votes
+	}
+	if total != len(users) {
+		t.Errorf("got %d votes counted, want %d", total, len(users))
+	}
+
+	votes, err := db.GetPollVotes(users[3], []int{chirp.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := votes[chirp.ID]; !ok {
+		t.Error("vote wasn't recorded against the user")
+	}
+}
+
+func TestVoteRejects(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 2)
+	open := createTestPoll(t, db, users[0], time.Now().Add(time.Hour))
+	closed := createTestPoll(t, db, users[0], time.Now().Add(-time.Minute))
+	plain, err := db.CreateChirp(Chirp{Body: "no poll here", AuthorID: users[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		chirpID int
+		option  int
+		want    error
+	}{
+		{"closed poll", closed.ID, 0, ErrPollClosed},
+		{"no poll", plain.ID, 0, ErrNoPoll},
+		{"missing chirp", 999, 0, ErrChirpNotFound},
+		{"negative option", open.ID, -1, ErrInvalidPollOption},
+		{"option out of range", open.ID, 2, ErrInvalidPollOption},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := db.Vote(users[1], tc.chirpID, tc.option)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("got error %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	votes, err := db.GetPollVotes(users[1], []int{open.ID, closed.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(votes) != 0 {
+		t.Errorf("rejected votes were recorded: %v", votes)
+	}
+}
+
+func TestRemoveVotes(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 2)
+	chirp := createTestPoll(t, db, users[0], time.Now().Add(time.Hour))
+	for _, userID := range users {
+		_, err := db.Vote(userID, chirp.ID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := db.DeleteUser(users[1], RetainChirpsDelete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetSingleChirp(chirp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Poll.Options[1].Votes != 1 {
+		t.Errorf("got %d votes after the voter left, want 1", got.Poll.Options[1].Votes)
+	}
+}
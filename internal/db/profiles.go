@@ -0,0 +1,156 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrHandleTaken = errors.New("handle is already taken")
+
+// Profile is the public part of a user. Handles are unique regardless of
+// case.
+type Profile struct {
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+func handleTaken(dbStructure DBStructure, handle string, exceptID int) bool {
+	if handle == "" {
+		return false
+	}
+	for _, user := range dbStructure.Users {
+		if user.ID != exceptID && strings.EqualFold(user.Handle, handle) {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *DB) GetUserByHandle(handle string) (User, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+	if handle == "" {
+		return User{}, errors.New("user not found")
+	}
+	for _, user := range dbStructure.Users {
+		if strings.EqualFold(user.Handle, handle) {
+			return user, nil
+		}
+	}
+	return User{}, errors.New("user not found")
+}
+
+// GetUsers returns the users with the given IDs keyed by ID. Unknown IDs
+// are left out.
+func (db *DB) GetUsers(ids []int) (map[int]User, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[int]User, len(ids))
+	for _, id := range ids {
+		user, ok := dbStructure.Users[id]
+		if ok {
+			users[id] = user
+		}
+	}
+	return users, nil
+}
+
+func (db *DB) UpdateProfile(id int, profile Profile) (User, error) {
+	var user User
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[id]
+		if !ok {
+			return errors.New("User not found")
+		}
+		if handleTaken(*dbStructure, profile.Handle, id) {
+			return ErrHandleTaken
+		}
+		user.Profile = profile
+		user.UpdatedAt = time.Now().UTC()
+		dbStructure.Users[id] = user
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// ProfileQuery selects a page of a user's profile timeline.
+type ProfileQuery struct {
+	UserID   int
+	ViewerID int
+	// MaxID, if positive, only returns chirps with lower IDs. Pinned
+	// chirps are only included on the first page, when MaxID is 0, and
+	// aren't repeated among that page's other chirps.
+	MaxID           int
+	Limit           int
+	IncludeReplies  bool
+	IncludeRechirps bool
+}
+
+// ProfileTimeline is a page of a user's chirps as the viewer sees them.
+type ProfileTimeline struct {
+	Pinned []Chirp
+	Chirps []Chirp
+	// ChirpCount counts every chirp by the user the viewer can see,
+	// including replies and rechirps.
+	ChirpCount     int
+	FollowerCount  int
+	FollowingCount int
+}
+
+// GetProfileTimeline returns a user's pinned chirps followed by their
+// other chirps, newest first. Chirps are filtered like direct lookups, not
+// feeds: looking at a muted user's profile still shows their chirps.
+func (db *DB) GetProfileTimeline(query ProfileQuery) (ProfileTimeline, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return ProfileTimeline{}, err
+	}
+	user, ok := dbStructure.Users[query.UserID]
+	if !ok {
+		return ProfileTimeline{}, errors.New("user not found")
+	}
+
+	timeline := ProfileTimeline{
+		Pinned:         []Chirp{},
+		Chirps:         make([]Chirp, 0, query.Limit),
+		FollowerCount:  len(dbStructure.Followers[query.UserID]),
+		FollowingCount: len(dbStructure.Following[query.UserID]),
+	}
+	pinned := map[int]bool{}
+	if query.MaxID <= 0 {
+		for _, id := range user.PinnedChirpIDs {
+			if chirp, ok := dbStructure.visibleChirp(id, query.ViewerID); ok {
+				timeline.Pinned = append(timeline.Pinned, chirp)
+				pinned[id] = true
+			}
+		}
+	}
+
+	ids := dbStructure.AuthorChirps[query.UserID]
+	for i := len(ids) - 1; i >= 0; i-- {
+		chirp, ok := dbStructure.visibleChirp(ids[i], query.ViewerID)
+		if !ok {
+			continue
+		}
+		timeline.ChirpCount++
+		if len(timeline.Chirps) >= query.Limit || (query.MaxID > 0 && chirp.ID >= query.MaxID) || pinned[chirp.ID] {
+			continue
+		}
+		if (chirp.InReplyToID != 0 && !query.IncludeReplies) || (chirp.RechirpOfID != 0 && !query.IncludeRechirps) {
+			continue
+		}
+		timeline.Chirps = append(timeline.Chirps, chirp)
+	}
+	return timeline, nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestProfileTimelineSkipsPinnedOnFirstPage(t *testing.T) {
+	db := newTestDB(t)
+	author := createTestUsers(t, db, 1)[0]
+	ids := createTestChirps(t, db, author, "one", "two", "three")
+	_, err := db.PinChirp(author, ids[1], 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chirpIDs := func(chirps []Chirp) []int {
+		ids := []int{}
+		for _, chirp := range chirps {
+			ids = append(ids, chirp.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		name       string
+		maxID      int
+		wantPinned []int
+		want       []int
+	}{
+		{"first page", 0, []int{ids[1]}, []int{ids[2], ids[0]}},
+		{"later page", ids[2], []int{}, []int{ids[1], ids[0]}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			timeline, err := db.GetProfileTimeline(ProfileQuery{UserID: author, MaxID: tc.maxID, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := chirpIDs(timeline.Pinned); !slices.Equal(got, tc.wantPinned) {
+				t.Errorf("got pinned %v, want %v", got, tc.wantPinned)
+			}
+			if got := chirpIDs(timeline.Chirps); !slices.Equal(got, tc.want) {
+				t.Errorf("got chirps %v, want %v", got, tc.want)
+			}
+			if timeline.ChirpCount != 3 {
+				t.Errorf("got chirp count %d, want 3", timeline.ChirpCount)
+			}
+		})
+	}
+}
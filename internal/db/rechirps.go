@@ -0,0 +1,100 @@
+package database
+
+import "errors"
+
+var (
+	ErrQuotedNotFound = errors.New("chirp being quoted was not found")
+	ErrCannotRechirp  = errors.New("followers-only and direct chirps can't be rechirped")
+)
+
+// original resolves a rechirp to the chirp it reposts, so rechirping,
+// quoting or replying to a rechirp acts on the original instead.
+func (dbStructure *DBStructure) original(id int) (Chirp, bool) {
+	chirp, ok := dbStructure.Chirps[id]
+	if ok && chirp.RechirpOfID != 0 {
+		chirp, ok = dbStructure.Chirps[chirp.RechirpOfID]
+	}
+	return chirp, ok
+}
+
+// Rechirp reposts a chirp on behalf of the user and returns the rechirp.
+// Each user can rechirp a chirp once; rechirping it again returns the
+// existing rechirp. Followers-only and direct chirps can't be rechirped.
+func (db *DB) Rechirp(userID, chirpID int) (Chirp, error) {
+	var rechirp Chirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		original, ok := dbStructure.visibleOriginal(chirpID, userID)
+		if !ok {
+			return ErrChirpNotFound
+		}
+		if original.Visibility == VisibilityFollowers || original.Visibility == VisibilityDirect {
+			return ErrCannotRechirp
+		}
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return errors.New("User not found")
+		}
+		if id, ok := dbStructure.Rechirps[original.ID][userID]; ok {
+			rechirp = dbStructure.Chirps[id]
+			return nil
+		}
+
+		rechirp = dbStructure.insertChirp(Chirp{
+			AuthorID:    userID,
+			RechirpOfID: original.ID,
+		})
+		if dbStructure.Rechirps[original.ID] == nil {
+			dbStructure.Rechirps[original.ID] = map[int]int{}
+		}
+		dbStructure.Rechirps[original.ID][userID] = rechirp.ID
+		original.RechirpCount++
+		dbStructure.Chirps[original.ID] = original
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return rechirp, nil
+}
+
+// Unrechirp removes the user's rechirp of a chirp, if there is one.
+func (db *DB) Unrechirp(userID, chirpID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		original, ok := dbStructure.original(chirpID)
+		if !ok {
+			return errors.New("chirp not found")
+		}
+		if id, ok := dbStructure.Rechirps[original.ID][userID]; ok {
+			dbStructure.deleteChirp(id)
+		}
+		return nil
+	})
+}
+
+// removeRechirp drops a rechirp from its original's index and count.
+func (dbStructure *DBStructure) removeRechirp(rechirp Chirp) {
+	originalID := rechirp.RechirpOfID
+	delete(dbStructure.Rechirps[originalID], rechirp.AuthorID)
+	if len(dbStructure.Rechirps[originalID]) == 0 {
+		delete(dbStructure.Rechirps, originalID)
+	}
+	if original, ok := dbStructure.Chirps[originalID]; ok && original.RechirpCount > 0 {
+		original.RechirpCount--
+		dbStructure.Chirps[originalID] = original
+	}
+}
+
+// GetChirpsByID returns whichever of the given chirps still exist and the
+// viewer may see.
+func (db *DB) GetChirpsByID(ids []int, viewerID int) (map[int]Chirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	chirps := make(map[int]Chirp, len(ids))
+	for _, id := range ids {
+		if chirp, ok := dbStructure.visibleChirp(id, viewerID); ok {
+			chirps[id] = chirp
+		}
+	}
+	return chirps, nil
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"sort"
+)
+
+var ErrParentNotFound = errors.New("chirp being replied to was not found")
+
+// ThreadNode is a chirp in a conversation. Deleted chirps that still have
+// replies appear as nodes with Deleted set and only Chirp.ID and
+// Chirp.InReplyToID filled in.
+type ThreadNode struct {
+	Chirp      Chirp
+	Deleted    bool
+	ReplyCount int
+	Replies    []ThreadNode
+}
+
+type Thread struct {
+	// Ancestors runs from the root of the conversation down to the direct
+	// parent of Chirp.
+	Ancestors []ThreadNode
+	Chirp     ThreadNode
+	// NextAfterID is the cursor for the next page of direct replies, or 0
+	// when there are no more.
+	NextAfterID int
+}
+
+// deleteChirp removes a chirp, its rechirps and its index entries. A chirp
+// that has replies leaves a tombstone behind so its replies stay attached
+// to the conversation; tombstones are pruned once their last reply is gone.
+// Quotes of the chirp are kept and simply lose the quoted chirp.
+func (dbStructure *DBStructure) deleteChirp(id int) {
+	chirp, ok := dbStructure.Chirps[id]
+	if !ok {
+		return
+	}
+	for _, rechirpID := range dbStructure.Rechirps[id] {
+		dbStructure.deleteChirp(rechirpID)
+	}
+	if chirp.RechirpOfID != 0 {
+		dbStructure.removeRechirp(chirp)
+	}
+	for userID := range dbStructure.Likes[id] {
+		dbStructure.removeLike(userID, id)
+	}
+	delete(dbStructure.Chirps, id)
+	delete(dbStructure.ChirpRevisions, id)
+	delete(dbStructure.PollVotes, id)
+	dbStructure.removeBookmarks(id)
+	dbStructure.unpinChirp(chirp.AuthorID, id)
+	dbStructure.removeFromAuthorIndex(chirp)
+	dbStructure.unindexEntities(chirp)
+	dbStructure.unindexChirpText(chirp)
+
+	if len(dbStructure.Replies[id]) > 0 {
+		dbStructure.Tombstones[id] = chirp.InReplyToID
+		return
+	}
+	dbStructure.detachReply(id, chirp.InReplyToID)
+}
+
+// detachReply drops id from its parent's replies, pruning any tombstone
+// left with nothing under it.
+func (dbStructure *DBStructure) detachReply(id, parentID int) {
+	for parentID != 0 {
+		replies := removeSorted(dbStructure.Replies[parentID], id)
+		if len(replies) > 0 {
+			dbStructure.Replies[parentID] = replies
+			return
+		}
+		delete(dbStructure.Replies, parentID)
+
+		grandparentID, tombstoned := dbStructure.Tombstones[parentID]
+		if !tombstoned {
+			return
+		}
+		delete(dbStructure.Tombstones, parentID)
+		id, parentID = parentID, grandparentID
+	}
+}
+
+func insertSorted(ids []int, id int) []int {
+	i := sort.SearchInts(ids, id)
+	if i < len(ids) && ids[i] == id {
+		return ids
+	}
+	return slices.Insert(ids, i, id)
+}
+
+func removeSorted(ids []int, id int) []int {
+	i := sort.SearchInts(ids, id)
+	if i < len(ids) && ids[i] == id {
+		ids = append(ids[:i], ids[i+1:]...)
+	}
+	return ids
+}
+
+// threadNode loads one chirp of a conversation as the viewer sees it.
+// Chirps the viewer can't see are shown as deleted so their replies stay
+// attached.
+func (dbStructure *DBStructure) threadNode(id, viewerID int) (ThreadNode, bool) {
+	if chirp, ok := dbStructure.Chirps[id]; ok {
+		if !dbStructure.visibleTo(chirp, viewerID) {
+			return ThreadNode{
+				Chirp:      Chirp{ID: id, InReplyToID: chirp.InReplyToID},
+				Deleted:    true,
+				ReplyCount: dbStructure.liveReplyCount(id, viewerID),
+			}, true
+		}
+		return ThreadNode{Chirp: chirp, ReplyCount: dbStructure.liveReplyCount(id, viewerID)}, true
+	}
+	if parentID, ok := dbStructure.Tombstones[id]; ok {
+		return ThreadNode{
+			Chirp:      Chirp{ID: id, InReplyToID: parentID},
+			Deleted:    true,
+			ReplyCount: dbStructure.liveReplyCount(id, viewerID),
+		}, true
+	}
+	return ThreadNode{}, false
+}
+
+// liveReplyCount counts the direct replies to a chirp that the viewer can
+// see.
+func (dbStructure *DBStructure) liveReplyCount(id, viewerID int) int {
+	count := 0
+	for _, replyID := range dbStructure.Replies[id] {
+		if _, ok := dbStructure.visibleChirp(replyID, viewerID); ok {
+			count++
+		}
+	}
+	return count
+}
+
+// replyTree loads up to limit direct replies to id with IDs above afterID,
+// oldest first, each with up to limit of its own replies down to depth
+// levels. It returns the cursor for the next page of direct replies.
+func (dbStructure *DBStructure) replyTree(id, afterID, limit, depth, viewerID int) ([]ThreadNode, int) {
+	if depth <= 0 {
+		return []ThreadNode{}, 0
+	}
+	replyIDs := dbStructure.Replies[id]
+	start := sort.SearchInts(replyIDs, afterID+1)
+
+	nodes := []ThreadNode{}
+	next := 0
+	for _, replyID := range replyIDs[start:] {
+		if len(nodes) == limit {
+			next = nodes[len(nodes)-1].Chirp.ID
+			break
+		}
+		node, ok := dbStructure.threadNode(replyID, viewerID)
+		if !ok {
+			continue
+		}
+		node.Replies, _ = dbStructure.replyTree(replyID, 0, limit, depth-1, viewerID)
+		if node.Deleted && len(node.Replies) == 0 {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, next
+}
+
+// GetThread returns the conversation around a chirp as the viewer sees
+// it: its ancestors up to the root and a page of its reply tree.
+func (db *DB) GetThread(id, afterID, limit, depth, viewerID int) (Thread, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Thread{}, err
+	}
+	node, ok := dbStructure.threadNode(id, viewerID)
+	if !ok || node.Deleted {
+		return Thread{}, errors.New("chirp not found")
+	}
+
+	thread := Thread{Chirp: node}
+	seen := map[int]bool{id: true}
+	for parentID := node.Chirp.InReplyToID; parentID != 0 && !seen[parentID]; {
+		seen[parentID] = true
+		parent, ok := dbStructure.threadNode(parentID, viewerID)
+		if !ok {
+			break
+		}
+		thread.Ancestors = append(thread.Ancestors, parent)
+		parentID = parent.Chirp.InReplyToID
+	}
+	for i, j := 0, len(thread.Ancestors)-1; i < j; i, j = i+1, j-1 {
+		thread.Ancestors[i], thread.Ancestors[j] = thread.Ancestors[j], thread.Ancestors[i]
+	}
+
+	thread.Chirp.Replies, thread.NextAfterID = dbStructure.replyTree(id, afterID, limit, depth, viewerID)
+	return thread, nil
+}
+
+// GetReplyCounts returns how many live replies each of the given chirps
+// has that the viewer can see.
+func (db *DB) GetReplyCounts(ids []int, viewerID int) (map[int]int, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[int]int, len(ids))
+	for _, id := range ids {
+		counts[id] = dbStructure.liveReplyCount(id, viewerID)
+	}
+	return counts, nil
+}
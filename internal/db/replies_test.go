@@ -0,0 +1,54 @@
+package database
+
+import "testing"
+
+func TestReplyCountsFollowVisibility(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 4)
+	author, follower, blocker, replier := users[0], users[1], users[2], users[3]
+	err := db.Follow(follower, replier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := createTestChirps(t, db, author, "question")[0]
+	for _, visibility := range []string{"", VisibilityFollowers} {
+		_, err := db.CreateChirp(Chirp{Body: "answer", AuthorID: replier, InReplyToID: parent, Visibility: visibility})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.Block(blocker, replier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		viewerID int
+		want     int
+	}{
+		{"anonymous", 0, 1},
+		{"parent's author", author, 1},
+		{"follower of the replier", follower, 2},
+		{"replier", replier, 2},
+		{"blocked the replier", blocker, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			counts, err := db.GetReplyCounts([]int{parent}, tc.viewerID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counts[parent] != tc.want {
+				t.Errorf("got %d replies, want %d", counts[parent], tc.want)
+			}
+			thread, err := db.GetThread(parent, 0, 10, 1, tc.viewerID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if thread.Chirp.ReplyCount != tc.want {
+				t.Errorf("got thread reply count %d, want %d", thread.Chirp.ReplyCount, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	ReportOpen     = "open"
+	ReportClaimed  = "claimed"
+	ReportResolved = "resolved"
+)
+
+const (
+	ResolutionDismiss       = "dismiss"
+	ResolutionHideChirp     = "hide_chirp"
+	ResolutionSuspendAuthor = "suspend_author"
+)
+
+// ReasonHeld is the reason on reports opened automatically for chirps the
+// moderation pipeline held back, rather than by a user.
+const ReasonHeld = "held"
+
+var (
+	ErrReportNotFound    = errors.New("report not found")
+	ErrReportClaimed     = errors.New("report is claimed by another moderator")
+	ErrReportResolved    = errors.New("report is already resolved")
+	ErrReportOwnChirp    = errors.New("users can't report their own chirps")
+	ErrUnknownResolution = errors.New("unknown resolution")
+	ErrHeldChirpInvalid  = errors.New("held chirp can no longer be published")
+)
+
+// Report is a request for moderators to review a chirp. Reports on held
+// chirps point at the held chirp instead, since it has no chirp ID yet.
+type Report struct {
+	ID          int `json:"id"`
+	ChirpID     int `json:"chirp_id,omitempty"`
+	HeldChirpID int `json:"held_chirp_id,omitempty"`
+	AuthorID    int `json:"author_id"`
+	// ReporterID is 0 for reports opened by the moderation pipeline or
+	// whose reporter has since deleted their account.
+	ReporterID int    `json:"reporter_id"`
+	Reason     string `json:"reason"`
+	Comment    string `json:"comment,omitempty"`
+	// Body is the chirp as it read when it was reported, in case it is
+	// edited or deleted before anyone looks at it.
+	Body       string    `json:"body"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	ClaimedBy  int       `json:"claimed_by,omitempty"`
+	ClaimedAt  time.Time `json:"claimed_at"`
+	Resolution string    `json:"resolution,omitempty"`
+	ResolvedBy int       `json:"resolved_by,omitempty"`
+	ResolvedAt time.Time `json:"resolved_at"`
+	Note       string    `json:"note,omitempty"`
+}
+
+// ModerationEvent is one entry in the moderation audit log.
+type ModerationEvent struct {
+	ID       int    `json:"id"`
+	ActorID  int    `json:"actor_id"`
+	Action   string `json:"action"`
+	ReportID int    `json:"report_id,omitempty"`
+	ChirpID  int    `json:"chirp_id,omitempty"`
+	// UserID is the user the action was taken against, if any.
+	UserID int       `json:"user_id,omitempty"`
+	Note   string    `json:"note,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// CreateReport files a report against a chirp. Rechirps are reported as
+// the chirp they repost. Reporting the same chirp again while the first
+// report is still pending returns the existing report.
+func (db *DB) CreateReport(reporterID, chirpID int, reason, comment string) (Report, error) {
+	var report Report
+	err := db.update(func(dbStructure *DBStructure) error {
+		chirp, ok := dbStructure.visibleOriginal(chirpID, reporterID)
+		if !ok {
+			return ErrChirpNotFound
+		}
+		if chirp.AuthorID == reporterID {
+			return ErrReportOwnChirp
+		}
+		for _, existing := range dbStructure.Reports {
+			if existing.ChirpID == chirp.ID && existing.ReporterID == reporterID && existing.Status != ReportResolved {
+				report = existing
+				return nil
+			}
+		}
+
+		dbStructure.LastReportID++
+		report = Report{
+			ID:         dbStructure.LastReportID,
+			ChirpID:    chirp.ID,
+			AuthorID:   chirp.AuthorID,
+			ReporterID: reporterID,
+			Reason:     reason,
+			Comment:    comment,
+			Body:       chirp.Body,
+			Status:     ReportOpen,
+			CreatedAt:  time.Now().UTC(),
+		}
+		dbStructure.Reports[report.ID] = report
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// reportHeldChirp opens the review report for a chirp moderation held.
+func (dbStructure *DBStructure) reportHeldChirp(held HeldChirp) {
+	dbStructure.LastReportID++
+	dbStructure.Reports[dbStructure.LastReportID] = Report{
+		ID:          dbStructure.LastReportID,
+		HeldChirpID: held.ID,
+		AuthorID:    held.Chirp.AuthorID,
+		Reason:      ReasonHeld,
+		Body:        held.Chirp.Body,
+		Status:      ReportOpen,
+		CreatedAt:   held.HeldAt,
+	}
+}
+
+// GetReports lists reports with the given status, or every report when
+// status is empty, oldest first.
+func (db *DB) GetReports(status string) ([]Report, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	reports := []Report{}
+	for _, report := range dbStructure.Reports {
+		if status == "" || report.Status == status {
+			reports = append(reports, report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].ID < reports[j].ID
+	})
+	return reports, nil
+}
+
+// GetReport returns a report along with the audit log entries about it,
+// oldest first.
+func (db *DB) GetReport(id int) (Report, []ModerationEvent, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Report{}, nil, err
+	}
+	report, ok := dbStructure.Reports[id]
+	if !ok {
+		return Report{}, nil, ErrReportNotFound
+	}
+	events := []ModerationEvent{}
+	for _, event := range dbStructure.ModerationLog {
+		if event.ReportID == id {
+			events = append(events, event)
+		}
+	}
+	return report, events, nil
+}
+
+// ClaimReport assigns a report to a moderator so others know it's being
+// looked at. Claims older than staleAfter can be taken over.
+func (db *DB) ClaimReport(id, moderatorID int, staleAfter time.Duration) (Report, error) {
+	var report Report
+	err := db.update(func(dbStructure *DBStructure) error {
+		var err error
+		report, err = dbStructure.claimReport(id, moderatorID, staleAfter)
+		if err != nil {
+			return err
+		}
+		dbStructure.logModeration(ModerationEvent{
+			ActorID:  moderatorID,
+			Action:   "claim",
+			ReportID: id,
+			ChirpID:  report.ChirpID,
+			UserID:   report.AuthorID,
+		})
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// publishHeldChirp publishes a held chirp through the same checks as a new
+// one, since what it refers to, who has blocked whom and its author's
+// standing may all have changed while it waited.
+func (dbStructure *DBStructure) publishHeldChirp(held HeldChirp) (Chirp, error) {
+	author, ok := dbStructure.Users[held.Chirp.AuthorID]
+	if !ok || author.Suspension.Active(time.Now()) {
+		return Chirp{}, fmt.Errorf("%w: its author is suspended or gone", ErrHeldChirpInvalid)
+	}
+	// The attachments are still on the held chirp, which the checks
+	// would count as in use.
+	dbStructure.attachMedia(held.Chirp.Attachments, 0, 0, 0)
+	chirp, err := dbStructure.createChirp(held.Chirp, 0)
+	if err != nil {
+		return Chirp{}, fmt.Errorf("%w: %w", ErrHeldChirpInvalid, err)
+	}
+	return chirp, nil
+}
+
+func (dbStructure *DBStructure) claimReport(id, moderatorID int, staleAfter time.Duration) (Report, error) {
+	report, ok := dbStructure.Reports[id]
+	if !ok {
+		return Report{}, ErrReportNotFound
+	}
+	now := time.Now().UTC()
+	switch {
+	case report.Status == ReportResolved:
+		return Report{}, ErrReportResolved
+	case report.Status == ReportClaimed && report.ClaimedBy != moderatorID && now.Sub(report.ClaimedAt) < staleAfter:
+		return Report{}, ErrReportClaimed
+	}
+	report.Status = ReportClaimed
+	report.ClaimedBy = moderatorID
+	report.ClaimedAt = now
+	dbStructure.Reports[id] = report
+	return report, nil
+}
+
+// ResolveReport closes a report, claiming it first if needed. Every other
+// pending report on the same chirp is closed with it, since the decision
+// is about the chirp.
+//
+// Dismissing a held chirp's report publishes the chirp; hiding it or
+// suspending its author discards it. If the held chirp no longer passes
+// the checks for a new chirp, dismissing fails with ErrHeldChirpInvalid
+// and nothing changes. suspendUntil is only used to suspend the author.
+func (db *DB) ResolveReport(id, moderatorID int, resolution, note string, staleAfter time.Duration, suspendUntil time.Time) (Report, error) {
+	if resolution != ResolutionDismiss && resolution != ResolutionHideChirp && resolution != ResolutionSuspendAuthor {
+		return Report{}, ErrUnknownResolution
+	}
+	var report Report
+	err := db.update(func(dbStructure *DBStructure) error {
+		var err error
+		report, err = dbStructure.claimReport(id, moderatorID, staleAfter)
+		if err != nil {
+			return err
+		}
+		now := report.ClaimedAt
+
+		switch {
+		case report.HeldChirpID != 0:
+			held, ok := dbStructure.HeldChirps[report.HeldChirpID]
+			if ok && resolution == ResolutionDismiss {
+				chirp, err := dbStructure.publishHeldChirp(held)
+				if err != nil {
+					return err
+				}
+				report.ChirpID = chirp.ID
+			}
+			delete(dbStructure.HeldChirps, report.HeldChirpID)
+		case resolution != ResolutionDismiss:
+			if chirp, ok := dbStructure.Chirps[report.ChirpID]; ok && chirp.Hidden == nil {
+				chirp.Hidden = &ChirpHide{By: moderatorID, At: now, ReportID: id}
+				dbStructure.Chirps[chirp.ID] = chirp
+			}
+		}
+		if resolution == ResolutionSuspendAuthor {
+			dbStructure.suspendUser(report.AuthorID, Suspension{
+				Until:  suspendUntil,
+				Reason: note,
+				By:     moderatorID,
+				At:     now,
+			})
+		}
+
+		for otherID, other := range dbStructure.Reports {
+			sameSubject := other.HeldChirpID == 0 && other.ChirpID == report.ChirpID
+			if report.HeldChirpID != 0 {
+				sameSubject = other.HeldChirpID == report.HeldChirpID
+			}
+			if otherID == id || !sameSubject || other.Status == ReportResolved {
+				continue
+			}
+			other.Status = ReportResolved
+			other.Resolution = resolution
+			other.ResolvedBy = moderatorID
+			other.ResolvedAt = now
+			other.Note = note
+			dbStructure.Reports[otherID] = other
+		}
+		report.Status = ReportResolved
+		report.Resolution = resolution
+		report.ResolvedBy = moderatorID
+		report.ResolvedAt = now
+		report.Note = note
+		dbStructure.Reports[id] = report
+
+		dbStructure.logModeration(ModerationEvent{
+			ActorID:  moderatorID,
+			Action:   resolution,
+			ReportID: id,
+			ChirpID:  report.ChirpID,
+			UserID:   report.AuthorID,
+			Note:     note,
+		})
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// ModerateDeleteChirp deletes someone else's chirp on a moderator's
+// behalf and records it in the audit log.
+func (db *DB) ModerateDeleteChirp(id, moderatorID int, note string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		chirp, ok := dbStructure.Chirps[id]
+		if !ok {
+			return errors.New("did not find chirp")
+		}
+		dbStructure.deleteChirp(id)
+		dbStructure.logModeration(ModerationEvent{
+			ActorID: moderatorID,
+			Action:  "delete_chirp",
+			ChirpID: id,
+			UserID:  chirp.AuthorID,
+			Note:    note,
+		})
+		return nil
+	})
+}
+
+// GetModerationLog returns a page of the audit log, newest first.
+func (db *DB) GetModerationLog(offset, limit int) ([]ModerationEvent, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]ModerationEvent, 0, limit)
+	for i := len(dbStructure.ModerationLog) - 1 - offset; i >= 0 && len(events) < limit; i-- {
+		events = append(events, dbStructure.ModerationLog[i])
+	}
+	return events, nil
+}
+
+func (dbStructure *DBStructure) logModeration(event ModerationEvent) {
+	event.ID = len(dbStructure.ModerationLog) + 1
+	event.At = time.Now().UTC()
+	dbStructure.ModerationLog = append(dbStructure.ModerationLog, event)
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// holdTestChirp holds a chirp back for review and returns the report
+// opened for it.
+func holdTestChirp(t *testing.T, db *DB, chirp Chirp) Report {
+	t.Helper()
+	held, err := db.HoldChirp(chirp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports, err := db.GetReports(ReportOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, report := range reports {
+		if report.HeldChirpID == held.ID {
+			return report
+		}
+	}
+	t.Fatalf("no report opened for held chirp %d", held.ID)
+	return Report{}
+}
+
+func TestDismissHeldChirp(t *testing.T) {
+	tests := []struct {
+		name string
+		// change runs after the chirp is held, given the IDs of its
+		// author, the author of the chirp it answers, and that chirp.
+		change func(t *testing.T, db *DB, authorID, otherID, parentID int) error
+		want   error
+	}{
+		{
+			name:   "unchanged",
+			change: func(t *testing.T, db *DB, authorID, otherID, parentID int) error { return nil },
+		},
+		{
+			name: "parent deleted",
+			change: func(t *testing.T, db *DB, authorID, otherID, parentID int) error {
+				return db.DeleteChirp(parentID)
+			},
+			want: ErrParentNotFound,
+		},
+		{
+			name: "parent's author blocked the author",
+			change: func(t *testing.T, db *DB, authorID, otherID, parentID int) error {
+				return db.Block(otherID, authorID)
+			},
+			want: ErrParentNotFound,
+		},
+		{
+			name: "parent hidden",
+			change: func(t *testing.T, db *DB, authorID, otherID, parentID int) error {
+				report, err := db.CreateReport(authorID, parentID, "spam", "")
+				if err != nil {
+					return err
+				}
+				_, err = db.ResolveReport(report.ID, authorID, ResolutionHideChirp, "", time.Minute, time.Time{})
+				return err
+			},
+			want: ErrParentNotFound,
+		},
+		{
+			name: "author suspended",
+			change: func(t *testing.T, db *DB, authorID, otherID, parentID int) error {
+				_, err := db.SuspendUser(authorID, Suspension{Until: time.Now().Add(time.Hour)})
+				return err
+			},
+			want: ErrHeldChirpInvalid,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newTestDB(t)
+			users := createTestUsers(t, db, 3)
+			author, other, moderator := users[0], users[1], users[2]
+			parent := createTestChirps(t, db, other, "first")[0]
+			report := holdTestChirp(t, db, Chirp{Body: "reply", AuthorID: author, InReplyToID: parent})
+
+			err := tc.change(t, db, author, other, parent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resolved, err := db.ResolveReport(report.ID, moderator, ResolutionDismiss, "", time.Minute, time.Time{})
+			if tc.want == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				chirp, err := db.GetVisibleChirp(resolved.ChirpID, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if chirp.InReplyToID != parent {
+					t.Errorf("published chirp replies to %d, want %d", chirp.InReplyToID, parent)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrHeldChirpInvalid) || !errors.Is(err, tc.want) {
+				t.Errorf("got error %v, want %v", err, tc.want)
+			}
+			// Nothing changed, so a moderator can still discard it.
+			_, err = db.GetHeldChirp(report.HeldChirpID)
+			if err != nil {
+				t.Errorf("held chirp is gone after a failed dismissal: %v", err)
+			}
+			_, err = db.ResolveReport(report.ID, moderator, ResolutionHideChirp, "", time.Minute, time.Time{})
+			if err != nil {
+				t.Errorf("discarding after a failed dismissal: %v", err)
+			}
+		})
+	}
+}
+
+func TestDismissHeldChirpRechecksMentions(t *testing.T) {
+	db := newTestDB(t)
+	var users []int
+	for _, handle := range []string{"author", "friend", "blocker", "moderator"} {
+		user, err := db.CreateUser(handle+"@example.com", "hash", Profile{Handle: handle})
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user.ID)
+	}
+	author, friend, blocker, moderator := users[0], users[1], users[2], users[3]
+	report := holdTestChirp(t, db, Chirp{
+		Body:     "@friend @blocker",
+		AuthorID: author,
+		Mentions: []Mention{{Handle: "friend"}, {Handle: "blocker"}},
+	})
+	err := db.Block(blocker, author)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := db.ResolveReport(report.ID, moderator, ResolutionDismiss, "", time.Minute, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirp, err := db.GetVisibleChirp(resolved.ChirpID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirp.Mentions) != 1 || chirp.Mentions[0].UserID != friend {
+		t.Errorf("got mentions %+v, want only @friend", chirp.Mentions)
+	}
+}
+
+func TestDismissHeldChirpKeepsAttachments(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 2)
+	media, err := db.CreateMedia(Media{ID: "photo", OwnerID: users[0], Key: "photo.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := holdTestChirp(t, db, Chirp{Body: "look", AuthorID: users[0], Attachments: []string{media.ID}})
+
+	resolved, err := db.ResolveReport(report.ID, users[1], ResolutionDismiss, "", time.Minute, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetMedia([]string{media.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[media.ID].ChirpID != resolved.ChirpID || got[media.ID].HeldChirpID != 0 {
+		t.Errorf("got media %+v, want it on chirp %d", got[media.ID], resolved.ChirpID)
+	}
+}
@@ -0,0 +1,408 @@
+package database
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	maxSearchTerms = 32
+	// searchHalfLife is how long it takes a chirp's recency boost to halve.
+	searchHalfLife = 7 * 24 * time.Hour
+	// searchRecencyWeight is the share of the score that comes from
+	// recency; the rest is relevance.
+	searchRecencyWeight = 0.5
+)
+
+var ErrEmptySearch = errors.New("search query is empty")
+
+// Posting records where a term occurs in one chirp.
+type Posting struct {
+	ChirpID   int   `json:"chirp_id"`
+	Positions []int `json:"positions"`
+}
+
+// SearchQuery is a parsed search. Every term and phrase must match.
+type SearchQuery struct {
+	Terms   []string
+	Phrases [][]string
+	// Author is a handle or user ID, as written after author:.
+	Author string
+	// Before and After bound the chirp's creation time; Before is
+	// exclusive and After inclusive. Zero means unbounded.
+	Before time.Time
+	After  time.Time
+}
+
+// SearchResult is one page of search hits, best first.
+type SearchResult struct {
+	Total  int
+	Chirps []Chirp
+}
+
+// Tokenize splits text into lowercased runs of letters and digits. The
+// same tokenizer is used for indexing and for queries.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ParseSearchQuery parses free text with optional "quoted phrases" and
+// author:, before: and after: filters. Dates are YYYY-MM-DD or RFC 3339.
+func ParseSearchQuery(q string) (SearchQuery, error) {
+	query := SearchQuery{}
+	for len(q) > 0 {
+		q = strings.TrimLeftFunc(q, unicode.IsSpace)
+		if q == "" {
+			break
+		}
+		if q[0] == '"' {
+			end := strings.IndexByte(q[1:], '"')
+			phrase := q[1:]
+			q = ""
+			if end >= 0 {
+				phrase, q = phrase[:end], phrase[end+1:]
+			}
+			tokens := Tokenize(phrase)
+			switch len(tokens) {
+			case 0:
+			case 1:
+				query.Terms = append(query.Terms, tokens[0])
+			default:
+				query.Phrases = append(query.Phrases, tokens)
+			}
+			continue
+		}
+
+		word := q
+		q = ""
+		if end := strings.IndexFunc(word, unicode.IsSpace); end >= 0 {
+			word, q = word[:end], word[end:]
+		}
+		key, value, found := strings.Cut(word, ":")
+		if found && value != "" {
+			var err error
+			switch strings.ToLower(key) {
+			case "author":
+				query.Author = strings.TrimPrefix(value, "@")
+				continue
+			case "before":
+				query.Before, err = parseSearchDate(value)
+				if err != nil {
+					return SearchQuery{}, err
+				}
+				continue
+			case "after":
+				query.After, err = parseSearchDate(value)
+				if err != nil {
+					return SearchQuery{}, err
+				}
+				continue
+			}
+		}
+		query.Terms = append(query.Terms, Tokenize(word)...)
+	}
+
+	count := len(query.Terms)
+	for _, phrase := range query.Phrases {
+		count += len(phrase)
+	}
+	if count > maxSearchTerms {
+		return SearchQuery{}, errors.New("search query has too many terms")
+	}
+	if count == 0 && query.Author == "" && query.Before.IsZero() && query.After.IsZero() {
+		return SearchQuery{}, ErrEmptySearch
+	}
+	return query, nil
+}
+
+func parseSearchDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.New("dates must be YYYY-MM-DD or RFC 3339")
+	}
+	return t.UTC(), nil
+}
+
+// indexChirpText adds a chirp's body to the inverted index, keeping every
+// posting list sorted by chirp ID.
+func (dbStructure *DBStructure) indexChirpText(chirp Chirp) {
+	positions := map[string][]int{}
+	terms := []string{}
+	for i, token := range Tokenize(chirp.Body) {
+		if _, ok := positions[token]; !ok {
+			terms = append(terms, token)
+		}
+		positions[token] = append(positions[token], i)
+	}
+	for _, term := range terms {
+		postings := dbStructure.SearchIndex[term]
+		dbStructure.SearchIndex[term] = slices.Insert(postings, searchPostings(postings, chirp.ID), Posting{
+			ChirpID:   chirp.ID,
+			Positions: positions[term],
+		})
+	}
+}
+
+func (dbStructure *DBStructure) unindexChirpText(chirp Chirp) {
+	for _, term := range Tokenize(chirp.Body) {
+		postings := dbStructure.SearchIndex[term]
+		i := searchPostings(postings, chirp.ID)
+		if i == len(postings) || postings[i].ChirpID != chirp.ID {
+			continue
+		}
+		postings = append(postings[:i], postings[i+1:]...)
+		if len(postings) == 0 {
+			delete(dbStructure.SearchIndex, term)
+			continue
+		}
+		dbStructure.SearchIndex[term] = postings
+	}
+}
+
+func (dbStructure *DBStructure) rebuildSearchIndex() {
+	dbStructure.SearchIndex = map[string][]Posting{}
+	ids := make([]int, 0, len(dbStructure.Chirps))
+	for id := range dbStructure.Chirps {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		dbStructure.indexChirpText(dbStructure.Chirps[id])
+	}
+}
+
+func searchPostings(postings []Posting, chirpID int) int {
+	return sort.Search(len(postings), func(i int) bool { return postings[i].ChirpID >= chirpID })
+}
+
+// Search runs a query and returns the page starting at offset. Chirps are
+// ranked by a mix of tf-idf relevance and recency; queries with only
+// filters are returned newest first.
+//
+// Candidates come from intersecting the posting lists of the query's
+// terms, rarest first, so the cost follows the rarest term rather than the
+// number of chirps, and only offset+limit hits are kept while ranking.
+func (db *DB) Search(query SearchQuery, viewerID, offset, limit int) (SearchResult, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	authorID := -1
+	if query.Author != "" {
+		authorID = dbStructure.searchAuthor(query.Author)
+		if authorID == -1 {
+			return SearchResult{Chirps: []Chirp{}}, nil
+		}
+	}
+	matches := func(chirp Chirp) bool {
+		if chirp.RechirpOfID != 0 || !dbStructure.listedFor(chirp, viewerID) {
+			return false
+		}
+		if authorID != -1 && chirp.AuthorID != authorID {
+			return false
+		}
+		if !query.After.IsZero() && chirp.CreatedAt.Before(query.After) {
+			return false
+		}
+		if !query.Before.IsZero() && (chirp.CreatedAt.IsZero() || !chirp.CreatedAt.Before(query.Before)) {
+			return false
+		}
+		return true
+	}
+
+	terms := append([]string{}, query.Terms...)
+	for _, phrase := range query.Phrases {
+		terms = append(terms, phrase...)
+	}
+	if len(terms) == 0 {
+		return dbStructure.searchNewest(query, matches, authorID, offset, limit), nil
+	}
+
+	lists := make(map[string][]Posting, len(terms))
+	for _, term := range terms {
+		lists[term] = dbStructure.SearchIndex[term]
+	}
+	order := make([]string, 0, len(lists))
+	for term := range lists {
+		order = append(order, term)
+	}
+	sort.Slice(order, func(i, j int) bool { return len(lists[order[i]]) < len(lists[order[j]]) })
+
+	total := 0
+	now := time.Now().UTC()
+	docs := float64(len(dbStructure.Chirps))
+	hits := &searchHits{}
+	keep := offset + limit
+
+	for _, candidate := range lists[order[0]] {
+		found := map[string]Posting{order[0]: candidate}
+		for _, term := range order[1:] {
+			postings := lists[term]
+			i := searchPostings(postings, candidate.ChirpID)
+			if i == len(postings) || postings[i].ChirpID != candidate.ChirpID {
+				found = nil
+				break
+			}
+			found[term] = postings[i]
+		}
+		if found == nil || !phrasesMatch(query.Phrases, found) {
+			continue
+		}
+		chirp, ok := dbStructure.Chirps[candidate.ChirpID]
+		if !ok || !matches(chirp) {
+			continue
+		}
+		total++
+
+		relevance := 0.0
+		for term, posting := range found {
+			tf := float64(len(posting.Positions))
+			idf := math.Log(1 + docs/float64(len(lists[term])))
+			relevance += tf / (tf + 1.2) * idf
+		}
+		recency := 0.0
+		if !chirp.CreatedAt.IsZero() {
+			recency = math.Pow(0.5, float64(now.Sub(chirp.CreatedAt))/float64(searchHalfLife))
+		}
+		score := relevance * (1 - searchRecencyWeight + searchRecencyWeight*recency)
+
+		heap.Push(hits, searchHit{chirp: chirp, score: score})
+		if hits.Len() > keep {
+			heap.Pop(hits)
+		}
+	}
+
+	ranked := make([]Chirp, hits.Len())
+	for i := len(ranked) - 1; i >= 0; i-- {
+		ranked[i] = heap.Pop(hits).(searchHit).chirp
+	}
+	if offset > len(ranked) {
+		offset = len(ranked)
+	}
+	return SearchResult{Total: total, Chirps: ranked[offset:]}, nil
+}
+
+// searchNewest serves filter-only searches by walking chirps from the
+// newest ID down, using the author index when there is an author filter.
+// Date filters narrow the IDs walked, since creation times follow IDs.
+func (dbStructure *DBStructure) searchNewest(query SearchQuery, matches func(Chirp) bool, authorID, offset, limit int) SearchResult {
+	lo, hi := 1, dbStructure.LastChirpID
+	if !query.After.IsZero() {
+		lo = dbStructure.firstChirpFrom(query.After)
+	}
+	if !query.Before.IsZero() {
+		hi = dbStructure.firstChirpFrom(query.Before) - 1
+	}
+
+	result := SearchResult{Chirps: []Chirp{}}
+	visit := func(id int) {
+		chirp, ok := dbStructure.Chirps[id]
+		if !ok || !matches(chirp) {
+			return
+		}
+		if result.Total >= offset && len(result.Chirps) < limit {
+			result.Chirps = append(result.Chirps, chirp)
+		}
+		result.Total++
+	}
+	if authorID != -1 {
+		ids := dbStructure.AuthorChirps[authorID]
+		start, end := sort.SearchInts(ids, lo), sort.SearchInts(ids, hi+1)
+		for i := end - 1; i >= start; i-- {
+			visit(ids[i])
+		}
+		return result
+	}
+	for id := hi; id >= lo; id-- {
+		visit(id)
+	}
+	return result
+}
+
+// searchAuthor resolves an author: filter to a user ID, or -1 if no such
+// user exists.
+func (dbStructure *DBStructure) searchAuthor(author string) int {
+	if id, err := strconv.Atoi(author); err == nil {
+		if _, ok := dbStructure.Users[id]; ok {
+			return id
+		}
+		return -1
+	}
+	for _, user := range dbStructure.Users {
+		if strings.EqualFold(user.Handle, author) {
+			return user.ID
+		}
+	}
+	return -1
+}
+
+// phrasesMatch checks that each phrase's terms occur at consecutive
+// positions in the chirp.
+func phrasesMatch(phrases [][]string, found map[string]Posting) bool {
+	for _, phrase := range phrases {
+		matched := false
+		for _, start := range found[phrase[0]].Positions {
+			matched = true
+			for k, term := range phrase[1:] {
+				if !containsInt(found[term].Positions, start+k+1) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func containsInt(sorted []int, n int) bool {
+	i := sort.SearchInts(sorted, n)
+	return i < len(sorted) && sorted[i] == n
+}
+
+type searchHit struct {
+	chirp Chirp
+	score float64
+}
+
+// searchHits is a min-heap on score, with older chirps ranked lower on
+// ties, holding the best hits seen so far.
+type searchHits []searchHit
+
+func (h searchHits) Len() int { return len(h) }
+func (h searchHits) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score < h[j].score
+	}
+	return h[i].chirp.ID < h[j].chirp.ID
+}
+func (h searchHits) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *searchHits) Push(x interface{}) {
+	*h = append(*h, x.(searchHit))
+}
+
+func (h *searchHits) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,372 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTestUsers(t *testing.T, db *DB, n int) []int {
+	t.Helper()
+	ids := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		user, err := db.CreateUser(fmt.Sprintf("user%d@example.com", i), "hash", Profile{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
+
+func createTestChirps(t *testing.T, db *DB, authorID int, bodies ...string) []int {
+	t.Helper()
+	ids := make([]int, 0, len(bodies))
+	for _, body := range bodies {
+		chirp, err := db.CreateChirp(Chirp{Body: body, AuthorID: authorID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, chirp.ID)
+	}
+	return ids
+}
+
+// spreadChirpTimes backdates every chirp to one day apart in ID order,
+// starting at start.
+func spreadChirpTimes(t *testing.T, db *DB, start time.Time) {
+	t.Helper()
+	err := db.update(func(dbStructure *DBStructure) error {
+		for id := 1; id <= dbStructure.LastChirpID; id++ {
+			chirp, ok := dbStructure.Chirps[id]
+			if !ok {
+				continue
+			}
+			chirp.CreatedAt = start.AddDate(0, 0, id-1)
+			dbStructure.Chirps[id] = chirp
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func searchIDs(t *testing.T, db *DB, q string, offset, limit int) ([]int, int) {
+	t.Helper()
+	query, err := ParseSearchQuery(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := db.Search(query, 0, offset, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, chirp := range result.Chirps {
+		ids = append(ids, chirp.ID)
+	}
+	return ids, result.Total
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello, World!", []string{"hello", "world"}},
+		{"don't-stop me_now", []string{"don", "t", "stop", "me", "now"}},
+		{"#golang @gopher 2024", []string{"golang", "gopher", "2024"}},
+		{"Ünïcödé ÉCOLE", []string{"ünïcödé", "école"}},
+		{"  ...  ", []string{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.text, func(t *testing.T) {
+			got := Tokenize(tc.text)
+			if len(got) == 0 && len(tc.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name string
+		q    string
+		want SearchQuery
+	}{
+		{
+			name: "terms",
+			q:    "Quick, brown fox",
+			want: SearchQuery{Terms: []string{"quick", "brown", "fox"}},
+		},
+		{
+			name: "phrase",
+			q:    `fox "lazy dog" jumps`,
+			want: SearchQuery{Terms: []string{"fox", "jumps"}, Phrases: [][]string{{"lazy", "dog"}}},
+		},
+		{
+			name: "single word phrase is a term",
+			q:    `"fox"`,
+			want: SearchQuery{Terms: []string{"fox"}},
+		},
+		{
+			name: "unterminated phrase runs to the end",
+			q:    `"lazy dog`,
+			want: SearchQuery{Phrases: [][]string{{"lazy", "dog"}}},
+		},
+		{
+			name: "filters",
+			q:    "author:@Gopher after:2024-01-01 before:2024-02-01T12:00:00+02:00",
+			want: SearchQuery{
+				Author: "Gopher",
+				After:  day("2024-01-01"),
+				Before: time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "unknown and empty filters are text",
+			q:    "lang:go author:",
+			want: SearchQuery{Terms: []string{"lang", "go", "author"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseSearchQuery(tc.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchQueryRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+	}{
+		{"empty", "   "},
+		{"only punctuation", `!!! ""`},
+		{"bad date", "fox before:yesterday"},
+		{"too many terms", strings.Repeat("word ", maxSearchTerms+1)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseSearchQuery(tc.q)
+			if err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+
+	_, err := ParseSearchQuery("  ")
+	if !errors.Is(err, ErrEmptySearch) {
+		t.Errorf("got error %v, want %v", err, ErrEmptySearch)
+	}
+}
+
+func TestSearchMatching(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 2)
+	ids := createTestChirps(t, db, users[0],
+		"the quick brown fox",
+		"a brown quick fox",
+		"quick thinking",
+	)
+	other := createTestChirps(t, db, users[1], "the quick brown fox again")
+
+	tests := []struct {
+		name string
+		q    string
+		want []int
+	}{
+		{"every term must match", "quick fox", []int{ids[0], ids[1], other[0]}},
+		{"phrase needs consecutive terms", `"quick brown"`, []int{ids[0], other[0]}},
+		{"phrase and term", `"brown quick" fox`, []int{ids[1]}},
+		{"missing term", "quick giraffe", []int{}},
+		{"author filter", fmt.Sprintf("fox author:%d", users[1]), []int{other[0]}},
+		{"unknown author", "fox author:999", []int{}},
+		{"after today", "quick after:" + time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02"), []int{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, total := searchIDs(t, db, tc.q, 0, 10)
+			if total != len(tc.want) {
+				t.Errorf("got total %d, want %d", total, len(tc.want))
+			}
+			gotSet := map[int]bool{}
+			for _, id := range got {
+				gotSet[id] = true
+			}
+			for _, id := range tc.want {
+				if !gotSet[id] {
+					t.Errorf("got %v, want %v", got, tc.want)
+					break
+				}
+			}
+			if len(got) != len(tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearchIndexFollowsDeletes(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 1)
+	ids := createTestChirps(t, db, users[0], "ephemeral words", "lasting words")
+
+	err := db.DeleteChirp(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := searchIDs(t, db, "words", 0, 10)
+	if !reflect.DeepEqual(got, []int{ids[1]}) {
+		t.Errorf("got %v, want %v", got, []int{ids[1]})
+	}
+	got, _ = searchIDs(t, db, "ephemeral", 0, 10)
+	if len(got) != 0 {
+		t.Errorf("deleted chirp is still found: %v", got)
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 1)
+	ids := createTestChirps(t, db, users[0],
+		"gopher",
+		"gopher gopher gopher",
+		"gopher rust",
+		"rust rust",
+	)
+
+	// More occurrences rank higher; on equal scores newer chirps win.
+	got, total := searchIDs(t, db, "gopher", 0, 10)
+	want := []int{ids[1], ids[2], ids[0]}
+	if !reflect.DeepEqual(got, want) || total != 3 {
+		t.Errorf("got %v (total %d), want %v (total 3)", got, total, want)
+	}
+
+	// Pages come from the same ranking.
+	got, total = searchIDs(t, db, "gopher", 1, 1)
+	if !reflect.DeepEqual(got, []int{ids[2]}) || total != 3 {
+		t.Errorf("second page: got %v (total %d), want %v (total 3)", got, total, []int{ids[2]})
+	}
+	got, _ = searchIDs(t, db, "gopher", 5, 1)
+	if len(got) != 0 {
+		t.Errorf("page past the end: got %v", got)
+	}
+
+	// Chirps missing any of the terms are left out.
+	got, _ = searchIDs(t, db, "gopher rust", 0, 10)
+	if !reflect.DeepEqual(got, []int{ids[2]}) {
+		t.Errorf("got %v, want %v", got, []int{ids[2]})
+	}
+}
+
+func TestSearchFiltersOnly(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 2)
+	mine := createTestChirps(t, db, users[0], "one", "two", "three")
+	createTestChirps(t, db, users[1], "four")
+
+	// Filter-only searches come back newest first.
+	got, total := searchIDs(t, db, fmt.Sprintf("author:%d", users[0]), 0, 2)
+	want := []int{mine[2], mine[1]}
+	if !reflect.DeepEqual(got, want) || total != 3 {
+		t.Errorf("got %v (total %d), want %v (total 3)", got, total, want)
+	}
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	got, total = searchIDs(t, db, "before:"+tomorrow, 0, 10)
+	if len(got) != 4 || total != 4 {
+		t.Errorf("before tomorrow: got %v (total %d), want all 4", got, total)
+	}
+	got, total = searchIDs(t, db, "after:"+tomorrow, 0, 10)
+	if len(got) != 0 || total != 0 {
+		t.Errorf("after tomorrow: got %v (total %d), want none", got, total)
+	}
+}
+
+func TestFirstChirpFrom(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 1)
+	ids := createTestChirps(t, db, users[0], "one", "two", "three", "four")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	spreadChirpTimes(t, db, start)
+	err := db.DeleteChirp(ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want int
+	}{
+		{"before everything", start.AddDate(-1, 0, 0), ids[0]},
+		{"exact time", start, ids[0]},
+		{"deleted chirp's day", start.AddDate(0, 0, 1), ids[1]},
+		{"between chirps", start.AddDate(0, 0, 2).Add(-time.Hour), ids[1]},
+		{"last chirp", start.AddDate(0, 0, 3), ids[3]},
+		{"after everything", start.AddDate(1, 0, 0), ids[3] + 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := dbStructure.firstChirpFrom(tc.t); got != tc.want {
+				t.Errorf("got %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearchDateFilters(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 2)
+	ids := createTestChirps(t, db, users[0], "one", "two")
+	ids = append(ids, createTestChirps(t, db, users[1], "three")...)
+	ids = append(ids, createTestChirps(t, db, users[0], "four", "five")...)
+	spreadChirpTimes(t, db, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name string
+		q    string
+		want []int
+	}{
+		{"after", "after:2024-01-03", []int{ids[4], ids[3], ids[2]}},
+		{"before", "before:2024-01-03", []int{ids[1], ids[0]}},
+		{"between", "after:2024-01-02 before:2024-01-05", []int{ids[3], ids[2], ids[1]}},
+		{"between, by author", fmt.Sprintf("author:%d after:2024-01-02 before:2024-01-05", users[0]), []int{ids[3], ids[1]}},
+		{"empty range", "after:2024-01-04 before:2024-01-02", []int{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, total := searchIDs(t, db, tc.q, 0, 10)
+			if !reflect.DeepEqual(got, tc.want) || total != len(tc.want) {
+				t.Errorf("got %v (total %d), want %v", got, total, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// Suspension stops a user from signing in or using their tokens until it
+// ends. A zero Until makes it a permanent ban.
+type Suspension struct {
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason"`
+	By     int       `json:"by"`
+	At     time.Time `json:"at"`
+	// HideChirps hides the user's chirps from everyone else while the
+	// suspension lasts.
+	HideChirps bool `json:"hide_chirps,omitempty"`
+}
+
+// Active reports whether the suspension is still in force at now.
+func (s *Suspension) Active(now time.Time) bool {
+	return s != nil && (s.Until.IsZero() || now.Before(s.Until))
+}
+
+// Permanent reports whether the suspension is a ban.
+func (s *Suspension) Permanent() bool {
+	return s != nil && s.Until.IsZero()
+}
+
+// SuspendUser suspends or bans a user, replacing any earlier suspension,
+// and records it in the audit log.
+func (db *DB) SuspendUser(userID int, suspension Suspension) (User, error) {
+	var user User
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return errors.New("User not found")
+		}
+		suspension.At = time.Now().UTC()
+		dbStructure.suspendUser(userID, suspension)
+		user = dbStructure.Users[userID]
+
+		action := "suspend"
+		if suspension.Permanent() {
+			action = "ban"
+		}
+		dbStructure.logModeration(ModerationEvent{
+			ActorID: suspension.By,
+			Action:  action,
+			UserID:  userID,
+			Note:    suspension.Reason,
+		})
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// LiftSuspension ends a user's suspension early. The user has to sign in
+// again, since their old tokens stay invalid.
+func (db *DB) LiftSuspension(userID, adminID int, note string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		user, ok := dbStructure.Users[userID]
+		if !ok {
+			return errors.New("User not found")
+		}
+		if user.Suspension == nil {
+			return nil
+		}
+		user.Suspension = nil
+		dbStructure.Users[userID] = user
+		dbStructure.logModeration(ModerationEvent{
+			ActorID: adminID,
+			Action:  "unsuspend",
+			UserID:  userID,
+			Note:    note,
+		})
+		return nil
+	})
+}
+
+// suspendUser applies a suspension and invalidates every token the user
+// holds: access tokens issued before now, their refresh token, and their
+// OAuth grants and codes.
+func (dbStructure *DBStructure) suspendUser(userID int, suspension Suspension) {
+	user, ok := dbStructure.Users[userID]
+	if !ok {
+		return
+	}
+	user.Suspension = &suspension
+	user.TokensValidAfter = suspension.At
+	user.AuthData = RefreshToken{}
+	dbStructure.Users[userID] = user
+
+	for hash, grant := range dbStructure.OAuthGrants {
+		if grant.UserID == userID {
+			delete(dbStructure.OAuthGrants, hash)
+		}
+	}
+	for hash, code := range dbStructure.OAuthCodes {
+		if code.UserID == userID {
+			delete(dbStructure.OAuthCodes, hash)
+		}
+	}
+}
+
+// chirpsSuspended reports whether a user's chirps are hidden because of a
+// suspension.
+func (dbStructure *DBStructure) chirpsSuspended(userID int) bool {
+	user, ok := dbStructure.Users[userID]
+	return ok && user.Suspension != nil && user.Suspension.HideChirps && user.Suspension.Active(time.Now())
+}
@@ -2,17 +2,53 @@ package database
 
 import (
 	"errors"
+	"strings"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
+var ErrEmailTaken = errors.New("email is already registered")
+
+// emailTaken reports whether another user has the email, ignoring case.
+// Users without an email, such as some linked through OIDC, never clash.
+func emailTaken(dbStructure DBStructure, email string, exceptID int) bool {
+	if email == "" {
+		return false
+	}
+	for _, user := range dbStructure.Users {
+		if user.ID != exceptID && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
 	ID          int          `json:"id"`
 	Email       string       `json:"email"`
 	Password    string       `json:"password"`
 	AuthData    RefreshToken `json:"authData"`
 	IsChirpyRed bool         `json:"is_chirpy_red"`
+	Profile
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt changes with the email, password, profile, preferences or
+	// membership, not with logins.
+	UpdatedAt  time.Time   `json:"updated_at"`
+	Suspension *Suspension `json:"suspension,omitempty"`
+	// TokensValidAfter rejects access tokens issued before it, so they
+	// can be invalidated before they expire.
+	TokensValidAfter time.Time `json:"tokens_valid_after"`
+	// PinnedChirpIDs are shown first on the user's profile, most recently
+	// pinned first.
+	PinnedChirpIDs []int       `json:"pinned_chirp_ids,omitempty"`
+	Preferences    Preferences `json:"preferences"`
+}
+
+// Preferences are settings that change how chirps are shown to the user.
+// Nobody else can see them.
+type Preferences struct {
+	// ExpandContentWarnings shows chirps with content warnings already
+	// expanded.
+	ExpandContentWarnings bool `json:"expand_content_warnings"`
 }
 
 type RefreshToken struct {
@@ -26,41 +62,46 @@ type ResponseUser struct {
 	Email       string `json:"email"`
 	Token       string `json:"token"`
 	IsChirpyRed bool   `json:"is_chirpy_red"`
+	Profile
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
-func (db *DB) CreateUser(email string, pass string, secret string) (ResponseUser, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return ResponseUser{}, err
-	}
-
-	id := len(dbStructure.Users) + 1
-	savedPass, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+func (db *DB) CreateUser(email string, passwordHash string, profile Profile) (ResponseUser, error) {
+	var user User
+	err := db.update(func(dbStructure *DBStructure) error {
+		if emailTaken(*dbStructure, email, 0) {
+			return ErrEmailTaken
+		}
+		if handleTaken(*dbStructure, profile.Handle, 0) {
+			return ErrHandleTaken
+		}
+		dbStructure.LastUserID++
+		now := time.Now().UTC()
+		user = User{
+			ID:          dbStructure.LastUserID,
+			Email:       email,
+			Password:    passwordHash,
+			IsChirpyRed: false,
+			Profile:     profile,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		dbStructure.Users[user.ID] = user
+		return nil
+	})
 	if err != nil {
 		return ResponseUser{}, err
 	}
 
-	user := User{
-		ID:          id,
-		Email:       email,
-		Password:    string(savedPass),
-		IsChirpyRed: false,
-	}
-
-	dbStructure.Users[id] = user
-
-	responseUser := ResponseUser{
-		ID:          id,
-		Email:       email,
+	return ResponseUser{
+		ID:          user.ID,
+		Email:       user.Email,
 		IsChirpyRed: user.IsChirpyRed,
-	}
-
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return ResponseUser{}, err
-	}
-
-	return responseUser, nil
+		Profile:     user.Profile,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+	}, nil
 }
 
 func (db *DB) GetUser(id int) (User, error) {
@@ -82,36 +123,34 @@ func (db *DB) GetUserByEmail(email string) (User, error) {
 		return User{}, err
 	}
 
+	if email == "" {
+		return User{}, errors.New("user not found")
+	}
 	for _, user := range dbStructure.Users {
-		if user.Email == email {
+		if strings.EqualFold(user.Email, email) {
 			return user, nil
 		}
 	}
 	return User{}, errors.New("user not found")
 }
 
-func (db *DB) UpdateUser(id int, email string, pass string) (User, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
-	savedPass, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
-	oldUser, err := db.GetUser(id)
-	updatedUser := User{
-		ID:       id,
-		Email:    email,
-		Password: string(savedPass),
-		AuthData: RefreshToken{
-			Token:          oldUser.AuthData.Token,
-			DateMade:       oldUser.AuthData.DateMade,
-			ExpirationDate: oldUser.AuthData.ExpirationDate,
-		},
-		IsChirpyRed: oldUser.IsChirpyRed,
-	}
-
-	dbStructure.Users[id] = updatedUser
-
-	err = db.writeDB(dbStructure)
+func (db *DB) UpdateUser(id int, email string, passwordHash string) (User, error) {
+	var updatedUser User
+	err := db.update(func(dbStructure *DBStructure) error {
+		oldUser, ok := dbStructure.Users[id]
+		if !ok {
+			return errors.New("User not found")
+		}
+		if emailTaken(*dbStructure, email, id) {
+			return ErrEmailTaken
+		}
+		updatedUser = oldUser
+		updatedUser.Email = email
+		updatedUser.Password = passwordHash
+		updatedUser.UpdatedAt = time.Now().UTC()
+		dbStructure.Users[id] = updatedUser
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
@@ -119,32 +158,32 @@ func (db *DB) UpdateUser(id int, email string, pass string) (User, error) {
 	return updatedUser, nil
 }
 
+func (db *DB) UpdatePasswordHash(id int, passwordHash string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		user, ok := dbStructure.Users[id]
+		if !ok {
+			return errors.New("User not found")
+		}
+		user.Password = passwordHash
+		dbStructure.Users[id] = user
+		return nil
+	})
+}
+
 func (db *DB) StoreRefreshToken(id int, token string) error {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
-	user, ok := dbStructure.Users[id]
-	if !ok {
-		return errors.New("User not found")
-	}
-	updatedUser := User{
-		ID:       user.ID,
-		Email:    user.Email,
-		Password: user.Password,
-		AuthData: RefreshToken{
+	return db.update(func(dbStructure *DBStructure) error {
+		user, ok := dbStructure.Users[id]
+		if !ok {
+			return errors.New("User not found")
+		}
+		user.AuthData = RefreshToken{
 			Token:          token,
 			DateMade:       time.Now().UTC(),
 			ExpirationDate: time.Now().UTC().Add(time.Hour * 24 * 60),
-		},
-		IsChirpyRed: user.IsChirpyRed,
-	}
-	dbStructure.Users[id] = updatedUser
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return err
-	}
-	return nil
+		}
+		dbStructure.Users[id] = user
+		return nil
+	})
 }
 
 func (db *DB) FindTokenCheckDate(token string) (User, bool) {
@@ -161,49 +200,48 @@ func (db *DB) FindTokenCheckDate(token string) (User, bool) {
 }
 
 func (db *DB) DeleteRefreshToken(user User) bool {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return false
-	}
-	updatedUser := User{
-		ID:       user.ID,
-		Email:    user.Email,
-		Password: user.Password,
-		AuthData: RefreshToken{
-			Token:          "",
-			DateMade:       time.Time{},
-			ExpirationDate: time.Time{},
-		},
-		IsChirpyRed: user.IsChirpyRed,
-	}
-	dbStructure.Users[user.ID] = updatedUser
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return false
-	}
-	return true
+	err := db.update(func(dbStructure *DBStructure) error {
+		updatedUser, ok := dbStructure.Users[user.ID]
+		if !ok {
+			return errors.New("User not found")
+		}
+		updatedUser.AuthData = RefreshToken{}
+		dbStructure.Users[user.ID] = updatedUser
+		return nil
+	})
+	return err == nil
 }
 
 func (db *DB) UpgradeRedMember(user User) bool {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return false
-	}
-	updatedUser := User{
-		ID:       user.ID,
-		Email:    user.Email,
-		Password: user.Password,
-		AuthData: RefreshToken{
-			Token:          user.AuthData.Token,
-			DateMade:       user.AuthData.DateMade,
-			ExpirationDate: user.AuthData.ExpirationDate,
-		},
-		IsChirpyRed: true,
-	}
-	dbStructure.Users[user.ID] = updatedUser
-	err = db.writeDB(dbStructure)
+	err := db.update(func(dbStructure *DBStructure) error {
+		updatedUser, ok := dbStructure.Users[user.ID]
+		if !ok {
+			return errors.New("User not found")
+		}
+		updatedUser.IsChirpyRed = true
+		updatedUser.UpdatedAt = time.Now().UTC()
+		dbStructure.Users[user.ID] = updatedUser
+		return nil
+	})
+	return err == nil
+}
+
+// UpdatePreferences replaces a user's preferences.
+func (db *DB) UpdatePreferences(id int, preferences Preferences) (User, error) {
+	var user User
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[id]
+		if !ok {
+			return errors.New("User not found")
+		}
+		user.Preferences = preferences
+		user.UpdatedAt = time.Now().UTC()
+		dbStructure.Users[id] = user
+		return nil
+	})
 	if err != nil {
-		return false
+		return User{}, err
 	}
-	return true
+	return user, nil
 }
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// Visibility levels say who a chirp is for. Chirps without one are
+// public. Unlisted chirps can be seen by anyone but are left out of the
+// public listings: the chirp index, hashtags, search and trending. They
+// still reach followers' timelines, lists and the author's profile.
+// Followers-only chirps are only visible to the author's followers and
+// direct chirps only to the users they mention; neither can be rechirped.
+const (
+	VisibilityPublic    = "public"
+	VisibilityUnlisted  = "unlisted"
+	VisibilityFollowers = "followers"
+	VisibilityDirect    = "direct"
+)
+
+var (
+	ErrChirpNotFound     = errors.New("chirp not found")
+	ErrUnknownVisibility = errors.New("unknown visibility")
+)
+
+// checkVisibility rejects visibility levels that don't exist.
+func checkVisibility(visibility string) error {
+	switch visibility {
+	case "", VisibilityPublic, VisibilityUnlisted, VisibilityFollowers, VisibilityDirect:
+		return nil
+	}
+	return ErrUnknownVisibility
+}
+
+// Public reports whether a chirp may appear in public listings.
+func (c Chirp) Public() bool {
+	return c.Visibility == "" || c.Visibility == VisibilityPublic
+}
+
+// ChirpHide records a moderator hiding a chirp. Hidden chirps stay in the
+// database but only their author can see them.
+type ChirpHide struct {
+	By       int       `json:"by"`
+	At       time.Time `json:"at"`
+	ReportID int       `json:"report_id,omitempty"`
+}
+
+// visibleTo reports whether a viewer may see a chirp; viewerID is 0 for
+// anonymous requests. Every read of chirps goes through here. A rechirp is
+// only visible if what it reposts is.
+func (dbStructure *DBStructure) visibleTo(chirp Chirp, viewerID int) bool {
+	if chirp.AuthorID != viewerID && (chirp.Hidden != nil || dbStructure.chirpsSuspended(chirp.AuthorID)) {
+		return false
+	}
+	if viewerID != 0 && dbStructure.blocked(viewerID, chirp.AuthorID) {
+		return false
+	}
+	if chirp.AuthorID != viewerID && !dbStructure.inAudience(chirp, viewerID) {
+		return false
+	}
+	if chirp.RechirpOfID != 0 {
+		original, ok := dbStructure.Chirps[chirp.RechirpOfID]
+		if ok && !dbStructure.visibleTo(original, viewerID) {
+			return false
+		}
+	}
+	return true
+}
+
+// inAudience reports whether a chirp's visibility level lets someone other
+// than its author see it.
+func (dbStructure *DBStructure) inAudience(chirp Chirp, viewerID int) bool {
+	switch chirp.Visibility {
+	case VisibilityFollowers:
+		_, ok := dbStructure.Following[viewerID][chirp.AuthorID]
+		return viewerID != 0 && ok
+	case VisibilityDirect:
+		for _, mention := range chirp.Mentions {
+			if viewerID != 0 && mention.UserID == viewerID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// inFeedOf is visibleTo for lists of chirps, which also leave out
+// accounts the viewer muted. Muted chirps can still be opened directly.
+func (dbStructure *DBStructure) inFeedOf(chirp Chirp, viewerID int) bool {
+	if !dbStructure.visibleTo(chirp, viewerID) {
+		return false
+	}
+	if viewerID == 0 {
+		return true
+	}
+	if dbStructure.muted(viewerID, chirp.AuthorID) {
+		return false
+	}
+	if original, ok := dbStructure.Chirps[chirp.RechirpOfID]; ok && chirp.RechirpOfID != 0 {
+		return !dbStructure.muted(viewerID, original.AuthorID)
+	}
+	return true
+}
+
+// listedFor is inFeedOf for the public listings, which only carry public
+// chirps and the viewer's own. A rechirp is listed only if its original is.
+func (dbStructure *DBStructure) listedFor(chirp Chirp, viewerID int) bool {
+	if !dbStructure.inFeedOf(chirp, viewerID) {
+		return false
+	}
+	if !chirp.Public() && chirp.AuthorID != viewerID {
+		return false
+	}
+	if original, ok := dbStructure.Chirps[chirp.RechirpOfID]; ok && chirp.RechirpOfID != 0 {
+		return original.Public() || original.AuthorID == viewerID
+	}
+	return true
+}
+
+// visibleChirp looks up a chirp the viewer may see.
+func (dbStructure *DBStructure) visibleChirp(id, viewerID int) (Chirp, bool) {
+	chirp, ok := dbStructure.Chirps[id]
+	if !ok || !dbStructure.visibleTo(chirp, viewerID) {
+		return Chirp{}, false
+	}
+	return chirp, true
+}
+
+// feedChirp looks up a chirp that belongs in the viewer's feeds.
+func (dbStructure *DBStructure) feedChirp(id, viewerID int) (Chirp, bool) {
+	chirp, ok := dbStructure.Chirps[id]
+	if !ok || !dbStructure.inFeedOf(chirp, viewerID) {
+		return Chirp{}, false
+	}
+	return chirp, true
+}
+
+// listedChirp looks up a chirp that belongs in the viewer's public
+// listings.
+func (dbStructure *DBStructure) listedChirp(id, viewerID int) (Chirp, bool) {
+	chirp, ok := dbStructure.Chirps[id]
+	if !ok || !dbStructure.listedFor(chirp, viewerID) {
+		return Chirp{}, false
+	}
+	return chirp, true
+}
+
+// visibleOriginal resolves a rechirp to its original like original, and
+// also requires the viewer to be able to see it.
+func (dbStructure *DBStructure) visibleOriginal(id, viewerID int) (Chirp, bool) {
+	chirp, ok := dbStructure.original(id)
+	if !ok || !dbStructure.visibleTo(chirp, viewerID) {
+		return Chirp{}, false
+	}
+	return chirp, true
+}
+
+// GetVisibleChirp returns a chirp if the viewer may see it.
+func (db *DB) GetVisibleChirp(id, viewerID int) (Chirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return Chirp{}, err
+	}
+	chirp, ok := dbStructure.visibleChirp(id, viewerID)
+	if !ok {
+		return Chirp{}, ErrChirpNotFound
+	}
+	return chirp, nil
+}
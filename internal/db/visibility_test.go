@@ -0,0 +1,120 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVisibilityLevels(t *testing.T) {
+	db := newTestDB(t)
+	var users []int
+	for _, handle := range []string{"author", "follower", "mentioned", "stranger"} {
+		user, err := db.CreateUser(handle+"@example.com", "hash", Profile{Handle: handle})
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user.ID)
+	}
+	author, follower, mentioned, stranger := users[0], users[1], users[2], users[3]
+	err := db.Follow(follower, author)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(visibility string) Chirp {
+		t.Helper()
+		chirp, err := db.CreateChirp(Chirp{
+			Body:       "hi @mentioned",
+			AuthorID:   author,
+			Mentions:   []Mention{{Handle: "mentioned"}},
+			Visibility: visibility,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chirp
+	}
+	public := create(VisibilityPublic)
+	unset := create("")
+	unlisted := create(VisibilityUnlisted)
+	followers := create(VisibilityFollowers)
+	direct := create(VisibilityDirect)
+	if public.Visibility != "" {
+		t.Errorf("public chirp stored with visibility %q, want none", public.Visibility)
+	}
+	rechirp, err := db.Rechirp(stranger, unlisted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	everyone := []int{author, follower, mentioned, stranger, 0}
+	tests := []struct {
+		name    string
+		chirp   Chirp
+		visible []int
+		listed  []int
+	}{
+		{"public", public, everyone, everyone},
+		{"unset", unset, everyone, everyone},
+		{"unlisted", unlisted, everyone, []int{author}},
+		{"followers", followers, []int{author, follower}, []int{author}},
+		{"direct", direct, []int{author, mentioned}, []int{author}},
+		{"rechirp of unlisted", rechirp, everyone, []int{author}},
+	}
+
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, viewerID := range everyone {
+				got := dbStructure.visibleTo(tc.chirp, viewerID)
+				if want := containsID(tc.visible, viewerID); got != want {
+					t.Errorf("visibleTo viewer %d: got %v, want %v", viewerID, got, want)
+				}
+				got = dbStructure.listedFor(tc.chirp, viewerID)
+				if want := containsID(tc.listed, viewerID); got != want {
+					t.Errorf("listedFor viewer %d: got %v, want %v", viewerID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVisibilityRejects(t *testing.T) {
+	db := newTestDB(t)
+	users := createTestUsers(t, db, 2)
+	err := db.Follow(users[1], users[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.CreateChirp(Chirp{Body: "hi", AuthorID: users[0], Visibility: "friends"})
+	if !errors.Is(err, ErrUnknownVisibility) {
+		t.Errorf("unknown visibility: got error %v, want %v", err, ErrUnknownVisibility)
+	}
+
+	for _, visibility := range []string{VisibilityFollowers, VisibilityDirect} {
+		chirp, err := db.CreateChirp(Chirp{Body: "hi", AuthorID: users[0], Visibility: visibility})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Even the author can't rechirp it to a wider audience.
+		for _, userID := range users {
+			_, err = db.Rechirp(userID, chirp.ID)
+			if !errors.Is(err, ErrCannotRechirp) && !errors.Is(err, ErrChirpNotFound) {
+				t.Errorf("rechirping %s chirp as %d: got error %v", visibility, userID, err)
+			}
+		}
+	}
+}
+
+func containsID(ids []int, id int) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrWarningOwnChirp = errors.New("moderators can't force a content warning on their own chirps")
+	ErrNoForcedWarning = errors.New("chirp has no forced content warning")
+)
+
+// ForcedWarning is a content warning a moderator put on someone else's
+// chirp. It overrides whatever the author set until a moderator lifts it,
+// and the author can't edit it away.
+type ForcedWarning struct {
+	// Text replaces the author's warning; empty keeps theirs.
+	Text      string    `json:"text,omitempty"`
+	Sensitive bool      `json:"sensitive,omitempty"`
+	By        int       `json:"by"`
+	At        time.Time `json:"at"`
+}
+
+// Warning returns the content warning and sensitive flag readers get,
+// taking any forced warning into account.
+func (c Chirp) Warning() (string, bool) {
+	if c.ForcedWarning == nil {
+		return c.ContentWarning, c.Sensitive
+	}
+	text := c.ForcedWarning.Text
+	if text == "" {
+		text = c.ContentWarning
+	}
+	return text, c.Sensitive || c.ForcedWarning.Sensitive
+}
+
+// ForceContentWarning puts a moderator's content warning on someone
+// else's chirp, replacing any forced warning already there, and records it
+// in the audit log. Rechirps get it put on the chirp they repost.
+func (db *DB) ForceContentWarning(id, moderatorID int, warning ForcedWarning, note string) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.original(id)
+		if !ok {
+			return ErrChirpNotFound
+		}
+		if chirp.AuthorID == moderatorID {
+			return ErrWarningOwnChirp
+		}
+		warning.By = moderatorID
+		warning.At = time.Now().UTC()
+		chirp.ForcedWarning = &warning
+		dbStructure.Chirps[chirp.ID] = chirp
+		dbStructure.logModeration(ModerationEvent{
+			ActorID: moderatorID,
+			Action:  "force_content_warning",
+			ChirpID: chirp.ID,
+			UserID:  chirp.AuthorID,
+			Note:    note,
+		})
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// LiftContentWarning removes a forced content warning, leaving the
+// author's own, and records it in the audit log.
+func (db *DB) LiftContentWarning(id, moderatorID int, note string) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.original(id)
+		if !ok {
+			return ErrChirpNotFound
+		}
+		if chirp.ForcedWarning == nil {
+			return ErrNoForcedWarning
+		}
+		chirp.ForcedWarning = nil
+		dbStructure.Chirps[chirp.ID] = chirp
+		dbStructure.logModeration(ModerationEvent{
+			ActorID: moderatorID,
+			Action:  "lift_content_warning",
+			ChirpID: chirp.ID,
+			UserID:  chirp.AuthorID,
+			Note:    note,
+		})
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
@@ -0,0 +1,341 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// MaxUploadSize is the largest file accepted, in bytes.
+	MaxUploadSize = 5 << 20
+	// MaxPixels caps the decoded size of an image, counting every frame of
+	// a GIF at the size of its canvas, so a small file can't expand into
+	// gigabytes of pixels.
+	MaxPixels = 25_000_000
+	// MaxFrames caps the number of frames in an animated GIF.
+	MaxFrames = 1000
+	// ThumbnailSize is the longest side of a thumbnail, in pixels.
+	ThumbnailSize = 400
+)
+
+var (
+	ErrUnsupportedType = errors.New("only JPEG, PNG and GIF images are supported")
+	ErrInvalidImage    = errors.New("could not read the image")
+	ErrImageTooLarge   = errors.New("image has too many pixels")
+)
+
+// extensions maps the content types we accept to the file extension they
+// are stored under.
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Image is an upload after processing, ready to store.
+type Image struct {
+	ContentType string
+	Ext         string
+	Data        []byte
+	Width       int
+	Height      int
+
+	ThumbnailContentType string
+	ThumbnailExt         string
+	Thumbnail            []byte
+	ThumbnailWidth       int
+	ThumbnailHeight      int
+}
+
+// Process validates an uploaded image and re-encodes it, which drops EXIF
+// and any other metadata. JPEGs are rotated upright first, since that
+// drops their orientation tag too. The content type is sniffed from the
+// data rather than trusted from the client.
+func Process(data []byte) (Image, error) {
+	contentType := http.DetectContentType(data)
+	ext, ok := extensions[contentType]
+	if !ok {
+		return Image{}, ErrUnsupportedType
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrInvalidImage
+	}
+	pixels := config.Width * config.Height
+	if contentType == "image/gif" {
+		// gif.DecodeAll decodes every frame, so check how many there are
+		// before letting it.
+		frames := gifFrameCount(data)
+		if frames > MaxFrames {
+			return Image{}, ErrImageTooLarge
+		}
+		pixels *= max(frames, 1)
+	}
+	if pixels > MaxPixels {
+		return Image{}, ErrImageTooLarge
+	}
+
+	processed := Image{ContentType: contentType, Ext: ext}
+	var still image.Image
+	var out bytes.Buffer
+	switch contentType {
+	case "image/gif":
+		animation, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return Image{}, ErrInvalidImage
+		}
+		err = gif.EncodeAll(&out, animation)
+		if err != nil {
+			return Image{}, err
+		}
+		// Frames can be smaller than the canvas, so draw the first one
+		// onto it for the thumbnail.
+		canvas := image.NewNRGBA(image.Rect(0, 0, animation.Config.Width, animation.Config.Height))
+		draw.Draw(canvas, animation.Image[0].Bounds(), animation.Image[0], animation.Image[0].Bounds().Min, draw.Over)
+		still = canvas
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Image{}, ErrInvalidImage
+		}
+		if contentType == "image/jpeg" {
+			img = orient(toNRGBA(img), jpegOrientation(data))
+			err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 90})
+		} else {
+			err = png.Encode(&out, img)
+		}
+		if err != nil {
+			return Image{}, err
+		}
+		still = img
+	}
+	processed.Data = out.Bytes()
+	processed.Width = still.Bounds().Dx()
+	processed.Height = still.Bounds().Dy()
+
+	thumbnail := thumbnail(toNRGBA(still))
+	var thumbOut bytes.Buffer
+	if contentType == "image/jpeg" {
+		processed.ThumbnailContentType, processed.ThumbnailExt = "image/jpeg", ".jpg"
+		err = jpeg.Encode(&thumbOut, thumbnail, &jpeg.Options{Quality: 80})
+	} else {
+		processed.ThumbnailContentType, processed.ThumbnailExt = "image/png", ".png"
+		err = png.Encode(&thumbOut, thumbnail)
+	}
+	if err != nil {
+		return Image{}, err
+	}
+	processed.Thumbnail = thumbOut.Bytes()
+	processed.ThumbnailWidth = thumbnail.Rect.Dx()
+	processed.ThumbnailHeight = thumbnail.Rect.Dy()
+	return processed, nil
+}
+
+// gifFrameCount counts the frames in a GIF by walking its blocks without
+// decoding any pixels. It stops at the first thing it doesn't recognise
+// and leaves reporting malformed files to the decoder.
+func gifFrameCount(data []byte) int {
+	// The header and logical screen descriptor take 13 bytes.
+	if len(data) < 13 {
+		return 0
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21:
+			// An extension: its label, then data sub-blocks.
+			pos += 2
+		case 0x2C:
+			// An image descriptor, an optional local color table and
+			// the LZW code size, then the image data sub-blocks.
+			frames++
+			if pos+10 > len(data) {
+				return frames
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++
+		default:
+			return frames
+		}
+		for pos < len(data) {
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				break
+			}
+		}
+	}
+	return frames
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Rect.Min == (image.Point{}) {
+		return nrgba
+	}
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Rect, img, bounds.Min, draw.Src)
+	return dst
+}
+
+// thumbnail scales an image down to fit in ThumbnailSize square, averaging
+// each block of source pixels. Smaller images are left as they are.
+func thumbnail(src *image.NRGBA) *image.NRGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw <= ThumbnailSize && sh <= ThumbnailSize {
+		return src
+	}
+	w, h := ThumbnailSize, max(1, sh*ThumbnailSize/sw)
+	if sh > sw {
+		w, h = max(1, sw*ThumbnailSize/sh), ThumbnailSize
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := max((y+1)*sh/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := max((x+1)*sw/w, x0+1)
+			// Weight colours by alpha so transparent pixels don't
+			// darken the edges.
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					pa := uint64(p[3])
+					r += uint64(p[0]) * pa
+					g += uint64(p[1]) * pa
+					b += uint64(p[2]) * pa
+					a += pa
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			if a > 0 {
+				dst.Pix[i] = uint8(r / a)
+				dst.Pix[i+1] = uint8(g / a)
+				dst.Pix[i+2] = uint8(b / a)
+			}
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag (1 to 8) from a JPEG,
+// returning 1, upright, if there isn't one.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		// Metadata segments all come before the start of scan.
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation finds the orientation tag in the first IFD of a TIFF
+// structure.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 1
+		}
+		return orientation
+	}
+	return 1
+}
+
+// orient applies an EXIF orientation so the image displays upright without
+// the tag.
+func orient(src *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= 1 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	// Orientations 5 to 8 swap the width and height.
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
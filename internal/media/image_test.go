@@ -0,0 +1,316 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// halves returns a w×h image whose left half is red and right half blue.
+func halves(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withEXIF inserts an APP1 segment carrying a big-endian EXIF orientation
+// tag and a comment segment right after the JPEG's start of image marker.
+func withEXIF(data []byte, orientation uint16, comment string) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(app1)+2))
+	out = append(out, app1...)
+	out = append(out, 0xFF, 0xFE)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(comment)+2))
+	out = append(out, comment...)
+	return append(out, data[2:]...)
+}
+
+// withTextChunk inserts a tEXt chunk after a PNG's IHDR chunk.
+func withTextChunk(data []byte, text string) []byte {
+	// The signature is 8 bytes and IHDR 25 including its length and CRC.
+	const ihdrEnd = 8 + 25
+	chunk := append([]byte("tEXt"), text...)
+	out := append([]byte{}, data[:ihdrEnd]...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(text)))
+	out = append(out, chunk...)
+	out = binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(chunk))
+	return append(out, data[ihdrEnd:]...)
+}
+
+// animatedGIF encodes a GIF with a w×h canvas and the given number of 1×1
+// frames, so it stays small however big it decodes to.
+func animatedGIF(t *testing.T, w, h, frames int) []byte {
+	t.Helper()
+	animation := &gif.GIF{Config: image.Config{Width: w, Height: h}}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black, color.White})
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, animation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessRejects(t *testing.T) {
+	// A GIF header claiming a 65535×65535 canvas.
+	hugeGIF := []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00")
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"text", []byte("hello, world"), ErrUnsupportedType},
+		{"empty", nil, ErrUnsupportedType},
+		{"bmp", []byte("BM\x00\x00\x00\x00\x00\x00\x00\x00"), ErrUnsupportedType},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), ErrUnsupportedType},
+		{"truncated png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), ErrInvalidImage},
+		{"too many pixels", hugeGIF, ErrImageTooLarge},
+		{"too many pixels across frames", animatedGIF(t, 1000, 1000, 26), ErrImageTooLarge},
+		{"too many frames", animatedGIF(t, 1, 1, MaxFrames+1), ErrImageTooLarge},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Process(tc.data)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("got error %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestGIFFrameCount(t *testing.T) {
+	for _, frames := range []int{1, 2, 25, MaxFrames} {
+		got := gifFrameCount(animatedGIF(t, 1000, 1000, frames))
+		if got != frames {
+			t.Errorf("got %d frames, want %d", got, frames)
+		}
+	}
+
+	// A budget of frames that just fits is still accepted.
+	_, err := Process(animatedGIF(t, 1000, 1000, MaxPixels/(1000*1000)))
+	if err != nil {
+		t.Errorf("got error %v for a GIF within the budget", err)
+	}
+}
+
+func TestProcessTypes(t *testing.T) {
+	animation := &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(10, 10, 20, 20), color.Palette{color.Black, color.White}),
+			image.NewPaletted(image.Rect(0, 0, 30, 20), color.Palette{color.Black, color.White}),
+		},
+		Delay:  []int{10, 10},
+		Config: image.Config{Width: 30, Height: 20},
+	}
+	var gifData bytes.Buffer
+	err := gif.EncodeAll(&gifData, animation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		data          []byte
+		contentType   string
+		thumbnailType string
+		width, height int
+	}{
+		{"png", encodePNG(t, halves(30, 20)), "image/png", "image/png", 30, 20},
+		{"jpeg", encodeJPEG(t, halves(30, 20)), "image/jpeg", "image/jpeg", 30, 20},
+		{"animated gif", gifData.Bytes(), "image/gif", "image/png", 30, 20},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := Process(tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.ContentType != tc.contentType || img.ThumbnailContentType != tc.thumbnailType {
+				t.Errorf("got types %s and %s, want %s and %s", img.ContentType, img.ThumbnailContentType, tc.contentType, tc.thumbnailType)
+			}
+			if img.Width != tc.width || img.Height != tc.height {
+				t.Errorf("got %d×%d, want %d×%d", img.Width, img.Height, tc.width, tc.height)
+			}
+			if img.Ext != extensions[tc.contentType] {
+				t.Errorf("got extension %s for %s", img.Ext, tc.contentType)
+			}
+		})
+	}
+
+	img, err := Process(gifData.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := gif.DecodeAll(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Image) != 2 {
+		t.Errorf("got %d frames, want 2", len(out.Image))
+	}
+}
+
+func TestProcessAppliesEXIFOrientation(t *testing.T) {
+	// Orientation 6 means the camera was turned a quarter clockwise, so
+	// the stored left edge is the top of the picture.
+	data := withEXIF(encodeJPEG(t, halves(64, 32)), 6, "taken at home")
+	if jpegOrientation(data) != 6 {
+		t.Fatal("test image has no orientation tag")
+	}
+
+	img, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != 32 || img.Height != 64 {
+		t.Fatalf("got %d×%d, want 32×64", img.Width, img.Height)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := color.NRGBAModel.Convert(decoded.At(16, 8)).(color.NRGBA)
+	bottom := color.NRGBAModel.Convert(decoded.At(16, 56)).(color.NRGBA)
+	if top.R < 200 || top.B > 60 || bottom.B < 200 || bottom.R > 60 {
+		t.Errorf("image wasn't rotated: top %v, bottom %v", top, bottom)
+	}
+
+	if jpegOrientation(img.Data) != 1 {
+		t.Error("orientation tag was kept")
+	}
+	for _, leaked := range []string{"Exif", "taken at home"} {
+		if bytes.Contains(img.Data, []byte(leaked)) {
+			t.Errorf("processed image still contains %q", leaked)
+		}
+	}
+}
+
+func TestProcessStripsPNGMetadata(t *testing.T) {
+	data := withTextChunk(encodePNG(t, halves(30, 20)), "Comment\x00taken at home")
+	_, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("test image doesn't decode: %v", err)
+	}
+
+	img, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(img.Data, []byte("taken at home")) || bytes.Contains(img.Thumbnail, []byte("taken at home")) {
+		t.Error("processed image still contains the text chunk")
+	}
+}
+
+func TestProcessThumbnailBounds(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		thumbW        int
+		thumbH        int
+	}{
+		{"small", 50, 40, 50, 40},
+		{"exactly the limit", ThumbnailSize, ThumbnailSize, ThumbnailSize, ThumbnailSize},
+		{"wide", 1000, 500, ThumbnailSize, 200},
+		{"tall", 300, 900, 133, ThumbnailSize},
+		{"very thin", 2000, 1, ThumbnailSize, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := Process(encodePNG(t, halves(tc.width, tc.height)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.ThumbnailWidth != tc.thumbW || img.ThumbnailHeight != tc.thumbH {
+				t.Errorf("got thumbnail %d×%d, want %d×%d", img.ThumbnailWidth, img.ThumbnailHeight, tc.thumbW, tc.thumbH)
+			}
+			thumb, err := png.DecodeConfig(bytes.NewReader(img.Thumbnail))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if thumb.Width != img.ThumbnailWidth || thumb.Height != img.ThumbnailHeight {
+				t.Errorf("thumbnail is %d×%d but reported as %d×%d", thumb.Width, thumb.Height, img.ThumbnailWidth, img.ThumbnailHeight)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3×2 image with only the top left pixel set, and where each
+	// orientation moves it to.
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	src.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+
+	tests := []struct {
+		orientation   int
+		width, height int
+		x, y          int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+	for _, tc := range tests {
+		dst := orient(src, tc.orientation)
+		if dst.Rect.Dx() != tc.width || dst.Rect.Dy() != tc.height {
+			t.Errorf("orientation %d: got %d×%d, want %d×%d", tc.orientation, dst.Rect.Dx(), dst.Rect.Dy(), tc.width, tc.height)
+			continue
+		}
+		if dst.NRGBAAt(tc.x, tc.y).R != 255 {
+			t.Errorf("orientation %d: marked pixel isn't at (%d, %d)", tc.orientation, tc.x, tc.y)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlobStores(t *testing.T) {
+	local, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]BlobStore{
+		"local":  local,
+		"memory": NewMemoryStore(),
+	}
+
+	ctx := context.Background()
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.Get(ctx, "missing.png")
+			if !errors.Is(err, ErrBlobNotFound) {
+				t.Errorf("got error %v for a missing blob, want ErrBlobNotFound", err)
+			}
+
+			err = store.Put(ctx, "abc.png", []byte("image"), "image/png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			blob, err := store.Get(ctx, "abc.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(blob)
+			blob.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "image" {
+				t.Errorf("got %q, want %q", data, "image")
+			}
+
+			err = store.Delete(ctx, "abc.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = store.Get(ctx, "abc.png")
+			if !errors.Is(err, ErrBlobNotFound) {
+				t.Errorf("got error %v after deleting, want ErrBlobNotFound", err)
+			}
+			err = store.Delete(ctx, "abc.png")
+			if err != nil {
+				t.Errorf("deleting twice: %v", err)
+			}
+		})
+	}
+}
+
+func TestLocalStoreRejectsUnsafeKeys(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "media")
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files next to the store and hidden ones inside it, which a key
+	// must not be able to reach.
+	err = os.WriteFile(filepath.Join(parent, "secret"), []byte("secret"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, ".hidden"), []byte("secret"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	keys := []string{
+		"",
+		".",
+		"..",
+		".hidden",
+		".upload-123",
+		"../secret",
+		"a/b.png",
+		"/etc/passwd",
+		`..\secret`,
+		`a\b.png`,
+	}
+	for _, key := range keys {
+		_, err := store.path(key)
+		if !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("path(%q): got error %v, want ErrBlobNotFound", key, err)
+		}
+		_, err = store.Get(ctx, key)
+		if !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Get(%q): got error %v, want ErrBlobNotFound", key, err)
+		}
+		err = store.Put(ctx, key, []byte("overwritten"), "image/png")
+		if !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Put(%q): got error %v, want ErrBlobNotFound", key, err)
+		}
+		err = store.Delete(ctx, key)
+		if !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Delete(%q): got error %v, want ErrBlobNotFound", key, err)
+		}
+	}
+
+	for _, path := range []string{filepath.Join(parent, "secret"), filepath.Join(dir, ".hidden")} {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != "secret" {
+			t.Errorf("%s was touched: %q, %v", path, data, err)
+		}
+	}
+
+	path, err := store.path("abc_thumb.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "abc_thumb.png") {
+		t.Errorf("got path %s", path)
+	}
+}
@@ -0,0 +1,394 @@
+// Package moderation checks chirp bodies against configurable rules before
+// they're published.
+package moderation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Action is what happens to a chirp when a rule matches it. Actions are
+// ordered by severity; a chirp gets the most severe action of any rule
+// that matched. Warn rules also put a content warning on the chirp
+// whatever its final action.
+type Action string
+
+const (
+	ActionAllow  Action = "allow"
+	ActionWarn   Action = "warn"
+	ActionMask   Action = "mask"
+	ActionHold   Action = "hold"
+	ActionReject Action = "reject"
+)
+
+// Mask replaces every masked span of a chirp.
+const Mask = "****"
+
+var severity = map[Action]int{
+	ActionAllow:  0,
+	ActionWarn:   1,
+	ActionMask:   2,
+	ActionHold:   3,
+	ActionReject: 4,
+}
+
+// Match is a span of a body flagged by a rule. Offsets are in bytes.
+type Match struct {
+	Rule   string
+	Action Action
+	Start  int
+	End    int
+}
+
+// Filter is one pluggable moderation rule.
+type Filter interface {
+	Name() string
+	Match(body string) []Match
+}
+
+// Decision is the outcome of moderating a body. Body has the masked spans
+// replaced; it is only meaningful when Action is allow, warn or mask.
+type Decision struct {
+	Action  Action
+	Body    string
+	Matches []Match
+	// Warnings names the warn rules that matched, in the order they first
+	// matched.
+	Warnings []string
+}
+
+// Rules is the JSON rules file.
+type Rules struct {
+	WordLists []WordListRule `json:"word_lists"`
+	Patterns  []PatternRule  `json:"patterns"`
+}
+
+// WordListRule matches whole words or phrases, ignoring case and
+// punctuation. Words come from Words and from File, one per line, with
+// File resolved relative to the rules file.
+type WordListRule struct {
+	Name   string   `json:"name"`
+	Action Action   `json:"action"`
+	Words  []string `json:"words"`
+	File   string   `json:"file"`
+}
+
+// PatternRule matches a regular expression against the raw body.
+type PatternRule struct {
+	Name    string `json:"name"`
+	Action  Action `json:"action"`
+	Pattern string `json:"pattern"`
+}
+
+// DefaultRules masks the words chirpy has always filtered.
+var DefaultRules = Rules{
+	WordLists: []WordListRule{{
+		Name:   "profanity",
+		Action: ActionMask,
+		Words:  []string{"kerfuffle", "sharbert", "fornax"},
+	}},
+}
+
+// Pipeline runs a body through every filter. It is safe for concurrent use
+// and can be reloaded from its rules file while serving.
+type Pipeline struct {
+	path    string
+	mu      sync.RWMutex
+	filters []Filter
+}
+
+// NewPipeline builds a pipeline from fixed filters.
+func NewPipeline(filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+// LoadPipeline builds a pipeline from a JSON rules file, or from
+// DefaultRules when path is empty.
+func LoadPipeline(path string) (*Pipeline, error) {
+	pipeline := &Pipeline{path: path}
+	if path == "" {
+		filters, err := DefaultRules.filters("")
+		if err != nil {
+			return nil, err
+		}
+		pipeline.filters = filters
+		return pipeline, nil
+	}
+	err := pipeline.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return pipeline, nil
+}
+
+// Reload rereads the rules file. The old rules stay in place if the new
+// ones can't be loaded.
+func (p *Pipeline) Reload() error {
+	if p.path == "" {
+		return nil
+	}
+	dat, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	rules := Rules{}
+	err = json.Unmarshal(dat, &rules)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", p.path, err)
+	}
+	filters, err := rules.filters(filepath.Dir(p.path))
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.filters = filters
+	return nil
+}
+
+// Moderate runs body through every filter and masks what needs masking.
+func (p *Pipeline) Moderate(body string) Decision {
+	p.mu.RLock()
+	filters := p.filters
+	p.mu.RUnlock()
+
+	decision := Decision{Action: ActionAllow, Body: body, Matches: []Match{}}
+	for _, filter := range filters {
+		for _, match := range filter.Match(body) {
+			decision.Matches = append(decision.Matches, match)
+			if match.Action == ActionWarn && !slices.Contains(decision.Warnings, match.Rule) {
+				decision.Warnings = append(decision.Warnings, match.Rule)
+			}
+			if severity[match.Action] > severity[decision.Action] {
+				decision.Action = match.Action
+			}
+		}
+	}
+	decision.Body = mask(body, decision.Matches)
+	return decision
+}
+
+// mask replaces the spans of masking matches, merging any that overlap.
+func mask(body string, matches []Match) string {
+	spans := [][2]int{}
+	for _, match := range matches {
+		if match.Action == ActionMask {
+			spans = append(spans, [2]int{match.Start, match.End})
+		}
+	}
+	if len(spans) == 0 {
+		return body
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		if span[1] <= last {
+			continue
+		}
+		if span[0] >= last {
+			b.WriteString(body[last:span[0]])
+			b.WriteString(Mask)
+		}
+		last = span[1]
+	}
+	b.WriteString(body[last:])
+	return b.String()
+}
+
+func (rules Rules) filters(dir string) ([]Filter, error) {
+	filters := []Filter{}
+	for _, rule := range rules.WordLists {
+		if err := checkRule(rule.Name, rule.Action); err != nil {
+			return nil, err
+		}
+		words := append([]string{}, rule.Words...)
+		if rule.File != "" {
+			path := rule.File
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			dat, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			for _, line := range strings.Split(string(dat), "\n") {
+				line = strings.TrimSpace(line)
+				if line != "" && !strings.HasPrefix(line, "#") {
+					words = append(words, line)
+				}
+			}
+		}
+		filters = append(filters, NewWordList(rule.Name, rule.Action, words))
+	}
+	for _, rule := range rules.Patterns {
+		if err := checkRule(rule.Name, rule.Action); err != nil {
+			return nil, err
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		filters = append(filters, &PatternFilter{name: rule.Name, action: rule.Action, pattern: pattern})
+	}
+	return filters, nil
+}
+
+func checkRule(name string, action Action) error {
+	if name == "" {
+		return errors.New("every moderation rule needs a name")
+	}
+	if _, ok := severity[action]; !ok || action == ActionAllow {
+		return fmt.Errorf("rule %s: action must be warn, mask, hold or reject", name)
+	}
+	return nil
+}
+
+// WordList matches words and phrases on word boundaries, so punctuation
+// next to a word doesn't hide it. Words are compared after folding, so
+// case, diacritics, fullwidth forms and invisible characters don't hide
+// them either.
+type WordList struct {
+	name   string
+	action Action
+	// phrases maps the first word of each phrase to the phrases starting
+	// with it.
+	phrases map[string][][]string
+}
+
+func NewWordList(name string, action Action, words []string) *WordList {
+	list := &WordList{name: name, action: action, phrases: map[string][][]string{}}
+	for _, word := range words {
+		tokens := tokens(word)
+		if len(tokens) == 0 {
+			continue
+		}
+		phrase := make([]string, len(tokens))
+		for i, token := range tokens {
+			phrase[i] = token.text
+		}
+		list.phrases[phrase[0]] = append(list.phrases[phrase[0]], phrase)
+	}
+	return list
+}
+
+func (l *WordList) Name() string { return l.name }
+
+func (l *WordList) Match(body string) []Match {
+	words := tokens(body)
+	matches := []Match{}
+	for i, word := range words {
+	phrases:
+		for _, phrase := range l.phrases[word.text] {
+			if i+len(phrase) > len(words) {
+				continue
+			}
+			for k := 1; k < len(phrase); k++ {
+				if words[i+k].text != phrase[k] {
+					continue phrases
+				}
+			}
+			matches = append(matches, Match{
+				Rule:   l.name,
+				Action: l.action,
+				Start:  word.start,
+				End:    words[i+len(phrase)-1].end,
+			})
+			break
+		}
+	}
+	return matches
+}
+
+type token struct {
+	text       string
+	start, end int
+}
+
+// tokens splits s into runs of letters and digits with their byte offsets
+// in s. Each token's text is folded: compatibility forms such as fullwidth
+// letters are normalized as in NFKC, diacritics are dropped and letters
+// are lowercased. Default-ignorable code points such as zero-width joiners
+// are skipped without ending the word they're in.
+func tokens(s string) []token {
+	result := []token{}
+	var text strings.Builder
+	start, end := -1, 0
+	for i, r := range s {
+		if ignorable(r) {
+			continue
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				result = append(result, token{text: text.String(), start: start, end: end})
+				text.Reset()
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		end = i + utf8.RuneLen(r)
+		foldRune(&text, r)
+	}
+	if start >= 0 {
+		result = append(result, token{text: text.String(), start: start, end: end})
+	}
+	return result
+}
+
+// ignorable reports whether r is invisible and can be dropped from a word:
+// format characters, variation selectors, other default-ignorable code
+// points and combining marks, which folding drops anyway.
+func ignorable(r rune) bool {
+	return unicode.In(r, unicode.Cf, unicode.Mn, unicode.Variation_Selector, unicode.Other_Default_Ignorable_Code_Point)
+}
+
+// foldRune writes r decomposed to its compatibility form without any
+// combining marks, lowercased.
+func foldRune(b *strings.Builder, r rune) {
+	if r < utf8.RuneSelf {
+		b.WriteRune(unicode.ToLower(r))
+		return
+	}
+	for _, d := range norm.NFKD.String(string(r)) {
+		if !unicode.Is(unicode.Mn, d) {
+			b.WriteRune(unicode.ToLower(d))
+		}
+	}
+}
+
+// PatternFilter matches a regular expression.
+type PatternFilter struct {
+	name    string
+	action  Action
+	pattern *regexp.Regexp
+}
+
+func (f *PatternFilter) Name() string { return f.name }
+
+func (f *PatternFilter) Match(body string) []Match {
+	matches := []Match{}
+	for _, loc := range f.pattern.FindAllStringIndex(body, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		matches = append(matches, Match{Rule: f.name, Action: f.action, Start: loc[0], End: loc[1]})
+	}
+	return matches
+}
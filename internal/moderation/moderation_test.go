@@ -0,0 +1,193 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestWordListMatches(t *testing.T) {
+	list := NewWordList("profanity", ActionMask, []string{"kerfuffle", "Fornax", "ice cream", "  "})
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"plain", "what a kerfuffle", "what a ****"},
+		{"case", "KerFuffle!", "****!"},
+		{"punctuation around", "(kerfuffle), 'fornax'.", "(****), '****'."},
+		{"inside a word", "kerfuffles and unfornax", "kerfuffles and unfornax"},
+		{"fullwidth", "a ｋｅｒｆｕｆｆｌｅ here", "a **** here"},
+		{"precomposed diacritic", "kérfuffle", "****"},
+		{"combining diacritic", "ke\u0301rfuffle", "****"},
+		{"zero-width joiner", "ker\u200dfuffle", "****"},
+		{"zero-width space", "ker\u200bfuffle!", "****!"},
+		{"soft hyphen", "ker\u00adfuffle", "****"},
+		{"phrase", "I love ice cream.", "I love ****."},
+		{"phrase across punctuation", "ice, cream", "****"},
+		{"phrase across lines", "ice\ncream", "****"},
+		{"partial phrase", "ice creamery", "ice creamery"},
+		{"non-latin text", "ядро kerfuffle 漢字", "ядро **** 漢字"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := NewPipeline(list).Moderate(tc.body)
+			if got.Body != tc.want {
+				t.Errorf("got %q, want %q", got.Body, tc.want)
+			}
+		})
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []token
+	}{
+		{"Hi, there", []token{{"hi", 0, 2}, {"there", 4, 9}}},
+		{"ＡＢ", []token{{"ab", 0, 6}}},
+		{"café", []token{{"cafe", 0, 5}}},
+		{"\u200dab\u200d", []token{{"ab", 3, 5}}},
+		{"ﬁne", []token{{"fine", 0, 5}}},
+		{"...", []token{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.s, func(t *testing.T) {
+			got := tokens(tc.s)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMaskMerging(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		matches []Match
+		want    string
+	}{
+		{"none", "hello", nil, "hello"},
+		{"separate", "ab cd ef", []Match{{Action: ActionMask, Start: 0, End: 2}, {Action: ActionMask, Start: 6, End: 8}}, "**** cd ****"},
+		{"overlapping", "abcdef", []Match{{Action: ActionMask, Start: 2, End: 5}, {Action: ActionMask, Start: 0, End: 3}}, "****f"},
+		{"nested", "abcdef", []Match{{Action: ActionMask, Start: 0, End: 6}, {Action: ActionMask, Start: 2, End: 3}}, "****"},
+		{"adjacent", "abcdef", []Match{{Action: ActionMask, Start: 0, End: 3}, {Action: ActionMask, Start: 3, End: 6}}, "********"},
+		{"other actions aren't masked", "abcdef", []Match{{Action: ActionWarn, Start: 0, End: 3}, {Action: ActionHold, Start: 3, End: 6}}, "abcdef"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := mask(tc.body, tc.matches)
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestModerateSeverity(t *testing.T) {
+	pipeline := NewPipeline(
+		NewWordList("spoilers", ActionWarn, []string{"ending"}),
+		NewWordList("gore", ActionWarn, []string{"blood"}),
+		NewWordList("profanity", ActionMask, []string{"kerfuffle"}),
+		NewWordList("spam", ActionHold, []string{"free money"}),
+		&PatternFilter{name: "links", action: ActionReject, pattern: regexp.MustCompile(`https?://\S+`)},
+	)
+
+	tests := []struct {
+		name     string
+		body     string
+		action   Action
+		warnings []string
+	}{
+		{"clean", "hello there", ActionAllow, nil},
+		{"warn", "the ending is sad", ActionWarn, []string{"spoilers"}},
+		{"warnings in rule order, once each", "blood, the ending, more blood", ActionWarn, []string{"spoilers", "gore"}},
+		{"mask beats warn", "the ending was a kerfuffle", ActionMask, []string{"spoilers"}},
+		{"hold beats mask", "free money kerfuffle", ActionHold, nil},
+		{"reject beats everything", "free money at http://example.com, ending", ActionReject, []string{"spoilers"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := pipeline.Moderate(tc.body)
+			if got.Action != tc.action {
+				t.Errorf("got action %s, want %s", got.Action, tc.action)
+			}
+			if !reflect.DeepEqual(got.Warnings, tc.warnings) {
+				t.Errorf("got warnings %q, want %q", got.Warnings, tc.warnings)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+	write := func(name, contents string) {
+		t.Helper()
+		err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("words.txt", "# one per line\nsharbert\n\n")
+	write("rules.json", `{"word_lists": [{"name": "profanity", "action": "mask", "words": ["kerfuffle"], "file": "words.txt"}]}`)
+
+	pipeline, err := LoadPipeline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pipeline.Moderate("kerfuffle sharbert").Body; got != "**** ****" {
+		t.Fatalf("got %q, want both words masked", got)
+	}
+
+	bad := []struct {
+		name  string
+		rules string
+	}{
+		{"invalid json", `{"word_lists": [`},
+		{"missing name", `{"word_lists": [{"action": "mask", "words": ["fornax"]}]}`},
+		{"unknown action", `{"word_lists": [{"name": "x", "action": "delete", "words": ["fornax"]}]}`},
+		{"allow action", `{"patterns": [{"name": "x", "action": "allow", "pattern": "fornax"}]}`},
+		{"bad pattern", `{"patterns": [{"name": "x", "action": "reject", "pattern": "("}]}`},
+		{"missing word file", `{"word_lists": [{"name": "x", "action": "mask", "file": "missing.txt"}]}`},
+	}
+	for _, tc := range bad {
+		t.Run(tc.name, func(t *testing.T) {
+			write("rules.json", tc.rules)
+			err := pipeline.Reload()
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			// The old rules are still in force.
+			got := pipeline.Moderate("kerfuffle sharbert fornax")
+			if got.Body != "**** **** fornax" {
+				t.Errorf("got %q after a failed reload", got.Body)
+			}
+		})
+	}
+
+	write("rules.json", `{"patterns": [{"name": "stars", "action": "hold", "pattern": "fornax"}]}`)
+	err = pipeline.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := pipeline.Moderate("kerfuffle fornax")
+	if got.Body != "kerfuffle fornax" || got.Action != ActionHold {
+		t.Errorf("after reloading: got %q with action %s", got.Body, got.Action)
+	}
+}
+
+func TestDefaultRules(t *testing.T) {
+	pipeline, err := LoadPipeline("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := pipeline.Moderate("This is a Kerfuffle opinion I need to share with the world")
+	if got.Body != "This is a **** opinion I need to share with the world" || got.Action != ActionMask {
+		t.Errorf("got %q with action %s", got.Body, got.Action)
+	}
+}
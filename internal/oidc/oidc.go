@@ -0,0 +1,364 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyRefreshInterval limits how often an unknown key ID can trigger a JWKS
+// fetch, so forged tokens can't be used to hammer the provider.
+const keyRefreshInterval = time.Minute
+
+type Config struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+	// TrustedEmail lets a verified email from this provider sign in to an
+	// existing account with the same address. Leave it off unless the
+	// provider controls the addresses it vouches for.
+	TrustedEmail bool `json:"trusted_email"`
+}
+
+// Metadata is the subset of the discovery document Chirpy relies on.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *Metadata
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{
+		config: config,
+		client: client,
+	}
+}
+
+// LoadProviders reads a JSON array of provider configs. Discovery happens
+// lazily on first use so a provider being down doesn't stop the server.
+func LoadProviders(path string, client *http.Client) (map[string]*Provider, error) {
+	providers := map[string]*Provider{}
+	if path == "" {
+		return providers, nil
+	}
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	configs := []Config{}
+	err = json.Unmarshal(dat, &configs)
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range configs {
+		if config.Name == "" || config.Issuer == "" || config.ClientID == "" {
+			return nil, errors.New("oidc provider needs a name, issuer and client_id")
+		}
+		providers[config.Name] = NewProvider(config, client)
+	}
+	return providers, nil
+}
+
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+func (p *Provider) TrustedEmail() bool {
+	return p.config.TrustedEmail
+}
+
+func (p *Provider) discover(ctx context.Context) (Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	metadata := Metadata{}
+	err := p.getJSON(ctx, wellKnown, &metadata)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if metadata.Issuer != p.config.Issuer {
+		return Metadata{}, fmt.Errorf("issuer mismatch: configured %q, provider reports %q", p.config.Issuer, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return Metadata{}, errors.New("discovery document is missing required endpoints")
+	}
+	p.metadata = &metadata
+	return metadata, nil
+}
+
+// AuthCodeURL builds the provider URL the user is redirected to. The code
+// challenge is the S256 PKCE challenge for the verifier kept by the caller.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems the authorization code and returns the verified claims
+// of the ID token that came back with it.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (IDTokenClaims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		metadata.TokenEndpoint,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return IDTokenClaims{}, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	tokens := struct {
+		IDToken string `json:"id_token"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&tokens)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+	if tokens.IDToken == "" {
+		return IDTokenClaims{}, errors.New("token response has no id_token")
+	}
+	return p.VerifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature against the provider's JWKS and the
+// issuer, audience, expiry and nonce claims.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (IDTokenClaims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+	claims := IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(
+		rawToken,
+		&claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.key(ctx, metadata.JWKSURI, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+	if claims.Subject == "" {
+		return IDTokenClaims{}, errors.New("id token has no subject")
+	}
+	if claims.Nonce != nonce {
+		return IDTokenClaims{}, errors.New("id token nonce mismatch")
+	}
+	return claims, nil
+}
+
+func (p *Provider) key(ctx context.Context, jwksURI, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.lookupKey(kid)
+	if ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	err := p.getJSON(ctx, jwksURI, &set)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = publicKey
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	key, ok = p.lookupKey(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// lookupKey finds a key by ID. Tokens without a kid are accepted only when
+// the provider publishes a single key.
+func (p *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("rsa exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,294 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "chirpy-test"
+
+// testIssuer is an OpenID provider serving discovery, a JWKS with one RSA
+// and one EC key, and a token endpoint handing out idToken.
+type testIssuer struct {
+	server  *httptest.Server
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	idToken string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                issuer.server.URL,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			TokenEndpoint:         issuer.server.URL + "/token",
+			JWKSURI:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]jsonWebKey{
+			"keys": {
+				{
+					Kty: "RSA",
+					Kid: "rsa",
+					Use: "sig",
+					N:   encodeBigInt(rsaKey.N),
+					E:   encodeBigInt(big.NewInt(int64(rsaKey.E))),
+				},
+				{
+					Kty: "EC",
+					Kid: "ec",
+					Crv: "P-256",
+					X:   encodeBigInt(ecKey.X),
+					Y:   encodeBigInt(ecKey.Y),
+				},
+			},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, _, _ := r.BasicAuth()
+		if clientID != testClientID || r.FormValue("code") != "good-code" || r.FormValue("code_verifier") != "verifier" {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": issuer.idToken})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) provider() *Provider {
+	return NewProvider(Config{
+		Name:     "test",
+		Issuer:   i.server.URL,
+		ClientID: testClientID,
+	}, i.server.Client())
+}
+
+func (i *testIssuer) claims() IDTokenClaims {
+	now := time.Now()
+	return IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.server.URL,
+			Subject:   "user-1",
+			Audience:  jwt.ClaimStrings{testClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+		Nonce: "nonce",
+		Email: "user@example.com",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims IDTokenClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   func(claims IDTokenClaims) string
+		nonce   string
+		wantErr bool
+	}{
+		{
+			name: "rsa",
+			token: func(claims IDTokenClaims) string {
+				return sign(t, jwt.SigningMethodRS256, "rsa", issuer.rsaKey, claims)
+			},
+			nonce: "nonce",
+		},
+		{
+			name: "ec",
+			token: func(claims IDTokenClaims) string {
+				return sign(t, jwt.SigningMethodES256, "ec", issuer.ecKey, claims)
+			},
+			nonce: "nonce",
+		},
+		{
+			name: "wrong nonce",
+			token: func(claims IDTokenClaims) string {
+				return sign(t, jwt.SigningMethodRS256, "rsa", issuer.rsaKey, claims)
+			},
+			nonce:   "other",
+			wantErr: true,
+		},
+		{
+			name: "signed with another key",
+			token: func(claims IDTokenClaims) string {
+				return sign(t, jwt.SigningMethodRS256, "rsa", otherKey, claims)
+			},
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name: "unknown key ID",
+			token: func(claims IDTokenClaims) string {
+				return sign(t, jwt.SigningMethodRS256, "missing", issuer.rsaKey, claims)
+			},
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name: "no key ID with several keys published",
+			token: func(claims IDTokenClaims) string {
+				return sign(t, jwt.SigningMethodRS256, "", issuer.rsaKey, claims)
+			},
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name: "symmetric algorithm",
+			token: func(claims IDTokenClaims) string {
+				return sign(t, jwt.SigningMethodHS256, "rsa", []byte("secret"), claims)
+			},
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name: "wrong issuer",
+			token: func(claims IDTokenClaims) string {
+				claims.Issuer = "https://evil.example.com"
+				return sign(t, jwt.SigningMethodRS256, "rsa", issuer.rsaKey, claims)
+			},
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name: "wrong audience",
+			token: func(claims IDTokenClaims) string {
+				claims.Audience = jwt.ClaimStrings{"someone-else"}
+				return sign(t, jwt.SigningMethodRS256, "rsa", issuer.rsaKey, claims)
+			},
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			token: func(claims IDTokenClaims) string {
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+				return sign(t, jwt.SigningMethodRS256, "rsa", issuer.rsaKey, claims)
+			},
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name: "no expiry",
+			token: func(claims IDTokenClaims) string {
+				claims.ExpiresAt = nil
+				return sign(t, jwt.SigningMethodRS256, "rsa", issuer.rsaKey, claims)
+			},
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name: "no subject",
+			token: func(claims IDTokenClaims) string {
+				claims.Subject = ""
+				return sign(t, jwt.SigningMethodRS256, "rsa", issuer.rsaKey, claims)
+			},
+			nonce:   "nonce",
+			wantErr: true,
+		},
+	}
+
+	provider := issuer.provider()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := provider.VerifyIDToken(context.Background(), tc.token(issuer.claims()), tc.nonce)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected the token to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "user-1" || claims.Email != "user@example.com" {
+				t.Errorf("got claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestExchange(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.idToken = sign(t, jwt.SigningMethodRS256, "rsa", issuer.rsaKey, issuer.claims())
+	provider := issuer.provider()
+
+	claims, err := provider.Exchange(context.Background(), "good-code", "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" {
+		t.Errorf("got subject %q, want %q", claims.Subject, "user-1")
+	}
+
+	_, err = provider.Exchange(context.Background(), "bad-code", "verifier", "nonce")
+	if err == nil {
+		t.Error("expected a rejected code to fail")
+	}
+	_, err = provider.Exchange(context.Background(), "good-code", "verifier", "other")
+	if err == nil {
+		t.Error("expected a nonce mismatch to fail")
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := NewProvider(Config{
+		Name:     "test",
+		Issuer:   issuer.server.URL + "/",
+		ClientID: testClientID,
+	}, issuer.server.Client())
+
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err == nil {
+		t.Fatal("expected a discovery document for another issuer to be rejected")
+	}
+}
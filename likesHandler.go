@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+func (cfg *apiConfig) handlePUTLike(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithLike(w, r, cfg.db.Like)
+}
+
+func (cfg *apiConfig) handleDeleteLike(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithLike(w, r, cfg.db.Unlike)
+}
+
+// respondWithLike applies a like or unlike for the caller and writes the
+// chirp's resulting like state. Both operations are idempotent.
+func (cfg *apiConfig) respondWithLike(w http.ResponseWriter, r *http.Request, apply func(userID, chirpID int) (database.Chirp, error)) {
+	userID, err := cfg.authenticate(r, auth.ScopeLikesWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	chirp, err := apply(userID, chirpID)
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find chirp"}`)
+		return
+	}
+	response, err := cfg.chirpResponse(chirp, userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+		return
+	}
+
+	type returnLike struct {
+		ID        int  `json:"id"`
+		LikeCount int  `json:"like_count"`
+		LikedByMe bool `json:"liked_by_me"`
+	}
+	jsonReturn, err := json.Marshal(returnLike{
+		ID:        response.ID,
+		LikeCount: response.LikeCount,
+		LikedByMe: *response.LikedByMe,
+	})
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handleGETLikes lists the chirps the caller has liked, most recently liked
+// first. Pages are selected with limit and offset.
+func (cfg *apiConfig) handleGETLikes(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	offset, err := parseOffset(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+
+	liked, err := cfg.db.GetLikedChirps(userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not list likes"}`)
+		return
+	}
+	total := len(liked)
+	liked = page(liked, offset, limit)
+
+	chirps := make([]database.Chirp, 0, len(liked))
+	for _, like := range liked {
+		chirps = append(chirps, like.Chirp)
+	}
+	responses, err := cfg.chirpResponses(chirps, userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not list likes"}`)
+		return
+	}
+
+	type likedEntry struct {
+		chirpResponse
+		LikedAt string `json:"liked_at"`
+	}
+	type returnList struct {
+		Total  int          `json:"total"`
+		Chirps []likedEntry `json:"chirps"`
+	}
+	result := returnList{
+		Total:  total,
+		Chirps: make([]likedEntry, 0, len(responses)),
+	}
+	for i, response := range responses {
+		result.Chirps = append(result.Chirps, likedEntry{
+			chirpResponse: response,
+			LikedAt:       liked[i].LikedAt.Format(time.RFC3339),
+		})
+	}
+
+	jsonReturn, err := json.Marshal(result)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
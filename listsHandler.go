@@ -0,0 +1,398 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+const (
+	maxListNameLength        = 50
+	maxListDescriptionLength = 160
+	maxListsPerUser          = 100
+	maxListMembers           = 500
+)
+
+type listResponse struct {
+	ID            int    `json:"id"`
+	OwnerID       int    `json:"owner_id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Private       bool   `json:"private"`
+	MemberCount   int    `json:"member_count"`
+	FollowerCount int    `json:"follower_count"`
+	// FollowedByMe is only set when the request was authenticated.
+	FollowedByMe *bool     `json:"followed_by_me,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func newListResponse(list database.List, stats database.ListStats, viewerID int) listResponse {
+	response := listResponse{
+		ID:            list.ID,
+		OwnerID:       list.OwnerID,
+		Name:          list.Name,
+		Description:   list.Description,
+		Private:       list.Private,
+		MemberCount:   stats.Members,
+		FollowerCount: stats.Followers,
+		CreatedAt:     list.CreatedAt,
+		UpdatedAt:     list.UpdatedAt,
+	}
+	if viewerID != 0 {
+		followed := stats.FollowedByViewer
+		response.FollowedByMe = &followed
+	}
+	return response
+}
+
+func respondWithList(w http.ResponseWriter, code int, list database.List, stats database.ListStats, viewerID int) {
+	jsonReturn, err := json.Marshal(newListResponse(list, stats, viewerID))
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, code, jsonReturn)
+}
+
+// respondWithLists writes one page of lists, selected with limit and
+// offset.
+func respondWithLists(w http.ResponseWriter, r *http.Request, lists []database.ListWithStats, viewerID int) {
+	limit, err := parseLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	offset, err := parseOffset(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+
+	type returnList struct {
+		Total int            `json:"total"`
+		Lists []listResponse `json:"lists"`
+	}
+	result := returnList{Total: len(lists), Lists: []listResponse{}}
+	for _, list := range page(lists, offset, limit) {
+		result.Lists = append(result.Lists, newListResponse(list.List, list.Stats, viewerID))
+	}
+	jsonReturn, err := json.Marshal(result)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+func respondWithListError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrListNotFound):
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find list"}`)
+	case errors.Is(err, database.ErrBlocked):
+		responseWithError(w, http.StatusForbidden, `{"error": "can't add a user you've blocked or who blocked you"}`)
+	case errors.Is(err, database.ErrListFull):
+		responseWithError(w, http.StatusConflict, fmt.Sprintf(`{"error": "lists can have at most %d members"}`, maxListMembers))
+	case errors.Is(err, database.ErrTooManyLists):
+		responseWithError(w, http.StatusConflict, fmt.Sprintf(`{"error": "you can have at most %d lists"}`, maxListsPerUser))
+	default:
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not update list"}`)
+	}
+}
+
+// decodeList reads the name, description and privacy of a list.
+func decodeList(r *http.Request) (database.List, error) {
+	type parameters struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Private     bool   `json:"private"`
+	}
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		return database.List{}, errors.New("Something went wrong")
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || utf8.RuneCountInString(params.Name) > maxListNameLength {
+		return database.List{}, fmt.Errorf("name must be 1 to %d characters", maxListNameLength)
+	}
+	if utf8.RuneCountInString(params.Description) > maxListDescriptionLength {
+		return database.List{}, fmt.Errorf("description must be at most %d characters", maxListDescriptionLength)
+	}
+	return database.List{
+		Name:        params.Name,
+		Description: params.Description,
+		Private:     params.Private,
+	}, nil
+}
+
+func parseListID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	listID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid list id"}`)
+		return 0, false
+	}
+	return listID, true
+}
+
+func (cfg *apiConfig) handlePOSTList(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeListsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	list, err := decodeList(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	list.OwnerID = userID
+	list, err = cfg.db.CreateList(list, maxListsPerUser)
+	if err != nil {
+		respondWithListError(w, err)
+		return
+	}
+	respondWithList(w, http.StatusCreated, list, database.ListStats{}, userID)
+}
+
+// handleGETList shows a list. Private lists are only visible to their
+// owner.
+func (cfg *apiConfig) handleGETList(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	listID, ok := parseListID(w, r)
+	if !ok {
+		return
+	}
+	list, stats, err := cfg.db.GetList(listID, viewerID)
+	if err != nil {
+		respondWithListError(w, err)
+		return
+	}
+	respondWithList(w, http.StatusOK, list, stats, viewerID)
+}
+
+// handlePUTList renames a list or changes its description or privacy.
+func (cfg *apiConfig) handlePUTList(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeListsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	listID, ok := parseListID(w, r)
+	if !ok {
+		return
+	}
+	list, err := decodeList(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	list.ID = listID
+	list.OwnerID = userID
+	_, err = cfg.db.UpdateList(list)
+	if err != nil {
+		respondWithListError(w, err)
+		return
+	}
+	list, stats, err := cfg.db.GetList(listID, userID)
+	if err != nil {
+		respondWithListError(w, err)
+		return
+	}
+	respondWithList(w, http.StatusOK, list, stats, userID)
+}
+
+func (cfg *apiConfig) handleDeleteList(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeListsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	listID, ok := parseListID(w, r)
+	if !ok {
+		return
+	}
+	err = cfg.db.DeleteList(listID, userID)
+	if err != nil {
+		respondWithListError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGETListMembers lists the accounts on a list, most recently added
+// first. Pages are selected with limit and offset.
+func (cfg *apiConfig) handleGETListMembers(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	listID, ok := parseListID(w, r)
+	if !ok {
+		return
+	}
+	_, _, err = cfg.db.GetList(listID, viewerID)
+	if err != nil {
+		respondWithListError(w, err)
+		return
+	}
+	cfg.respondWithUserList(w, r, listID, func(listID int) ([]database.FollowEdge, error) {
+		return cfg.db.GetListMembers(listID, viewerID)
+	})
+}
+
+func (cfg *apiConfig) handlePUTListMember(w http.ResponseWriter, r *http.Request) {
+	cfg.updateListMember(w, r, func(listID, ownerID, memberID int) error {
+		return cfg.db.AddListMember(listID, ownerID, memberID, maxListMembers)
+	})
+}
+
+func (cfg *apiConfig) handleDeleteListMember(w http.ResponseWriter, r *http.Request) {
+	cfg.updateListMember(w, r, cfg.db.RemoveListMember)
+}
+
+// updateListMember adds or removes the user in the path on the caller's
+// list. Both are idempotent.
+func (cfg *apiConfig) updateListMember(w http.ResponseWriter, r *http.Request, apply func(listID, ownerID, memberID int) error) {
+	userID, err := cfg.authenticate(r, auth.ScopeListsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	listID, ok := parseListID(w, r)
+	if !ok {
+		return
+	}
+	member, err := cfg.lookupUser(r.PathValue("user"))
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+	err = apply(listID, userID, member.ID)
+	if err != nil {
+		respondWithListError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGETListChirps returns chirps by a list's members, newest first.
+// Older pages are fetched by passing the last ID seen as max_id.
+func (cfg *apiConfig) handleGETListChirps(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	listID, ok := parseListID(w, r)
+	if !ok {
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	maxID, err := parseMaxID(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+
+	chirps, err := cfg.db.GetListTimeline(listID, viewerID, maxID, limit)
+	if errors.Is(err, database.ErrListNotFound) {
+		respondWithListError(w, err)
+		return
+	}
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not load list"}`)
+		return
+	}
+	responses, err := cfg.chirpResponses(chirps, viewerID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not load list"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(responses)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+func (cfg *apiConfig) handlePOSTListFollow(w http.ResponseWriter, r *http.Request) {
+	cfg.updateListFollow(w, r, cfg.db.FollowList)
+}
+
+func (cfg *apiConfig) handleDeleteListFollow(w http.ResponseWriter, r *http.Request) {
+	cfg.updateListFollow(w, r, cfg.db.UnfollowList)
+}
+
+func (cfg *apiConfig) updateListFollow(w http.ResponseWriter, r *http.Request, apply func(listID, userID int) error) {
+	userID, err := cfg.authenticate(r, auth.ScopeListsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	listID, ok := parseListID(w, r)
+	if !ok {
+		return
+	}
+	err = apply(listID, userID)
+	if err != nil {
+		respondWithListError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGETUserLists lists the lists a user has made, oldest first. Only
+// the owner sees their private lists.
+func (cfg *apiConfig) handleGETUserLists(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	owner, err := cfg.lookupUser(r.PathValue("user"))
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+	lists, err := cfg.db.GetUserLists(owner.ID, viewerID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not list lists"}`)
+		return
+	}
+	respondWithLists(w, r, lists, viewerID)
+}
+
+// handleGETFollowedLists lists the lists the caller follows, most recently
+// followed first.
+func (cfg *apiConfig) handleGETFollowedLists(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	lists, err := cfg.db.GetFollowedLists(userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not list lists"}`)
+		return
+	}
+	respondWithLists(w, r, lists, userID)
+}
@@ -1,19 +1,48 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/sutradev/chirpy/internal/auth"
 	database "github.com/sutradev/chirpy/internal/db"
+	"github.com/sutradev/chirpy/internal/media"
+	"github.com/sutradev/chirpy/internal/moderation"
+	"github.com/sutradev/chirpy/internal/oidc"
 )
 
 type apiConfig struct {
-	fileserverHits int
-	db             *database.DB
-	jwtSecret      string
-	polkaApiKey    string
+	fileserverHits  int
+	db              *database.DB
+	jwtSecret       string
+	polkaApiKey     string
+	passwords       auth.Passwords
+	passwordPolicy  auth.PasswordPolicy
+	consentTemplate *template.Template
+	oidcProviders   map[string]*oidc.Provider
+	exportTemplate  *template.Template
+	chirpRetention  string
+	moderation      *moderation.Pipeline
+	// moderators are the user IDs allowed to work the report queue, and
+	// admins those who can also suspend accounts directly. Admins are
+	// always moderators too.
+	moderators map[int]bool
+	admins     map[int]bool
+	blobs      media.BlobStore
+	// scheduleChanged wakes the scheduler when a draft is scheduled or
+	// rescheduled.
+	scheduleChanged chan struct{}
 }
 
 func main() {
@@ -22,17 +51,130 @@ func main() {
 	polkaApiKey := os.Getenv("API_KEY")
 	const filepathRoot = "."
 	const port = "8080"
+	const defaultPasswordMinLength = 8
 
 	db, err := database.NewDB("database.json")
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	bcryptCost := 0
+	if s := os.Getenv("BCRYPT_COST"); s != "" {
+		bcryptCost, err = strconv.Atoi(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	passwords, err := auth.NewPasswords(os.Getenv("PASSWORD_HASH_ALGORITHM"), bcryptCost)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	passwordMinLength := defaultPasswordMinLength
+	if s := os.Getenv("PASSWORD_MIN_LENGTH"); s != "" {
+		passwordMinLength, err = strconv.Atoi(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	passwordPolicy, err := auth.LoadPasswordPolicy(
+		passwordMinLength,
+		os.Getenv("BREACHED_PASSWORDS_FILE"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	consentTemplate, err := template.ParseFiles(filepath.Join(filepathRoot, "consent.html"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	exportTemplate, err := template.ParseFiles(filepath.Join(filepathRoot, "export.html"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	chirpRetention := os.Getenv("DELETED_USER_CHIRPS")
+	if chirpRetention == "" {
+		chirpRetention = database.RetainChirpsDelete
+	}
+	if chirpRetention != database.RetainChirpsDelete && chirpRetention != database.RetainChirpsAnonymize {
+		log.Fatalf("DELETED_USER_CHIRPS must be %q or %q", database.RetainChirpsDelete, database.RetainChirpsAnonymize)
+	}
+
+	moderationPipeline, err := moderation.LoadPipeline(os.Getenv("MODERATION_RULES_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Rules can be changed without a restart by editing the file and
+	// sending SIGHUP.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			err := moderationPipeline.Reload()
+			if err != nil {
+				log.Printf("could not reload moderation rules: %v", err)
+				continue
+			}
+			log.Print("reloaded moderation rules")
+		}
+	}()
+
+	moderators, err := parseUserIDs("MODERATOR_USER_IDS")
+	if err != nil {
+		log.Fatal(err)
+	}
+	admins, err := parseUserIDs("ADMIN_USER_IDS")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for id := range admins {
+		moderators[id] = true
+	}
+
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		// Anything under filepathRoot is served as is under /app/, so
+		// uploads are kept elsewhere.
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		mediaDir = filepath.Join(home, ".chirpy", "media")
+	}
+	blobs, err := media.NewLocalStore(mediaDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	oidcProviders, err := oidc.LoadProviders(
+		os.Getenv("OIDC_PROVIDERS_FILE"),
+		&http.Client{Timeout: 10 * time.Second},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	cfg := apiConfig{
-		fileserverHits: 0,
-		db:             db,
-		jwtSecret:      jwtSecret,
-		polkaApiKey:    polkaApiKey,
+		fileserverHits:  0,
+		db:              db,
+		jwtSecret:       jwtSecret,
+		polkaApiKey:     polkaApiKey,
+		passwords:       passwords,
+		passwordPolicy:  passwordPolicy,
+		consentTemplate: consentTemplate,
+		oidcProviders:   oidcProviders,
+		exportTemplate:  exportTemplate,
+		chirpRetention:  chirpRetention,
+		moderation:      moderationPipeline,
+		moderators:      moderators,
+		admins:          admins,
+		blobs:           blobs,
+		scheduleChanged: make(chan struct{}, 1),
 	}
+	go cfg.sweepMedia(context.Background())
+	go cfg.runScheduler(context.Background())
 
 	mux := http.NewServeMux()
 	mux.Handle(
@@ -43,24 +185,104 @@ func main() {
 		),
 	)
 
+	mux.HandleFunc("GET /media/{key}", cfg.handleGETMedia)
+
 	mux.HandleFunc("GET /admin/metrics", cfg.displayServerHits)
 
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
 	mux.HandleFunc("GET /api/reset", cfg.resetServerHits)
 
 	mux.HandleFunc("POST /api/chirps", cfg.handlePOSTChirps)
+	mux.HandleFunc("POST /api/media", cfg.handlePOSTMedia)
 	mux.HandleFunc("GET /api/chirps/", cfg.handleGETValidation)
 	mux.HandleFunc("GET /api/chirps/{id}", cfg.handleGetSingleChirp)
+	mux.HandleFunc("GET /api/chirps/{id}/thread", cfg.handleGETThread)
+	mux.HandleFunc("PUT /api/chirps/{id}", cfg.handlePUTChirp)
+	mux.HandleFunc("GET /api/chirps/{id}/history", cfg.handleGETChirpHistory)
 	mux.HandleFunc("DELETE /api/chirps/{id}", cfg.handleDeleteChirp)
+	mux.HandleFunc("PUT /api/chirps/{id}/like", cfg.handlePUTLike)
+	mux.HandleFunc("DELETE /api/chirps/{id}/like", cfg.handleDeleteLike)
+	mux.HandleFunc("POST /api/chirps/{id}/rechirp", cfg.handlePOSTRechirp)
+	mux.HandleFunc("DELETE /api/chirps/{id}/rechirp", cfg.handleDeleteRechirp)
+	mux.HandleFunc("POST /api/chirps/{id}/report", cfg.handlePOSTReport)
+	mux.HandleFunc("POST /api/chirps/{id}/poll/votes", cfg.handlePOSTPollVote)
+	mux.HandleFunc("PUT /api/chirps/{id}/pin", cfg.handlePUTPin)
+	mux.HandleFunc("DELETE /api/chirps/{id}/pin", cfg.handleDeletePin)
+
+	mux.HandleFunc("GET /api/drafts", cfg.handleGETDrafts)
+	mux.HandleFunc("POST /api/drafts", cfg.handlePOSTDraft)
+	mux.HandleFunc("GET /api/drafts/{id}", cfg.handleGETDraft)
+	mux.HandleFunc("PUT /api/drafts/{id}", cfg.handlePUTDraft)
+	mux.HandleFunc("DELETE /api/drafts/{id}", cfg.handleDeleteDraft)
+	mux.HandleFunc("POST /api/drafts/{id}/publish", cfg.handlePOSTDraftPublish)
+
+	mux.HandleFunc("GET /api/bookmarks", cfg.handleGETBookmarks)
+	mux.HandleFunc("POST /api/bookmarks", cfg.handlePOSTBookmark)
+	mux.HandleFunc("DELETE /api/bookmarks/{id}", cfg.handleDeleteBookmark)
+
+	mux.HandleFunc("POST /api/lists", cfg.handlePOSTList)
+	mux.HandleFunc("GET /api/lists/{id}", cfg.handleGETList)
+	mux.HandleFunc("PUT /api/lists/{id}", cfg.handlePUTList)
+	mux.HandleFunc("DELETE /api/lists/{id}", cfg.handleDeleteList)
+	mux.HandleFunc("GET /api/lists/{id}/members", cfg.handleGETListMembers)
+	mux.HandleFunc("PUT /api/lists/{id}/members/{user}", cfg.handlePUTListMember)
+	mux.HandleFunc("DELETE /api/lists/{id}/members/{user}", cfg.handleDeleteListMember)
+	mux.HandleFunc("GET /api/lists/{id}/chirps", cfg.handleGETListChirps)
+	mux.HandleFunc("POST /api/lists/{id}/follow", cfg.handlePOSTListFollow)
+	mux.HandleFunc("DELETE /api/lists/{id}/follow", cfg.handleDeleteListFollow)
+
+	mux.HandleFunc("GET /api/moderation/reports", cfg.handleGETReports)
+	mux.HandleFunc("GET /api/moderation/reports/{id}", cfg.handleGETReport)
+	mux.HandleFunc("POST /api/moderation/reports/{id}/claim", cfg.handlePOSTReportClaim)
+	mux.HandleFunc("POST /api/moderation/reports/{id}/resolve", cfg.handlePOSTReportResolve)
+	mux.HandleFunc("GET /api/moderation/audit", cfg.handleGETModerationAudit)
+	mux.HandleFunc("PUT /api/moderation/chirps/{id}/warning", cfg.handlePUTForcedWarning)
+	mux.HandleFunc("DELETE /api/moderation/chirps/{id}/warning", cfg.handleDeleteForcedWarning)
+	mux.HandleFunc("PUT /api/admin/users/{user}/suspension", cfg.handlePUTSuspension)
+	mux.HandleFunc("DELETE /api/admin/users/{user}/suspension", cfg.handleDeleteSuspension)
 
 	mux.HandleFunc("POST /api/users", cfg.handlePOSTUser)
 	mux.HandleFunc("PUT /api/users", cfg.handlePUTUser)
+	mux.HandleFunc("DELETE /api/users", cfg.handleDeleteUser)
+	mux.HandleFunc("GET /api/users/me/export", cfg.handleGETUserExport)
+	mux.HandleFunc("PUT /api/users/me/profile", cfg.handlePUTUserProfile)
+	mux.HandleFunc("GET /api/users/me/preferences", cfg.handleGETPreferences)
+	mux.HandleFunc("PUT /api/users/me/preferences", cfg.handlePUTPreferences)
+	mux.HandleFunc("GET /api/users/me/likes", cfg.handleGETLikes)
+	mux.HandleFunc("GET /api/users/me/mentions", cfg.handleGETMentions)
+	mux.HandleFunc("GET /api/users/me/blocks", cfg.handleGETBlocks)
+	mux.HandleFunc("PUT /api/users/me/blocks/{user}", cfg.handlePUTBlock)
+	mux.HandleFunc("DELETE /api/users/me/blocks/{user}", cfg.handleDeleteBlock)
+	mux.HandleFunc("GET /api/users/me/mutes", cfg.handleGETMutes)
+	mux.HandleFunc("PUT /api/users/me/mutes/{user}", cfg.handlePUTMute)
+	mux.HandleFunc("DELETE /api/users/me/mutes/{user}", cfg.handleDeleteMute)
+	mux.HandleFunc("GET /api/users/me/lists/followed", cfg.handleGETFollowedLists)
+	mux.HandleFunc("GET /api/users/{handle}", cfg.handleGETUserProfile)
+	mux.HandleFunc("GET /api/users/{user}/lists", cfg.handleGETUserLists)
+	mux.HandleFunc("GET /api/users/{user}/chirps", cfg.handleGETUserChirps)
+	mux.HandleFunc("POST /api/users/{user}/follow", cfg.handlePOSTFollow)
+	mux.HandleFunc("DELETE /api/users/{user}/follow", cfg.handleDeleteFollow)
+	mux.HandleFunc("GET /api/users/{user}/followers", cfg.handleGETFollowers)
+	mux.HandleFunc("GET /api/users/{user}/following", cfg.handleGETFollowing)
+	mux.HandleFunc("GET /api/timeline", cfg.handleGETTimeline)
+	mux.HandleFunc("GET /api/hashtags/{tag}", cfg.handleGETHashtag)
+	mux.HandleFunc("GET /api/trending/hashtags", cfg.handleGETTrendingHashtags)
+	mux.HandleFunc("GET /api/search", cfg.handleGETSearch)
 	mux.HandleFunc("POST /api/login", cfg.handlePOSTLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlePOSTRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlePOSTRevoke)
+	mux.HandleFunc("GET /api/auth/{provider}/login", cfg.handleGETOIDCLogin)
+	mux.HandleFunc("GET /api/auth/{provider}/callback", cfg.handleGETOIDCCallback)
 
 	mux.HandleFunc("POST /api/polka/webhooks", cfg.handlePolkaWebHook)
 
+	mux.HandleFunc("POST /api/oauth/clients", cfg.handlePOSTOAuthClient)
+	mux.HandleFunc("GET /oauth/authorize", cfg.handleGETOAuthAuthorize)
+	mux.HandleFunc("POST /oauth/authorize", cfg.handlePOSTOAuthAuthorize)
+	mux.HandleFunc("POST /oauth/token", cfg.handlePOSTOAuthToken)
+	mux.HandleFunc("POST /oauth/introspect", cfg.handlePOSTOAuthIntrospect)
+	mux.HandleFunc("POST /oauth/revoke", cfg.handlePOSTOAuthRevoke)
+
 	srv := &http.Server{
 		Addr:    ":" + port,
 		Handler: mux,
@@ -69,3 +291,21 @@ func main() {
 	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
 	log.Fatal(srv.ListenAndServe())
 }
+
+// parseUserIDs reads a comma-separated list of user IDs from an
+// environment variable.
+func parseUserIDs(env string) (map[int]bool, error) {
+	ids := map[int]bool{}
+	for _, s := range strings.Split(os.Getenv(env), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", env, err)
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+	"github.com/sutradev/chirpy/internal/media"
+)
+
+const (
+	maxAttachments = 4
+	// unattachedMediaAge is how long an upload can wait to be attached to
+	// a chirp before it's cleaned up.
+	unattachedMediaAge = 24 * time.Hour
+	mediaSweepInterval = time.Hour
+)
+
+// attachmentResponse is the JSON shape of an uploaded image.
+type attachmentResponse struct {
+	ID              string `json:"id"`
+	ContentType     string `json:"content_type"`
+	URL             string `json:"url"`
+	Width           int    `json:"width"`
+	Height          int    `json:"height"`
+	ThumbnailURL    string `json:"thumbnail_url"`
+	ThumbnailWidth  int    `json:"thumbnail_width"`
+	ThumbnailHeight int    `json:"thumbnail_height"`
+}
+
+func newAttachmentResponse(item database.Media) attachmentResponse {
+	return attachmentResponse{
+		ID:              item.ID,
+		ContentType:     item.ContentType,
+		URL:             "/media/" + item.Key,
+		Width:           item.Width,
+		Height:          item.Height,
+		ThumbnailURL:    "/media/" + item.ThumbnailKey,
+		ThumbnailWidth:  item.ThumbnailWidth,
+		ThumbnailHeight: item.ThumbnailHeight,
+	}
+}
+
+// handlePOSTMedia uploads an image, sent as the "file" field of a
+// multipart form, to attach to a chirp. The image is stored without its
+// metadata, along with a thumbnail.
+func (cfg *apiConfig) handlePOSTMedia(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	// Leave room for the multipart headers around the file.
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxUploadSize+64<<10)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			responseWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf(`{"error": "files can be at most %d bytes"}`, media.MaxUploadSize))
+			return
+		}
+		responseWithError(w, http.StatusBadRequest, `{"error": "send the image as the file field of a multipart form"}`)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxUploadSize+1))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "could not read upload"}`)
+		return
+	}
+	if len(data) > media.MaxUploadSize {
+		responseWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf(`{"error": "files can be at most %d bytes"}`, media.MaxUploadSize))
+		return
+	}
+
+	img, err := media.Process(data)
+	switch {
+	case errors.Is(err, media.ErrUnsupportedType):
+		responseWithError(w, http.StatusUnsupportedMediaType, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	case errors.Is(err, media.ErrInvalidImage), errors.Is(err, media.ErrImageTooLarge):
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	case err != nil:
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not process image"}`)
+		return
+	}
+
+	id, err := newMediaID()
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not store image"}`)
+		return
+	}
+	item := database.Media{
+		ID:              id,
+		OwnerID:         userID,
+		ContentType:     img.ContentType,
+		Key:             id + img.Ext,
+		Width:           img.Width,
+		Height:          img.Height,
+		Size:            len(img.Data),
+		ThumbnailKey:    id + "_thumb" + img.ThumbnailExt,
+		ThumbnailWidth:  img.ThumbnailWidth,
+		ThumbnailHeight: img.ThumbnailHeight,
+	}
+	err = cfg.blobs.Put(r.Context(), item.Key, img.Data, img.ContentType)
+	if err == nil {
+		err = cfg.blobs.Put(r.Context(), item.ThumbnailKey, img.Thumbnail, img.ThumbnailContentType)
+	}
+	if err == nil {
+		item, err = cfg.db.CreateMedia(item)
+	}
+	if err != nil {
+		cfg.deleteBlobs(r.Context(), item)
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not store image"}`)
+		return
+	}
+
+	jsonReturn, err := json.Marshal(newAttachmentResponse(item))
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusCreated, jsonReturn)
+}
+
+func newMediaID() (string, error) {
+	bytes := make([]byte, 16)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// handleGETMedia serves a stored image or thumbnail to whoever may see the
+// chirp it's on. Keys are random and files never change once written, so
+// they can be cached forever, though only by the viewer unless the chirp
+// is visible to everyone.
+func (cfg *apiConfig) handleGETMedia(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	visible, public, err := cfg.db.MediaAccess(key, viewerID, cfg.moderators[viewerID])
+	if errors.Is(err, database.ErrMediaNotFound) || err == nil && !visible {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not read file", http.StatusInternalServerError)
+		return
+	}
+	blob, err := cfg.blobs.Get(r.Context(), key)
+	if errors.Is(err, media.ErrBlobNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not read file", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	if public {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		w.Header().Set("Vary", "Authorization")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, blob)
+}
+
+// sweepMedia deletes the files of uploads that were never attached and of
+// chirps that have since been deleted, until ctx is done.
+func (cfg *apiConfig) sweepMedia(ctx context.Context) {
+	ticker := time.NewTicker(mediaSweepInterval)
+	defer ticker.Stop()
+	for {
+		unused, err := cfg.db.TakeUnusedMedia(unattachedMediaAge)
+		if err != nil {
+			log.Printf("could not sweep media: %v", err)
+		}
+		for _, item := range unused {
+			cfg.deleteBlobs(ctx, item)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) deleteBlobs(ctx context.Context, item database.Media) {
+	for _, key := range []string{item.Key, item.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		err := cfg.blobs.Delete(ctx, key)
+		if err != nil {
+			log.Printf("could not delete media %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+const (
+	oauthCodeLifetime    = 10 * time.Minute
+	oauthAccessMinutes   = 60
+	oauthRefreshLifetime = 24 * 60 * time.Hour
+)
+
+type authorizeRequest struct {
+	client              database.OAuthClient
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+type consentPage struct {
+	ClientID            string
+	ClientName          string
+	Scopes              []string
+	Error               string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func (cfg *apiConfig) handlePOSTOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, "")
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+
+	params := struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "Invalid request payload"}`)
+		return
+	}
+	if params.Name == "" || len(params.RedirectURIs) == 0 {
+		responseWithError(w, http.StatusBadRequest, `{"error": "name and redirect_uris are required"}`)
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if !validRedirectURI(uri) {
+			responseWithError(w, http.StatusBadRequest, `{"error": "invalid redirect_uri"}`)
+			return
+		}
+	}
+	scopes, err := auth.ParseScope(strings.Join(params.Scopes, " "), auth.AllScopes())
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid scope"}`)
+		return
+	}
+
+	clientID, err := auth.MakeRandomToken()
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not create client"}`)
+		return
+	}
+	client := database.OAuthClient{
+		ID:           clientID,
+		Name:         params.Name,
+		OwnerID:      userID,
+		RedirectURIs: params.RedirectURIs,
+		Scopes:       scopes,
+	}
+	clientSecret := ""
+	if params.Confidential {
+		clientSecret, err = auth.MakeRandomToken()
+		if err != nil {
+			responseWithError(w, http.StatusInternalServerError, `{"error": "could not create client"}`)
+			return
+		}
+		client.SecretHash = auth.HashSecret(clientSecret)
+	}
+	client, err = cfg.db.CreateOAuthClient(client)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not create client"}`)
+		return
+	}
+
+	type returnClient struct {
+		ClientID     string   `json:"client_id"`
+		ClientSecret string   `json:"client_secret,omitempty"`
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+	}
+	jsonReturn, err := json.Marshal(returnClient{
+		ClientID:     client.ID,
+		ClientSecret: clientSecret,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+	})
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusCreated, jsonReturn)
+}
+
+func (cfg *apiConfig) handleGETOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	req, ok := cfg.parseAuthorizeRequest(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+	cfg.renderConsent(w, http.StatusOK, req, "")
+}
+
+func (cfg *apiConfig) handlePOSTOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	req, ok := cfg.parseAuthorizeRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+	if r.PostForm.Get("decision") != "allow" {
+		redirectWithError(w, r, req, "access_denied")
+		return
+	}
+
+	user, err := cfg.db.GetUserByEmail(r.PostForm.Get("email"))
+	if err == nil {
+		err = cfg.passwords.Compare(user.Password, r.PostForm.Get("password"))
+	}
+	if err != nil {
+		cfg.renderConsent(w, http.StatusUnauthorized, req, "Incorrect email or password")
+		return
+	}
+	if user.Suspension.Active(time.Now()) {
+		cfg.renderConsent(w, http.StatusForbidden, req, "This account is suspended")
+		return
+	}
+
+	code, err := auth.MakeRandomToken()
+	if err != nil {
+		redirectWithError(w, r, req, "server_error")
+		return
+	}
+	err = cfg.db.StoreAuthorizationCode(database.OAuthCode{
+		CodeHash:            auth.HashSecret(code),
+		ClientID:            req.client.ID,
+		UserID:              user.ID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpirationDate:      time.Now().UTC().Add(oauthCodeLifetime),
+	})
+	if err != nil {
+		redirectWithError(w, r, req, "server_error")
+		return
+	}
+
+	query := url.Values{}
+	query.Set("code", code)
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	http.Redirect(w, r, appendQuery(req.RedirectURI, query), http.StatusFound)
+}
+
+// parseAuthorizeRequest validates the authorization request parameters.
+// Problems with the client or redirect URI are shown to the user, anything
+// else is reported back to the client's redirect URI as RFC 6749 requires.
+func (cfg *apiConfig) parseAuthorizeRequest(w http.ResponseWriter, r *http.Request, values url.Values) (authorizeRequest, bool) {
+	client, err := cfg.db.GetOAuthClient(values.Get("client_id"))
+	if err != nil {
+		http.Error(w, "Unknown client", http.StatusBadRequest)
+		return authorizeRequest{}, false
+	}
+	redirectURI := values.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.HasRedirectURI(redirectURI) {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return authorizeRequest{}, false
+	}
+
+	req := authorizeRequest{
+		client:              client,
+		RedirectURI:         redirectURI,
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+	}
+	if values.Get("response_type") != "code" {
+		redirectWithError(w, r, req, "unsupported_response_type")
+		return authorizeRequest{}, false
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		redirectWithError(w, r, req, "invalid_request")
+		return authorizeRequest{}, false
+	}
+	scopes, err := auth.ParseScope(values.Get("scope"), client.Scopes)
+	if err != nil {
+		redirectWithError(w, r, req, "invalid_scope")
+		return authorizeRequest{}, false
+	}
+	req.Scope = strings.Join(scopes, " ")
+	return req, true
+}
+
+func (cfg *apiConfig) renderConsent(w http.ResponseWriter, statusCode int, req authorizeRequest, message string) {
+	page := consentPage{
+		ClientID:            req.client.ID,
+		ClientName:          req.client.Name,
+		Error:               message,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		State:               req.State,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	}
+	for _, scope := range strings.Fields(req.Scope) {
+		page.Scopes = append(page.Scopes, auth.Scopes[scope])
+	}
+	w.Header().Add("Content-Type", "text/html; charset=utf-8")
+	w.Header().Add("X-Frame-Options", "DENY")
+	w.Header().Add("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	err := cfg.consentTemplate.Execute(w, page)
+	if err != nil {
+		log.Printf("render consent page: %v", err)
+	}
+}
+
+func (cfg *apiConfig) handlePOSTOAuthToken(w http.ResponseWriter, r *http.Request) {
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		oauthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	var userID int
+	var scope string
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, err := cfg.db.ConsumeAuthorizationCode(auth.HashSecret(r.PostForm.Get("code")))
+		if err != nil ||
+			code.ClientID != client.ID ||
+			code.RedirectURI != r.PostForm.Get("redirect_uri") ||
+			!auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge, code.CodeChallengeMethod) {
+			oauthError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		if cfg.userSuspended(code.UserID) {
+			oauthError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		userID = code.UserID
+		scope = code.Scope
+	case "refresh_token":
+		tokenHash := auth.HashSecret(r.PostForm.Get("refresh_token"))
+		grant, err := cfg.db.GetOAuthGrant(tokenHash)
+		if err != nil || grant.ClientID != client.ID {
+			oauthError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		// Suspending a user revokes their grants; this also covers any
+		// that slipped through while the suspension was being applied.
+		if cfg.userSuspended(grant.UserID) {
+			oauthError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		scope = grant.Scope
+		if requested := r.PostForm.Get("scope"); requested != "" {
+			scopes, err := auth.ParseScope(requested, strings.Fields(grant.Scope))
+			if err != nil {
+				oauthError(w, http.StatusBadRequest, "invalid_scope")
+				return
+			}
+			scope = strings.Join(scopes, " ")
+		}
+		// Refresh tokens are rotated on every use. Only one of several
+		// requests racing with the same token gets to consume it.
+		grant, err = cfg.db.ConsumeOAuthGrant(tokenHash)
+		if err != nil {
+			oauthError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		userID = grant.UserID
+	default:
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	accessToken, refreshToken, err := auth.MakeScopedToken(
+		cfg.jwtSecret,
+		oauthAccessMinutes,
+		userID,
+		client.ID,
+		scope,
+	)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	now := time.Now().UTC()
+	err = cfg.db.StoreOAuthGrant(database.OAuthGrant{
+		TokenHash:      auth.HashSecret(refreshToken),
+		ClientID:       client.ID,
+		UserID:         userID,
+		Scope:          scope,
+		DateMade:       now,
+		ExpirationDate: now.Add(oauthRefreshLifetime),
+	})
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	type returnToken struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+	jsonReturn, err := json.Marshal(returnToken{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    oauthAccessMinutes * 60,
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	})
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	w.Header().Add("Cache-Control", "no-store")
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handlePOSTOAuthIntrospect implements RFC 7662. Clients may only
+// introspect tokens that were issued to them.
+func (cfg *apiConfig) handlePOSTOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		oauthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	type introspection struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		Subject   string `json:"sub,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+		ExpiresAt int64  `json:"exp,omitempty"`
+		IssuedAt  int64  `json:"iat,omitempty"`
+		Issuer    string `json:"iss,omitempty"`
+	}
+	result := introspection{}
+
+	token := r.PostForm.Get("token")
+	if claims, err := auth.VerifyAccessToken(token, cfg.jwtSecret); err == nil {
+		_, userErr := cfg.tokenUser(claims)
+		if claims.ClientID == client.ID && !cfg.db.IsAccessTokenRevoked(claims.ID) && userErr == nil {
+			result = introspection{
+				Active:    true,
+				Scope:     claims.Scope,
+				ClientID:  claims.ClientID,
+				Subject:   claims.Subject,
+				TokenType: "Bearer",
+				ExpiresAt: claims.ExpiresAt.Unix(),
+				IssuedAt:  claims.IssuedAt.Unix(),
+				Issuer:    claims.Issuer,
+			}
+		}
+	} else if grant, err := cfg.db.GetOAuthGrant(auth.HashSecret(token)); err == nil {
+		if grant.ClientID == client.ID {
+			result = introspection{
+				Active:    true,
+				Scope:     grant.Scope,
+				ClientID:  grant.ClientID,
+				Subject:   strconv.Itoa(grant.UserID),
+				TokenType: "refresh_token",
+				ExpiresAt: grant.ExpirationDate.Unix(),
+				IssuedAt:  grant.DateMade.Unix(),
+				Issuer:    "chirpy",
+			}
+		}
+	}
+
+	jsonReturn, err := json.Marshal(result)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handlePOSTOAuthRevoke implements RFC 7009. Unknown tokens are not an
+// error, so the response is always 200 once the client authenticates.
+func (cfg *apiConfig) handlePOSTOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		oauthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if claims, err := auth.VerifyAccessToken(token, cfg.jwtSecret); err == nil {
+		if claims.ClientID == client.ID {
+			err = cfg.db.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time)
+			if err != nil {
+				oauthError(w, http.StatusServiceUnavailable, "server_error")
+				return
+			}
+		}
+	} else {
+		tokenHash := auth.HashSecret(token)
+		grant, err := cfg.db.GetOAuthGrant(tokenHash)
+		if err == nil && grant.ClientID == client.ID {
+			err = cfg.db.DeleteOAuthGrant(tokenHash)
+			if err != nil {
+				oauthError(w, http.StatusServiceUnavailable, "server_error")
+				return
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticateOAuthClient identifies the calling client from HTTP Basic
+// credentials or the client_id and client_secret form fields. Public
+// clients only send their client_id.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OAuthClient, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return database.OAuthClient{}, err
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, err = url.QueryUnescape(clientID)
+		if err != nil {
+			return database.OAuthClient{}, err
+		}
+		clientSecret, err = url.QueryUnescape(clientSecret)
+		if err != nil {
+			return database.OAuthClient{}, err
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	client, err := cfg.db.GetOAuthClient(clientID)
+	if err != nil {
+		return database.OAuthClient{}, err
+	}
+	hash := auth.HashSecret(clientSecret)
+	if client.IsConfidential() && subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash)) != 1 {
+		return database.OAuthClient{}, errors.New("invalid client secret")
+	}
+	return client, nil
+}
+
+func oauthError(w http.ResponseWriter, statusCode int, code string) {
+	w.Header().Add("Cache-Control", "no-store")
+	responseWithError(w, statusCode, fmt.Sprintf(`{"error": %q}`, code))
+}
+
+func redirectWithError(w http.ResponseWriter, r *http.Request, req authorizeRequest, code string) {
+	query := url.Values{}
+	query.Set("error", code)
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	http.Redirect(w, r, appendQuery(req.RedirectURI, query), http.StatusFound)
+}
+
+func appendQuery(uri string, query url.Values) string {
+	if strings.Contains(uri, "?") {
+		return uri + "&" + query.Encode()
+	}
+	return uri + "?" + query.Encode()
+}
+
+func validRedirectURI(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Fragment != "" || parsed.Host == "" {
+		return false
+	}
+	if parsed.Scheme == "https" {
+		return true
+	}
+	host := parsed.Hostname()
+	return parsed.Scheme == "http" && (host == "localhost" || host == "127.0.0.1")
+}
+
+// userSuspended reports whether tokens can't be issued to the user, either
+// because they're suspended or because they no longer exist.
+func (cfg *apiConfig) userSuspended(userID int) bool {
+	user, err := cfg.db.GetUser(userID)
+	return err != nil || user.Suspension.Active(time.Now())
+}
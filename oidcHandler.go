@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+	"github.com/sutradev/chirpy/internal/oidc"
+)
+
+const oidcLoginLifetime = 10 * time.Minute
+
+func (cfg *apiConfig) handleGETOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	providerName := r.PathValue("provider")
+	provider, ok := cfg.oidcProviders[providerName]
+	if !ok {
+		responseWithError(w, http.StatusNotFound, `{"error": "unknown provider"}`)
+		return
+	}
+
+	state, err := auth.MakeRandomToken()
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not start login"}`)
+		return
+	}
+	nonce, err := auth.MakeRandomToken()
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not start login"}`)
+		return
+	}
+	codeVerifier, err := auth.MakeRandomToken()
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not start login"}`)
+		return
+	}
+
+	redirectURL, err := provider.AuthCodeURL(r.Context(), state, nonce, auth.PKCEChallenge(codeVerifier))
+	if err != nil {
+		log.Printf("oidc provider %s: %v", providerName, err)
+		responseWithError(w, http.StatusBadGateway, `{"error": "identity provider unavailable"}`)
+		return
+	}
+	err = cfg.db.StoreOIDCLogin(database.OIDCLogin{
+		StateHash:      auth.HashSecret(state),
+		Provider:       providerName,
+		Nonce:          nonce,
+		CodeVerifier:   codeVerifier,
+		ExpirationDate: time.Now().UTC().Add(oidcLoginLifetime),
+	})
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not start login"}`)
+		return
+	}
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// handleGETOIDCCallback finishes a sign-in with an external provider and
+// responds with the same token pair as a password login.
+func (cfg *apiConfig) handleGETOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	providerName := r.PathValue("provider")
+	provider, ok := cfg.oidcProviders[providerName]
+	if !ok {
+		responseWithError(w, http.StatusNotFound, `{"error": "unknown provider"}`)
+		return
+	}
+
+	query := r.URL.Query()
+	login, err := cfg.db.ConsumeOIDCLogin(auth.HashSecret(query.Get("state")))
+	if err != nil || login.Provider != providerName {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid or expired login state"}`)
+		return
+	}
+	if providerError := query.Get("error"); providerError != "" {
+		responseWithError(
+			w,
+			http.StatusUnauthorized,
+			fmt.Sprintf(`{"error": "identity provider returned %q"}`, providerError),
+		)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("oidc provider %s: %v", providerName, err)
+		responseWithError(w, http.StatusUnauthorized, `{"error": "could not verify identity"}`)
+		return
+	}
+
+	user, err := cfg.db.GetUserByIdentity(provider.Issuer(), claims.Subject)
+	if err != nil {
+		user, err = cfg.linkOIDCUser(provider, claims)
+		if err != nil {
+			responseWithError(w, http.StatusInternalServerError, `{"error": "could not link account"}`)
+			return
+		}
+	}
+
+	cfg.respondWithLoginTokens(w, user)
+}
+
+// linkOIDCUser attaches a new external identity to a user. Only providers
+// marked trusted_email may link to an existing account by verified email;
+// otherwise anyone who can get that address verified elsewhere could claim
+// the account. Everyone else gets a new user without a password, and an
+// email already held by another account is left off it.
+func (cfg *apiConfig) linkOIDCUser(provider *oidc.Provider, claims oidc.IDTokenClaims) (database.User, error) {
+	email := claims.Email
+	if !claims.EmailVerified {
+		email = ""
+	}
+	if email != "" {
+		user, err := cfg.db.GetUserByEmail(email)
+		if err == nil {
+			if provider.TrustedEmail() {
+				return cfg.linkIdentity(provider, claims, user, email)
+			}
+			email = ""
+		}
+	}
+
+	profile, err := normalizeProfile(database.Profile{DisplayName: claims.Name})
+	if err != nil {
+		profile = database.Profile{}
+	}
+	created, err := cfg.db.CreateUser(email, "", profile)
+	if err != nil {
+		return database.User{}, err
+	}
+	user, err := cfg.db.GetUser(created.ID)
+	if err != nil {
+		return database.User{}, err
+	}
+	return cfg.linkIdentity(provider, claims, user, email)
+}
+
+func (cfg *apiConfig) linkIdentity(provider *oidc.Provider, claims oidc.IDTokenClaims, user database.User, email string) (database.User, error) {
+	err := cfg.db.LinkIdentity(database.Identity{
+		Issuer:  provider.Issuer(),
+		Subject: claims.Subject,
+		UserID:  user.ID,
+		Email:   email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	database "github.com/sutradev/chirpy/internal/db"
+	"github.com/sutradev/chirpy/internal/oidc"
+)
+
+func TestLinkOIDCUser(t *testing.T) {
+	tests := []struct {
+		name          string
+		trustedEmail  bool
+		emailVerified bool
+		wantExisting  bool
+	}{
+		{"trusted, verified", true, true, true},
+		{"trusted, unverified", true, false, false},
+		{"untrusted, verified", false, true, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			existing, err := db.CreateUser("alice@example.com", "hash", database.Profile{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := &apiConfig{db: db}
+			provider := oidc.NewProvider(oidc.Config{
+				Name:         "test",
+				Issuer:       "https://issuer.example.com",
+				TrustedEmail: tc.trustedEmail,
+			}, nil)
+			claims := oidc.IDTokenClaims{Email: "alice@example.com", EmailVerified: tc.emailVerified}
+			claims.Subject = "subject"
+
+			user, err := cfg.linkOIDCUser(provider, claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := user.ID == existing.ID; got != tc.wantExisting {
+				t.Fatalf("linked to existing account = %v, want %v", got, tc.wantExisting)
+			}
+			if !tc.wantExisting && user.Email != "" {
+				t.Errorf("new account took email %q", user.Email)
+			}
+			linked, err := db.GetUserByIdentity(provider.Issuer(), "subject")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linked.ID != user.ID {
+				t.Errorf("identity linked to user %d, want %d", linked.ID, user.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+// maxPinnedChirps is how many chirps can be pinned to a profile at once.
+const maxPinnedChirps = 3
+
+// handlePUTPin pins one of the caller's chirps to their profile.
+func (cfg *apiConfig) handlePUTPin(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+
+	chirp, err := cfg.db.PinChirp(userID, chirpID, maxPinnedChirps)
+	switch {
+	case errors.Is(err, database.ErrChirpNotFound):
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find chirp"}`)
+		return
+	case errors.Is(err, database.ErrCannotPin):
+		responseWithError(w, http.StatusForbidden, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	case errors.Is(err, database.ErrTooManyPins):
+		responseWithError(w, http.StatusConflict, fmt.Sprintf(`{"error": "at most %d chirps can be pinned"}`, maxPinnedChirps))
+		return
+	case err != nil:
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not pin chirp"}`)
+		return
+	}
+
+	response, err := cfg.chirpResponse(chirp, userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(response)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handleDeletePin unpins a chirp from the caller's profile.
+func (cfg *apiConfig) handleDeletePin(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	err = cfg.db.UnpinChirp(userID, chirpID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not unpin chirp"}`)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
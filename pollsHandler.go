@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 4
+	maxPollOptionLength = 25
+	minPollDuration     = 5 * time.Minute
+	maxPollDuration     = 7 * 24 * time.Hour
+)
+
+// pollParams is a poll as sent when posting a chirp.
+type pollParams struct {
+	Options         []string `json:"options"`
+	DurationMinutes int      `json:"duration_minutes"`
+}
+
+// newPoll validates a requested poll and sets it to close after its
+// duration.
+func newPoll(params pollParams) (*database.Poll, error) {
+	if len(params.Options) < minPollOptions || len(params.Options) > maxPollOptions {
+		return nil, fmt.Errorf("a poll needs %d to %d options", minPollOptions, maxPollOptions)
+	}
+	duration := time.Duration(params.DurationMinutes) * time.Minute
+	if duration < minPollDuration || duration > maxPollDuration {
+		return nil, fmt.Errorf("a poll must last between %v and %v minutes", minPollDuration.Minutes(), maxPollDuration.Minutes())
+	}
+	poll := &database.Poll{ClosesAt: time.Now().UTC().Add(duration)}
+	seen := map[string]bool{}
+	for _, text := range params.Options {
+		text = strings.TrimSpace(text)
+		if text == "" || utf8.RuneCountInString(text) > maxPollOptionLength {
+			return nil, fmt.Errorf("poll options must be 1 to %d characters", maxPollOptionLength)
+		}
+		if seen[strings.ToLower(text)] {
+			return nil, errors.New("poll options must be different")
+		}
+		seen[strings.ToLower(text)] = true
+		poll.Options = append(poll.Options, database.PollOption{Text: text})
+	}
+	return poll, nil
+}
+
+// pollResponse is the JSON shape of a poll. Vote counts are null until the
+// viewer has voted or the poll has closed.
+type pollResponse struct {
+	Options    []pollOptionResponse `json:"options"`
+	TotalVotes *int                 `json:"total_votes"`
+	ClosesAt   time.Time            `json:"closes_at"`
+	Closed     bool                 `json:"closed"`
+	// VotedOption is the viewer's choice, or null if they haven't voted.
+	VotedOption *int `json:"voted_option"`
+}
+
+type pollOptionResponse struct {
+	Text  string `json:"text"`
+	Votes *int   `json:"votes"`
+}
+
+// newPollResponse shows a poll to a viewer; votedOption is nil if they
+// haven't voted.
+func newPollResponse(poll *database.Poll, votedOption *int) *pollResponse {
+	response := &pollResponse{
+		Options:     make([]pollOptionResponse, 0, len(poll.Options)),
+		ClosesAt:    poll.ClosesAt,
+		Closed:      poll.Closed(time.Now()),
+		VotedOption: votedOption,
+	}
+	showResults := response.Closed || votedOption != nil
+	total := 0
+	for _, option := range poll.Options {
+		entry := pollOptionResponse{Text: option.Text}
+		if showResults {
+			votes := option.Votes
+			entry.Votes = &votes
+			total += votes
+		}
+		response.Options = append(response.Options, entry)
+	}
+	if showResults {
+		response.TotalVotes = &total
+	}
+	return response
+}
+
+// handlePOSTPollVote votes for one option, by index, in a chirp's poll.
+// Each user gets a single vote.
+func (cfg *apiConfig) handlePOSTPollVote(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	type parameters struct {
+		Option *int `json:"option"`
+	}
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil || params.Option == nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "option is required"}`)
+		return
+	}
+
+	chirp, err := cfg.db.Vote(userID, chirpID, *params.Option)
+	switch {
+	case errors.Is(err, database.ErrChirpNotFound):
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find chirp"}`)
+		return
+	case errors.Is(err, database.ErrAlreadyVoted), errors.Is(err, database.ErrPollClosed):
+		responseWithError(w, http.StatusConflict, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	case errors.Is(err, database.ErrNoPoll), errors.Is(err, database.ErrInvalidPollOption):
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	case err != nil:
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not record vote"}`)
+		return
+	}
+
+	response, err := cfg.chirpResponse(chirp, userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(response)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+func TestPollResultsHiddenUntilVotedOrClosed(t *testing.T) {
+	newTestPoll := func(closesAt time.Time) *database.Poll {
+		return &database.Poll{
+			Options:  []database.PollOption{{Text: "yes", Votes: 3}, {Text: "no", Votes: 1}},
+			ClosesAt: closesAt,
+		}
+	}
+	voted := 0
+
+	tests := []struct {
+		name        string
+		poll        *database.Poll
+		votedOption *int
+		wantResults bool
+	}{
+		{"open, not voted", newTestPoll(time.Now().Add(time.Hour)), nil, false},
+		{"open, voted", newTestPoll(time.Now().Add(time.Hour)), &voted, true},
+		{"closed, not voted", newTestPoll(time.Now().Add(-time.Minute)), nil, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			response := newPollResponse(tc.poll, tc.votedOption)
+			if !tc.wantResults {
+				if response.TotalVotes != nil {
+					t.Error("total votes shown before voting or close")
+				}
+				for _, option := range response.Options {
+					if option.Votes != nil {
+						t.Errorf("votes for %q shown before voting or close", option.Text)
+					}
+				}
+				return
+			}
+			if response.TotalVotes == nil || *response.TotalVotes != 4 {
+				t.Fatalf("got total votes %v, want 4", response.TotalVotes)
+			}
+			for i, option := range response.Options {
+				if option.Votes == nil || *option.Votes != tc.poll.Options[i].Votes {
+					t.Errorf("got votes %v for %q, want %d", option.Votes, option.Text, tc.poll.Options[i].Votes)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarURLLength   = 2048
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,15}$`)
+
+// numericPattern matches handles that would be mistaken for user IDs.
+var numericPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// reservedHandles would collide with routes under /api/users/.
+var reservedHandles = map[string]bool{
+	"me":    true,
+	"admin": true,
+	"api":   true,
+}
+
+// publicProfile is what anyone can see about a user. It must never carry
+// the email address.
+type publicProfile struct {
+	ID          int    `json:"id"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url"`
+	// Only the join date is public; updated_at would reveal when the
+	// account's email or password last changed.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newPublicProfile(user database.User) publicProfile {
+	return publicProfile{
+		ID:          user.ID,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		CreatedAt:   user.CreatedAt,
+	}
+}
+
+// normalizeProfile trims the profile fields and checks them against the
+// length and format limits.
+func normalizeProfile(profile database.Profile) (database.Profile, error) {
+	profile.Handle = strings.TrimPrefix(strings.TrimSpace(profile.Handle), "@")
+	profile.DisplayName = strings.TrimSpace(profile.DisplayName)
+	profile.Bio = strings.TrimSpace(profile.Bio)
+	profile.AvatarURL = strings.TrimSpace(profile.AvatarURL)
+
+	if profile.Handle != "" {
+		if !handlePattern.MatchString(profile.Handle) {
+			return database.Profile{}, errors.New("handle must be 1-15 letters, digits or underscores")
+		}
+		if numericPattern.MatchString(profile.Handle) {
+			return database.Profile{}, errors.New("handle can't be only digits")
+		}
+		if reservedHandles[strings.ToLower(profile.Handle)] {
+			return database.Profile{}, errors.New("handle is reserved")
+		}
+	}
+	if utf8.RuneCountInString(profile.DisplayName) > maxDisplayNameLength {
+		return database.Profile{}, fmt.Errorf("display_name must be at most %d characters", maxDisplayNameLength)
+	}
+	if utf8.RuneCountInString(profile.Bio) > maxBioLength {
+		return database.Profile{}, fmt.Errorf("bio must be at most %d characters", maxBioLength)
+	}
+	if profile.AvatarURL != "" {
+		parsed, err := url.Parse(profile.AvatarURL)
+		if err != nil ||
+			len(profile.AvatarURL) > maxAvatarURLLength ||
+			(parsed.Scheme != "https" && parsed.Scheme != "http") ||
+			parsed.Host == "" {
+			return database.Profile{}, errors.New("avatar_url must be an http or https URL")
+		}
+	}
+	return profile, nil
+}
+
+func (cfg *apiConfig) handleGETUserProfile(w http.ResponseWriter, r *http.Request) {
+	handle := strings.TrimPrefix(r.PathValue("handle"), "@")
+	user, err := cfg.db.GetUserByHandle(handle)
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(newPublicProfile(user))
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handleGETUserChirps is a user's profile timeline: their pinned chirps,
+// then their chirps newest first. Replies are left out unless
+// include_replies=true, and rechirps are included unless
+// include_rechirps=false. Older pages are fetched by passing the last ID
+// seen as max_id; pinned chirps only come with the first page.
+func (cfg *apiConfig) handleGETUserChirps(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	user, err := cfg.lookupUser(r.PathValue("user"))
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+	query := database.ProfileQuery{
+		UserID:          user.ID,
+		ViewerID:        viewerID,
+		IncludeRechirps: true,
+	}
+	query.Limit, err = parseLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	query.MaxID, err = parseMaxID(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	for name, include := range map[string]*bool{
+		"include_replies":  &query.IncludeReplies,
+		"include_rechirps": &query.IncludeRechirps,
+	} {
+		s := r.URL.Query().Get(name)
+		if s == "" {
+			continue
+		}
+		*include, err = strconv.ParseBool(s)
+		if err != nil {
+			responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": "%s must be true or false"}`, name))
+			return
+		}
+	}
+
+	timeline, err := cfg.db.GetProfileTimeline(query)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not load chirps"}`)
+		return
+	}
+	pinned, err := cfg.chirpResponses(timeline.Pinned, viewerID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not load chirps"}`)
+		return
+	}
+	chirps, err := cfg.chirpResponses(timeline.Chirps, viewerID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not load chirps"}`)
+		return
+	}
+
+	type returnProfile struct {
+		User           publicProfile   `json:"user"`
+		ChirpCount     int             `json:"chirp_count"`
+		FollowerCount  int             `json:"follower_count"`
+		FollowingCount int             `json:"following_count"`
+		Pinned         []chirpResponse `json:"pinned"`
+		Chirps         []chirpResponse `json:"chirps"`
+	}
+	jsonReturn, err := json.Marshal(returnProfile{
+		User:           newPublicProfile(user),
+		ChirpCount:     timeline.ChirpCount,
+		FollowerCount:  timeline.FollowerCount,
+		FollowingCount: timeline.FollowingCount,
+		Pinned:         pinned,
+		Chirps:         chirps,
+	})
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+func (cfg *apiConfig) handlePUTUserProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, "")
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+
+	profile := database.Profile{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&profile)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "Invalid request payload"}`)
+		return
+	}
+	profile, err = normalizeProfile(profile)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+
+	user, err := cfg.db.UpdateProfile(userID, profile)
+	if errors.Is(err, database.ErrHandleTaken) {
+		responseWithError(w, http.StatusConflict, `{"error": "handle is already taken"}`)
+		return
+	}
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not update profile"}`)
+		return
+	}
+
+	jsonReturn, err := json.Marshal(newPublicProfile(user))
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handleGETPreferences returns the caller's preferences.
+func (cfg *apiConfig) handleGETPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, "")
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find user"}`)
+		return
+	}
+	respondWithPreferences(w, user.Preferences)
+}
+
+// handlePUTPreferences replaces the caller's preferences.
+func (cfg *apiConfig) handlePUTPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, "")
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	preferences := database.Preferences{}
+	err = json.NewDecoder(r.Body).Decode(&preferences)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "Invalid request payload"}`)
+		return
+	}
+	user, err := cfg.db.UpdatePreferences(userID, preferences)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not update preferences"}`)
+		return
+	}
+	respondWithPreferences(w, user.Preferences)
+}
+
+func respondWithPreferences(w http.ResponseWriter, preferences database.Preferences) {
+	jsonReturn, err := json.Marshal(preferences)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
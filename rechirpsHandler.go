@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+// handlePOSTRechirp reposts a chirp to the caller's followers. Rechirping
+// the same chirp again returns the existing rechirp.
+func (cfg *apiConfig) handlePOSTRechirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	rechirp, err := cfg.db.Rechirp(userID, chirpID)
+	if errors.Is(err, database.ErrCannotRechirp) {
+		responseWithError(w, http.StatusForbidden, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find chirp"}`)
+		return
+	}
+	response, err := cfg.chirpResponse(rechirp, userID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(response)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusCreated, jsonReturn)
+}
+
+func (cfg *apiConfig) handleDeleteRechirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	err = cfg.db.Unrechirp(userID, chirpID)
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find chirp"}`)
+		return
+	}
+	w.WriteHeader(204)
+}
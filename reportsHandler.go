@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sutradev/chirpy/internal/auth"
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+// reportReasons are the reason codes users can report a chirp for.
+var reportReasons = []string{
+	"spam",
+	"harassment",
+	"hate",
+	"violence",
+	"sexual",
+	"self_harm",
+	"misinformation",
+	"other",
+}
+
+const (
+	maxReportCommentLength = 500
+	// reportClaimTimeout is how long a claim keeps other moderators off a
+	// report before it can be taken over.
+	reportClaimTimeout    = time.Hour
+	defaultSuspensionDays = 7
+)
+
+// authenticateModerator is authenticate for the moderation endpoints. They
+// only accept first-party tokens, and the caller must be listed in
+// MODERATOR_USER_IDS.
+func (cfg *apiConfig) authenticateModerator(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := cfg.authenticate(r, "")
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return 0, false
+	}
+	if !cfg.moderators[userID] {
+		responseWithError(w, http.StatusForbidden, `{"error": "moderators only"}`)
+		return 0, false
+	}
+	return userID, true
+}
+
+// handlePOSTReport flags a chirp for moderators. Reporting the same chirp
+// again before it's dealt with returns the existing report.
+func (cfg *apiConfig) handlePOSTReport(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	type parameters struct {
+		Reason  string `json:"reason"`
+		Comment string `json:"comment"`
+	}
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "Something went wrong"}`)
+		return
+	}
+	if !slices.Contains(reportReasons, params.Reason) {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": "reason must be one of %s"}`, strings.Join(reportReasons, ", ")))
+		return
+	}
+	if len([]rune(params.Comment)) > maxReportCommentLength {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": "comment must be at most %d characters"}`, maxReportCommentLength))
+		return
+	}
+
+	report, err := cfg.db.CreateReport(userID, chirpID, params.Reason, params.Comment)
+	switch {
+	case errors.Is(err, database.ErrReportOwnChirp):
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	case err != nil:
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find chirp"}`)
+		return
+	}
+
+	// Reporters only get to see what they sent, not how it's handled.
+	type returnReport struct {
+		ID        int       `json:"id"`
+		ChirpID   int       `json:"chirp_id"`
+		Reason    string    `json:"reason"`
+		Comment   string    `json:"comment,omitempty"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	jsonReturn, err := json.Marshal(returnReport{
+		ID:        report.ID,
+		ChirpID:   report.ChirpID,
+		Reason:    report.Reason,
+		Comment:   report.Comment,
+		CreatedAt: report.CreatedAt,
+	})
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusCreated, jsonReturn)
+}
+
+// handleGETReports lists the moderation queue, oldest first. status picks
+// open (the default), claimed, resolved or all reports.
+func (cfg *apiConfig) handleGETReports(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.authenticateModerator(w, r); !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = database.ReportOpen
+	case "all":
+		status = ""
+	case database.ReportOpen, database.ReportClaimed, database.ReportResolved:
+	default:
+		responseWithError(w, http.StatusBadRequest, `{"error": "status must be open, claimed, resolved or all"}`)
+		return
+	}
+
+	reports, err := cfg.db.GetReports(status)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not list reports"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(reports)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handleGETReport shows a report with its history.
+func (cfg *apiConfig) handleGETReport(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.authenticateModerator(w, r); !ok {
+		return
+	}
+	reportID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid report id"}`)
+		return
+	}
+	report, events, err := cfg.db.GetReport(reportID)
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find report"}`)
+		return
+	}
+
+	type returnReport struct {
+		database.Report
+		Events []database.ModerationEvent `json:"events"`
+	}
+	jsonReturn, err := json.Marshal(returnReport{Report: report, Events: events})
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handlePOSTReportClaim assigns a report to the calling moderator.
+func (cfg *apiConfig) handlePOSTReportClaim(w http.ResponseWriter, r *http.Request) {
+	moderatorID, ok := cfg.authenticateModerator(w, r)
+	if !ok {
+		return
+	}
+	reportID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid report id"}`)
+		return
+	}
+	report, err := cfg.db.ClaimReport(reportID, moderatorID, reportClaimTimeout)
+	if err != nil {
+		respondWithReportError(w, err)
+		return
+	}
+	jsonReturn, err := json.Marshal(report)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+// handlePOSTReportResolve closes a report by dismissing it, hiding the
+// chirp, or hiding the chirp and suspending its author for suspend_days.
+func (cfg *apiConfig) handlePOSTReportResolve(w http.ResponseWriter, r *http.Request) {
+	moderatorID, ok := cfg.authenticateModerator(w, r)
+	if !ok {
+		return
+	}
+	reportID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid report id"}`)
+		return
+	}
+	type parameters struct {
+		Resolution  string `json:"resolution"`
+		Note        string `json:"note"`
+		SuspendDays int    `json:"suspend_days"`
+	}
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "Something went wrong"}`)
+		return
+	}
+	if params.SuspendDays < 0 {
+		responseWithError(w, http.StatusBadRequest, `{"error": "suspend_days must be positive"}`)
+		return
+	}
+	if params.SuspendDays == 0 {
+		params.SuspendDays = defaultSuspensionDays
+	}
+	suspendUntil := time.Now().UTC().AddDate(0, 0, params.SuspendDays)
+
+	report, err := cfg.db.ResolveReport(reportID, moderatorID, params.Resolution, params.Note, reportClaimTimeout, suspendUntil)
+	if err != nil {
+		respondWithReportError(w, err)
+		return
+	}
+	jsonReturn, err := json.Marshal(report)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
+
+func respondWithReportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrReportNotFound):
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find report"}`)
+	case errors.Is(err, database.ErrReportClaimed), errors.Is(err, database.ErrReportResolved), errors.Is(err, database.ErrHeldChirpInvalid):
+		responseWithError(w, http.StatusConflict, fmt.Sprintf(`{"error": %q}`, err))
+	case errors.Is(err, database.ErrUnknownResolution):
+		responseWithError(w, http.StatusBadRequest, `{"error": "resolution must be dismiss, hide_chirp or suspend_author"}`)
+	default:
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not update report"}`)
+	}
+}
+
+// handleGETModerationAudit lists what moderators and admins have done,
+// newest first. Pages are selected with limit and offset.
+func (cfg *apiConfig) handleGETModerationAudit(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.authenticateModerator(w, r); !ok {
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	offset, err := parseOffset(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+
+	events, err := cfg.db.GetModerationLog(offset, limit)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not read the audit log"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(events)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
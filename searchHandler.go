@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+// maxSearchOffset bounds how deep into the ranking a search can page, since
+// every hit up to offset+limit has to be kept while ranking.
+const maxSearchOffset = 1000
+
+// handleGETSearch runs a full-text search over chirps. q takes words,
+// "quoted phrases" and the filters author:handle, before:date and
+// after:date; results are paged with limit and offset.
+func (cfg *apiConfig) handleGETSearch(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	query, err := database.ParseSearchQuery(r.URL.Query().Get("q"))
+	if errors.Is(err, database.ErrEmptySearch) {
+		responseWithError(w, http.StatusBadRequest, `{"error": "q is required"}`)
+		return
+	}
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	offset, err := parseOffset(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	if offset > maxSearchOffset {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": "offset must be at most %d"}`, maxSearchOffset))
+		return
+	}
+
+	result, err := cfg.db.Search(query, viewerID, offset, limit)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not search chirps"}`)
+		return
+	}
+	responses, err := cfg.chirpResponses(result.Chirps, viewerID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not search chirps"}`)
+		return
+	}
+
+	type returnSearch struct {
+		Total  int             `json:"total"`
+		Chirps []chirpResponse `json:"chirps"`
+	}
+	jsonReturn, err := json.Marshal(returnSearch{
+		Total:  result.Total,
+		Chirps: responses,
+	})
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
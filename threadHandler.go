@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	database "github.com/sutradev/chirpy/internal/db"
+)
+
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 5
+)
+
+// threadNodeResponse is a chirp within a conversation. Deleted chirps that
+// still have replies are sent as placeholders with only id, deleted and
+// their replies.
+type threadNodeResponse struct {
+	chirpResponse
+	Deleted bool                 `json:"deleted,omitempty"`
+	Replies []threadNodeResponse `json:"replies"`
+}
+
+// handleGETThread returns the chain of ancestors of a chirp plus a page of
+// its reply tree. Direct replies are paged with limit and after_id; deeper
+// levels are capped by depth and by limit per level, with reply_count
+// telling clients where to fetch more.
+func (cfg *apiConfig) handleGETThread(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.optionalViewer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), authErrorStatus(err))
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	afterID := 0
+	if s := r.URL.Query().Get("after_id"); s != "" {
+		afterID, err = strconv.Atoi(s)
+		if err != nil {
+			responseWithError(w, http.StatusBadRequest, `{"error": "after_id must be an integer"}`)
+			return
+		}
+	}
+	depth := defaultThreadDepth
+	if s := r.URL.Query().Get("depth"); s != "" {
+		depth, err = strconv.Atoi(s)
+		if err != nil || depth < 1 {
+			responseWithError(w, http.StatusBadRequest, `{"error": "depth must be a positive integer"}`)
+			return
+		}
+		if depth > maxThreadDepth {
+			depth = maxThreadDepth
+		}
+	}
+
+	thread, err := cfg.db.GetThread(chirpID, afterID, limit, depth, viewerID)
+	if err != nil {
+		responseWithError(w, http.StatusNotFound, `{"error": "could not find chirp"}`)
+		return
+	}
+
+	chirps := []database.Chirp{}
+	var collect func(nodes []database.ThreadNode)
+	collect = func(nodes []database.ThreadNode) {
+		for _, node := range nodes {
+			if !node.Deleted {
+				chirps = append(chirps, node.Chirp)
+			}
+			collect(node.Replies)
+		}
+	}
+	collect(thread.Ancestors)
+	collect([]database.ThreadNode{thread.Chirp})
+
+	responses, err := cfg.chirpResponses(chirps, viewerID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not load thread"}`)
+		return
+	}
+	byID := make(map[int]chirpResponse, len(responses))
+	for _, response := range responses {
+		byID[response.ID] = response
+	}
+
+	var convert func(node database.ThreadNode) threadNodeResponse
+	convert = func(node database.ThreadNode) threadNodeResponse {
+		converted := threadNodeResponse{
+			chirpResponse: byID[node.Chirp.ID],
+			Deleted:       node.Deleted,
+			Replies:       make([]threadNodeResponse, 0, len(node.Replies)),
+		}
+		if node.Deleted {
+			converted.chirpResponse = chirpResponse{
+				ID:          node.Chirp.ID,
+				InReplyToID: node.Chirp.InReplyToID,
+				ReplyCount:  node.ReplyCount,
+			}
+		}
+		for _, reply := range node.Replies {
+			converted.Replies = append(converted.Replies, convert(reply))
+		}
+		return converted
+	}
+
+	type returnThread struct {
+		Ancestors   []threadNodeResponse `json:"ancestors"`
+		Chirp       threadNodeResponse   `json:"chirp"`
+		NextAfterID int                  `json:"next_after_id,omitempty"`
+	}
+	result := returnThread{
+		Ancestors:   make([]threadNodeResponse, 0, len(thread.Ancestors)),
+		Chirp:       convert(thread.Chirp),
+		NextAfterID: thread.NextAfterID,
+	}
+	for _, ancestor := range thread.Ancestors {
+		// Ancestors are listed flat; their other replies aren't loaded.
+		ancestor.Replies = nil
+		result.Ancestors = append(result.Ancestors, convert(ancestor))
+	}
+
+	jsonReturn, err := json.Marshal(result)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
@@ -2,13 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"strconv"
+	"time"
 
 	auth "github.com/sutradev/chirpy/internal/auth"
 	database "github.com/sutradev/chirpy/internal/db"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func (cfg *apiConfig) handlePOSTUser(w http.ResponseWriter, r *http.Request) {
@@ -19,7 +20,24 @@ func (cfg *apiConfig) handlePOSTUser(w http.ResponseWriter, r *http.Request) {
 		responseWithError(w, 500, `{"error": "could not decode to User struct"}`)
 		return
 	}
-	returnUser, err := cfg.db.CreateUser(jsonStruct.Email, jsonStruct.Password, cfg.jwtSecret)
+	profile, err := normalizeProfile(jsonStruct.Profile)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, err))
+		return
+	}
+	passwordHash, ok := cfg.hashNewPassword(w, jsonStruct.Password)
+	if !ok {
+		return
+	}
+	returnUser, err := cfg.db.CreateUser(jsonStruct.Email, passwordHash, profile)
+	if errors.Is(err, database.ErrEmailTaken) {
+		responseWithError(w, http.StatusConflict, `{"error": "email is already registered"}`)
+		return
+	}
+	if errors.Is(err, database.ErrHandleTaken) {
+		responseWithError(w, http.StatusConflict, `{"error": "handle is already taken"}`)
+		return
+	}
 	if err != nil {
 		responseWithError(w, 500, `{"error": "signing token to New User"}`)
 		return
@@ -29,6 +47,9 @@ func (cfg *apiConfig) handlePOSTUser(w http.ResponseWriter, r *http.Request) {
 		Email:       returnUser.Email,
 		Token:       returnUser.Token,
 		IsChirpyRed: returnUser.IsChirpyRed,
+		Profile:     returnUser.Profile,
+		CreatedAt:   returnUser.CreatedAt,
+		UpdatedAt:   returnUser.UpdatedAt,
 	}
 	jsonReturn, err := json.Marshal(modifiedUser)
 	if err != nil {
@@ -57,12 +78,25 @@ func (cfg *apiConfig) handlePOSTLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginData.Password))
+	err = cfg.passwords.Compare(user.Password, loginData.Password)
 	if err != nil {
 		responseWithError(w, http.StatusUnauthorized, `{"error": "Invalid password"}`)
 		return
 	}
+	if cfg.passwords.NeedsRehash(user.Password) {
+		cfg.rehashPassword(user.ID, loginData.Password)
+	}
 
+	cfg.respondWithLoginTokens(w, user)
+}
+
+// respondWithLoginTokens issues a new access and refresh token pair for the
+// user and writes the login response. Suspended users are turned away.
+func (cfg *apiConfig) respondWithLoginTokens(w http.ResponseWriter, user database.User) {
+	if user.Suspension.Active(time.Now()) {
+		respondWithSuspended(w, user.Suspension)
+		return
+	}
 	signedToken, refreshToken, err := auth.MakeToken(
 		cfg.jwtSecret,
 		60,
@@ -74,20 +108,24 @@ func (cfg *apiConfig) handlePOSTLogin(w http.ResponseWriter, r *http.Request) {
 			http.StatusInternalServerError,
 			`{"error": "Coud not make token for user"}`,
 		)
+		return
 	}
 
 	err = cfg.db.StoreRefreshToken(user.ID, refreshToken)
 	if err != nil {
 		body := fmt.Sprint(err)
 		http.Error(w, body, http.StatusInternalServerError)
+		return
 	}
 
 	type returnParam struct {
-		ID            int    `json:"id"`
-		Email         string `json:"email"`
-		Token         string `json:"token"`
-		Refresh_Token string `json:"refresh_token"`
-		IsChirpyRed   bool   `json:"is_chirpy_red"`
+		ID            int       `json:"id"`
+		Email         string    `json:"email"`
+		Token         string    `json:"token"`
+		Refresh_Token string    `json:"refresh_token"`
+		IsChirpyRed   bool      `json:"is_chirpy_red"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
 	}
 
 	modifiedUser := returnParam{
@@ -96,6 +134,8 @@ func (cfg *apiConfig) handlePOSTLogin(w http.ResponseWriter, r *http.Request) {
 		Token:         signedToken,
 		Refresh_Token: refreshToken,
 		IsChirpyRed:   user.IsChirpyRed,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
 	}
 
 	jsonReturn, err := json.Marshal(modifiedUser)
@@ -114,24 +154,11 @@ func (cfg *apiConfig) handlePUTUser(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	jsonStruct := database.User{}
 	err := decoder.Decode(&jsonStruct)
-	// Extract the token from the Authorization header
-	bearerToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		body := fmt.Sprint(err)
-		http.Error(w, body, http.StatusUnauthorized)
-		return
-	}
-	userID, err := auth.VerifyToken(bearerToken, cfg.jwtSecret)
+	// Authenticate the caller from the Authorization header
+	intID, err := cfg.authenticate(r, auth.ScopeUsersWrite)
 	if err != nil {
 		body := fmt.Sprint(err)
-		http.Error(w, body, http.StatusUnauthorized)
-		return
-	}
-
-	intID, err := strconv.Atoi(userID)
-	if err != nil {
-		body := fmt.Sprint(err)
-		http.Error(w, body, http.StatusInternalServerError)
+		http.Error(w, body, authErrorStatus(err))
 		return
 	}
 
@@ -142,17 +169,28 @@ func (cfg *apiConfig) handlePUTUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Update the user
+	passwordHash, ok := cfg.hashNewPassword(w, jsonStruct.Password)
+	if !ok {
+		return
+	}
 
-	updatedUser, err := cfg.db.UpdateUser(foundUser.ID, jsonStruct.Email, jsonStruct.Password)
+	updatedUser, err := cfg.db.UpdateUser(foundUser.ID, jsonStruct.Email, passwordHash)
+	if errors.Is(err, database.ErrEmailTaken) {
+		responseWithError(w, http.StatusConflict, `{"error": "email is already registered"}`)
+		return
+	}
 	if err != nil {
 		http.Error(w, "could not update user", http.StatusInternalServerError)
+		return
 	}
 
 	// Prepare the modified user response
 	modifiedUser := modifiedUser{
-		ID:    updatedUser.ID,
-		Email: updatedUser.Email,
-		Token: updatedUser.AuthData.Token,
+		ID:        updatedUser.ID,
+		Email:     updatedUser.Email,
+		Token:     updatedUser.AuthData.Token,
+		CreatedAt: updatedUser.CreatedAt,
+		UpdatedAt: updatedUser.UpdatedAt,
 	}
 
 	// Write the JSON response
@@ -180,6 +218,10 @@ func (cfg *apiConfig) handlePOSTRefresh(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "User Token Not Found", http.StatusNoContent)
 		return
 	}
+	if user.Suspension.Active(time.Now()) {
+		respondWithSuspended(w, user.Suspension)
+		return
+	}
 	jwtToken, _, err := auth.MakeToken(cfg.jwtSecret, 60, user.ID)
 	if err != nil {
 		http.Error(w, "Unable to make new token", http.StatusNoContent)
@@ -225,3 +267,45 @@ func (cfg *apiConfig) handlePOSTRevoke(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(204)
 }
+
+// hashNewPassword checks a user-chosen password against the password policy
+// and hashes it, writing the error response itself when either step fails.
+func (cfg *apiConfig) hashNewPassword(w http.ResponseWriter, password string) (string, bool) {
+	err := cfg.passwordPolicy.Validate(password)
+	if errors.Is(err, auth.ErrPasswordTooShort) {
+		responseWithError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf(`{"error": "Password must be at least %d characters"}`, cfg.passwordPolicy.MinLength),
+		)
+		return "", false
+	}
+	if errors.Is(err, auth.ErrPasswordBreached) {
+		responseWithError(
+			w,
+			http.StatusBadRequest,
+			`{"error": "Password has appeared in a data breach, choose another"}`,
+		)
+		return "", false
+	}
+	passwordHash, err := cfg.passwords.Hash(password)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not hash password"}`)
+		return "", false
+	}
+	return passwordHash, true
+}
+
+// rehashPassword upgrades a stored hash after a successful login. Failures
+// are only logged since the old hash still works.
+func (cfg *apiConfig) rehashPassword(userID int, password string) {
+	passwordHash, err := cfg.passwords.Hash(password)
+	if err != nil {
+		log.Printf("rehash password for user %d: %v", userID, err)
+		return
+	}
+	err = cfg.db.UpdatePasswordHash(userID, passwordHash)
+	if err != nil {
+		log.Printf("rehash password for user %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	database "github.com/sutradev/chirpy/internal/db"
+	"github.com/sutradev/chirpy/internal/moderation"
+)
+
+const maxContentWarningLength = 100
+
+var (
+	errContentWarningTooLong  = fmt.Errorf("Content warning is too long; the limit is %d characters", maxContentWarningLength)
+	errContentWarningRejected = errors.New("Content warning was rejected by moderation")
+)
+
+// contentWarning checks the warning an author gave and runs it through
+// moderation like the body. Authors who gave none get one made from the
+// names of any warn rules the body matched; authors who gave their own
+// have the names it doesn't already mention added in parentheses, so
+// their wording can't drop a warning the rules require.
+func (cfg *apiConfig) contentWarning(warning string, decision moderation.Decision) (string, error) {
+	warning = strings.TrimSpace(warning)
+	if warning == "" {
+		return strings.Join(decision.Warnings, ", "), nil
+	}
+	if utf8.RuneCountInString(warning) > maxContentWarningLength {
+		return "", errContentWarningTooLong
+	}
+	checked := cfg.moderation.Moderate(warning)
+	if checked.Action == moderation.ActionHold || checked.Action == moderation.ActionReject {
+		return "", errContentWarningRejected
+	}
+
+	missing := []string{}
+	for _, rule := range decision.Warnings {
+		if !strings.Contains(strings.ToLower(checked.Body), strings.ToLower(rule)) {
+			missing = append(missing, rule)
+		}
+	}
+	if len(missing) == 0 {
+		return checked.Body, nil
+	}
+	return fmt.Sprintf("%s (%s)", checked.Body, strings.Join(missing, ", ")), nil
+}
+
+// handlePUTForcedWarning lets a moderator put a content warning on
+// someone else's chirp, overriding the author's. At least one of
+// content_warning and sensitive must be given.
+func (cfg *apiConfig) handlePUTForcedWarning(w http.ResponseWriter, r *http.Request) {
+	moderatorID, ok := cfg.authenticateModerator(w, r)
+	if !ok {
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	type parameters struct {
+		ContentWarning string `json:"content_warning"`
+		Sensitive      bool   `json:"sensitive"`
+		Note           string `json:"note"`
+	}
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "Something went wrong"}`)
+		return
+	}
+	params.ContentWarning = strings.TrimSpace(params.ContentWarning)
+	if params.ContentWarning == "" && !params.Sensitive {
+		responseWithError(w, http.StatusBadRequest, `{"error": "content_warning or sensitive is required"}`)
+		return
+	}
+	if utf8.RuneCountInString(params.ContentWarning) > maxContentWarningLength {
+		responseWithError(w, http.StatusBadRequest, fmt.Sprintf(`{"error": %q}`, errContentWarningTooLong))
+		return
+	}
+
+	chirp, err := cfg.db.ForceContentWarning(chirpID, moderatorID, database.ForcedWarning{
+		Text:      params.ContentWarning,
+		Sensitive: params.Sensitive,
+	}, params.Note)
+	if err != nil {
+		respondWithWarningError(w, err)
+		return
+	}
+	cfg.respondWithModeratedChirp(w, chirp, moderatorID)
+}
+
+// handleDeleteForcedWarning lifts a forced content warning, leaving the
+// author's own.
+func (cfg *apiConfig) handleDeleteForcedWarning(w http.ResponseWriter, r *http.Request) {
+	moderatorID, ok := cfg.authenticateModerator(w, r)
+	if !ok {
+		return
+	}
+	chirpID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		responseWithError(w, http.StatusBadRequest, `{"error": "invalid chirp id"}`)
+		return
+	}
+	chirp, err := cfg.db.LiftContentWarning(chirpID, moderatorID, r.URL.Query().Get("note"))
+	if err != nil {
+		respondWithWarningError(w, err)
+		return
+	}
+	cfg.respondWithModeratedChirp(w, chirp, moderatorID)
+}
+
+func respondWithWarningError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrChirpNotFound), errors.Is(err, database.ErrNoForcedWarning):
+		responseWithError(w, http.StatusNotFound, fmt.Sprintf(`{"error": %q}`, err))
+	case errors.Is(err, database.ErrWarningOwnChirp):
+		responseWithError(w, http.StatusForbidden, fmt.Sprintf(`{"error": %q}`, err))
+	default:
+		responseWithError(w, http.StatusInternalServerError, `{"error": "could not update chirp"}`)
+	}
+}
+
+func (cfg *apiConfig) respondWithModeratedChirp(w http.ResponseWriter, chirp database.Chirp, moderatorID int) {
+	response, err := cfg.chirpResponse(chirp, moderatorID)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Something went wrong"}`)
+		return
+	}
+	jsonReturn, err := json.Marshal(response)
+	if err != nil {
+		responseWithError(w, http.StatusInternalServerError, `{"error": "Failed to marshal response"}`)
+		return
+	}
+	responseWithJson(w, http.StatusOK, jsonReturn)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sutradev/chirpy/internal/moderation"
+)
+
+func TestContentWarning(t *testing.T) {
+	pipeline := moderation.NewPipeline(
+		moderation.NewWordList("spoilers", moderation.ActionWarn, []string{"ending"}),
+		moderation.NewWordList("gore", moderation.ActionWarn, []string{"blood"}),
+		moderation.NewWordList("profanity", moderation.ActionMask, []string{"kerfuffle"}),
+		moderation.NewWordList("spam", moderation.ActionHold, []string{"free money"}),
+	)
+	cfg := &apiConfig{moderation: pipeline}
+
+	tests := []struct {
+		name    string
+		warning string
+		body    string
+		want    string
+		wantErr error
+	}{
+		{"none", "", "hello", "", nil},
+		{"from rules", "  ", "the ending, in blood", "spoilers, gore", nil},
+		{"author's own", " scary stuff ", "hello", "scary stuff", nil},
+		{"author's own keeps rule names", "finale talk", "the ending, in blood", "finale talk (spoilers, gore)", nil},
+		{"author's own already names a rule", "Spoilers for the finale", "the ending, in blood", "Spoilers for the finale (gore)", nil},
+		{"masked", "a kerfuffle", "hello", "a ****", nil},
+		{"held", "free money", "hello", "", errContentWarningRejected},
+		{"too long", strings.Repeat("x", maxContentWarningLength+1), "hello", "", errContentWarningTooLong},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := cfg.contentWarning(tc.warning, pipeline.Moderate(tc.body))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}